@@ -0,0 +1,40 @@
+// Package bench holds representative elf workloads (testdata/*.elf) timed
+// with `go test -bench . ./bench`, to catch performance regressions in the
+// evaluator and its collections. Each workload's first line is
+// `// expect: <result>`, checked before it is timed.
+package bench
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/evaluator"
+    "elf-lang/impl/internal/parser"
+)
+
+func BenchmarkWorkloads(b *testing.B) {
+    files, err := filepath.Glob("testdata/*.elf")
+    if err != nil { b.Fatal(err) }
+    for _, file := range files {
+        data, err := os.ReadFile(file)
+        if err != nil { b.Fatal(err) }
+        src := string(data)
+        expect, _, _ := strings.Cut(strings.TrimPrefix(src, "// expect: "), "\n")
+        prog, err := parser.Parse(src)
+        if err != nil { b.Fatalf("%s: %v", file, err) }
+        b.Run(strings.TrimSuffix(filepath.Base(file), ".elf"), func(b *testing.B) {
+            if got := run(b, prog); got != expect { b.Fatalf("%s: got %s, expected %s", file, got, expect) }
+            b.ReportAllocs()
+            for b.Loop() { run(b, prog) }
+        })
+    }
+}
+
+func run(b *testing.B, prog parser.Program) string {
+    v, err := evaluator.New(io.Discard).Eval(prog)
+    if err != nil { b.Fatal(err) }
+    return evaluator.Format(v)
+}
@@ -3,43 +3,69 @@ package main
 import (
     "bufio"
     "encoding/json"
+    "errors"
+    "flag"
+    "io"
     "fmt"
     "os"
     "path/filepath"
 
+    "elf-lang/impl/internal/analysis"
     "elf-lang/impl/internal/lexer"
     "elf-lang/impl/internal/evaluator"
     "elf-lang/impl/internal/parser"
+    "elf-lang/impl/internal/playground"
+    "elf-lang/impl/internal/repl"
+    "elf-lang/impl/internal/runner"
 )
 
 type tokenOut struct {
     Type  string `json:"type"`
     Value string `json:"value"`
+    *tokenPos
 }
 
-func printTokens(path string) error {
+// tokenPos is where a token starts, included with --positions.
+type tokenPos struct {
+    Line   int `json:"line"`
+    Column int `json:"column"`
+    Offset int `json:"offset"`
+}
+
+// printTokens writes the file's tokens as JSON Lines, with their positions
+// when positions is set.
+func printTokens(path string, positions bool) error {
     data, err := os.ReadFile(path)
     if err != nil {
         return err
     }
-    toks := lexer.Lex(string(data))
+    toks, err := lexer.Tokenize(string(data))
+    if err != nil { return err }
     enc := json.NewEncoder(os.Stdout)
     enc.SetEscapeHTML(false)
     // json.Encoder by default emits minified JSON
     for _, t := range toks {
-        if err := enc.Encode(tokenOut{Type: t.Type, Value: t.Lit}); err != nil {
+        out := tokenOut{Type: t.Type, Value: t.Lit}
+        if positions { out.tokenPos = &tokenPos{Line: t.Pos.Line, Column: t.Pos.Col, Offset: t.Pos.Offset} }
+        if err := enc.Encode(out); err != nil {
             return err
         }
     }
     return nil
 }
 
-func printAST(path string) error {
+// printAST writes the program's AST as JSON; with resolved set, identifiers
+// are annotated with their bindings (see analysis.Annotate).
+func printAST(path string, opts runOptions, resolved bool) error {
     data, err := os.ReadFile(path)
     if err != nil { return err }
-    toks := lexer.Lex(string(data))
-    p := parser.New(toks)
-    prog := p.ParseProgram()
+    prog, err := parser.Parse(string(data))
+    if err != nil { return err }
+    if resolved {
+        ev, err := opts.newEvaluator(path)
+        if err != nil { return err }
+        if prog, err = analysis.Annotate(prog, ev.Names()); err != nil { return err }
+    }
     w := bufio.NewWriter(os.Stdout)
     enc := json.NewEncoder(w)
     enc.SetEscapeHTML(false)
@@ -48,22 +74,183 @@ func printAST(path string) error {
     return w.Flush()
 }
 
-func runProgram(path string) error {
+// errCheckFailed signals that `check` reported diagnostics.
+var errCheckFailed = errors.New("check failed")
+
+// checkProgram parses a file and prints any analysis diagnostics as
+// `file:line:col: severity: message [rule]`, without running it.
+func checkProgram(path string, opts runOptions, lint bool) error {
+    data, err := os.ReadFile(path)
+    if err != nil { return err }
+    prog, err := parser.Parse(string(data))
+    if err != nil { return err }
+    ev, err := opts.newEvaluator(path)
+    if err != nil { return err }
+    failed := false
+    report := func(severity string, diags []analysis.Diagnostic, err error) error {
+        for _, d := range diags { fmt.Fprintf(os.Stdout, "%s:%s: %s: %s [%s]\n", path, d.Pos, severity, d.Message, d.Rule) }
+        failed = failed || len(diags) > 0
+        return err
+    }
+    diags, err := analysis.Resolve(prog, ev.Names())
+    if err := report("error", diags, err); err != nil { return err }
+    severity := "error"
+    if opts.warnRedeclared { severity = "warning" }
+    diags, err = analysis.Redeclared(prog)
+    if err := report(severity, diags, err); err != nil { return err }
+    if lint {
+        diags, err := analysis.Lint(prog)
+        if err := report("warning", diags, err); err != nil { return err }
+    }
+    if failed { return errCheckFailed }
+    return nil
+}
+
+// resolve fails fast on the first identifier that can never be found, or
+// name declared twice in one scope, before any of the program runs. With
+// --warn-redeclared the latter are only reported, on stderr.
+func resolve(path string, prog parser.Program, ev *evaluator.Evaluator, opts runOptions) error {
+    diags, err := analysis.Resolve(prog, ev.Names())
+    if err != nil { return err }
+    // located like a runtime error, so exit prints where
+    if len(diags) > 0 { return &evaluator.RuntimeError{Err: errors.New(diags[0].Message), Site: fmt.Sprintf("%s:%s", path, diags[0].Pos)} }
+    if diags, err = analysis.Redeclared(prog); err != nil { return err }
+    for _, d := range diags {
+        if !opts.warnRedeclared { return fmt.Errorf("%s at %s:%s", d.Message, path, d.Pos) }
+        fmt.Fprintf(os.Stderr, "%s:%s: warning: %s [%s]\n", path, d.Pos, d.Message, d.Rule)
+    }
+    return nil
+}
+
+// errPartFailed signals that a solution part or test failed; the details
+// have already been printed alongside the other results.
+var errPartFailed = errors.New("solution part failed")
+
+func runProgram(path string, opts runOptions) error {
     data, err := os.ReadFile(path)
     if err != nil { return err }
-    toks := lexer.Lex(string(data))
-    p := parser.New(toks)
-    prog := p.ParseProgram()
-    ev := evaluator.New(os.Stdout)
-    val, err := ev.Eval(prog)
+    prog, err := parser.Parse(string(data))
     if err != nil { return err }
+    ev, err := opts.newEvaluator(path)
+    if err != nil { return err }
+    if err := resolve(path, prog, ev, opts); err != nil { return err }
+    ctx, cancel := opts.context()
+    defer cancel()
+    ev.SetContext(ctx)
+    // results go to --output when given; puts output always stays on stdout
+    var out io.Writer = os.Stdout
+    if opts.output != "" {
+        f, err := os.Create(opts.output)
+        if err != nil { return err }
+        defer f.Close()
+        out = f
+    }
+    if sol, ok := runner.Load(prog); ok {
+        var results []runner.Result
+        ok, streamed := true, false
+        if opts.parallel {
+            newEv, release := opts.evaluators(path)
+            defer release()
+            // text results are printed as each part completes
+            var done func(runner.Result)
+            if opts.format != "json" {
+                streamed = true
+                done = func(r runner.Result) { ok = runner.Print(out, []runner.Result{r}) && ok }
+            }
+            results, err = runner.RunParallel(newEv, sol, done)
+        } else {
+            results, err = runner.Run(ev, sol)
+        }
+        if err != nil { return err }
+        if opts.format == "json" { ok = runner.PrintJSON(out, results) } else if !streamed { ok = runner.Print(out, results) }
+        runner.PrintStats(diagnostics, results)
+        if !ok { return errPartFailed }
+        return nil
+    }
+    res := runner.Measure(ev, "Program", func() (evaluator.Value, error) { return ev.Eval(prog) })
+    if opts.format == "json" {
+        if !runner.PrintJSON(out, []runner.Result{res}) { return errPartFailed }
+        return nil
+    }
+    if res.Err != nil { return res.Err }
+    // everything the program printed comes before its value
+    if err := ev.Flush(); err != nil { return err }
     // Print only the value of the last top-level statement
-    fmt.Fprintln(os.Stdout, evaluator.Format(val))
+    if !opts.quiet {
+        if err := res.Print.Write(out, res.Value); err != nil { return err }
+        fmt.Fprintln(out)
+    }
+    runner.PrintStats(diagnostics, []runner.Result{res})
     return nil
 }
 
+func testProgram(path string, opts runOptions) error {
+    data, err := os.ReadFile(path)
+    if err != nil { return err }
+    prog, err := parser.Parse(string(data))
+    if err != nil { return err }
+    sol, _ := runner.Load(prog)
+    if len(sol.Tests) == 0 { return errors.New("No test sections found") }
+    ev, err := opts.newEvaluator(path)
+    if err != nil { return err }
+    if err := resolve(path, prog, ev, opts); err != nil { return err }
+    newEv, release := opts.evaluators(path)
+    defer release()
+    cases := runner.RunTests(newEv, sol)
+    if !runner.PrintTests(os.Stdout, cases) { return errPartFailed }
+    return nil
+}
+
+// parseFlags parses flags appearing anywhere among args (before or after the
+// file), returning the remaining positional arguments. Everything after a
+// `--` is positional, however much it looks like a flag.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+    var passthrough []string
+    for i, a := range args {
+        if a == "--" {
+            args, passthrough = args[:i], args[i+1:]
+            break
+        }
+    }
+    positional, err := parseInterspersed(fs, args)
+    if err != nil { return nil, err }
+    return append(positional, passthrough...), nil
+}
+
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+    var positional []string
+    for {
+        if err := fs.Parse(args); err != nil { return nil, err }
+        args = fs.Args()
+        if len(args) == 0 { return positional, nil }
+        positional = append(positional, args[0])
+        args = args[1:]
+    }
+}
+
 func usage(prog string) {
-    fmt.Fprintf(os.Stdout, "Usage: %s [tokens|ast] <file>\n", filepath.Base(prog))
+    fmt.Fprintf(os.Stdout, "Usage: %s [run|test|tokens|ast] [flags] <file|project-dir> [-- args...]\n       %s tokens [--positions] <file>\n       %s ast [--resolved] <file>\n       %s check [--lint] <file>\n       %s repl\n       %s playground [--port 8080]\n", filepath.Base(prog), filepath.Base(prog), filepath.Base(prog), filepath.Base(prog), filepath.Base(prog), filepath.Base(prog))
+}
+
+// printErrors reports err on the diagnostics stream, a line per syntax
+// error when parsing found several.
+func printErrors(err error) {
+    var errs parser.Errors
+    if !errors.As(err, &errs) {
+        fmt.Fprintln(diagnostics, "[Error]", err)
+        return
+    }
+    for _, e := range errs { fmt.Fprintln(diagnostics, "[Error]", e) }
+}
+
+// exit reports a command failure and exits non-zero.
+func exit(err error) {
+    if err != errPartFailed && err != errCheckFailed {
+        fmt.Fprintln(diagnostics, "[Error]", err)
+        // always on stderr, leaving stdout as the conformance tests expect
+        for _, line := range evaluator.Trace(err) { fmt.Fprintln(os.Stderr, " ", line) }
+    }
+    os.Exit(1)
 }
 
 func main() {
@@ -72,23 +259,101 @@ func main() {
         usage(args[0])
         return
     }
-    // Subcommands: tokens <file>, ast <file>; default: run <file>
+    // Subcommands: tokens <file>, ast <file>, run <file>, test <file>; default: run <file>
     if args[1] == "tokens" {
-        if len(args) < 3 {
+        fs := flag.NewFlagSet("tokens", flag.ContinueOnError)
+        fs.SetOutput(os.Stdout)
+        registerDiagnostics(fs)
+        positions := fs.Bool("positions", false, "include each token's line, column and byte offset")
+        positional, err := parseFlags(fs, args[2:])
+        if err != nil { os.Exit(2) }
+        if len(positional) < 1 {
             usage(args[0])
             return
         }
-        if err := printTokens(args[2]); err != nil { fmt.Fprintln(os.Stdout, "[Error]", err) }
+        if err := printTokens(positional[0], *positions); err != nil { fmt.Fprintln(diagnostics, "[Error]", err) }
         return
     }
     if args[1] == "ast" {
-        if len(args) < 3 {
+        var opts runOptions
+        fs := flag.NewFlagSet("ast", flag.ContinueOnError)
+        fs.SetOutput(os.Stdout)
+        opts.register(fs)
+        resolved := fs.Bool("resolved", false, "annotate identifiers with their binding kind and declaration")
+        positional, err := parseFlags(fs, args[2:])
+        if err != nil { os.Exit(2) }
+        if len(positional) < 1 {
+            usage(args[0])
+            return
+        }
+        if *resolved {
+            if _, err := opts.applyConfig(fs, ""); err != nil { exit(err) }
+        }
+        if err := printAST(positional[0], opts, *resolved); err != nil { printErrors(err) }
+        return
+    }
+    if args[1] == "check" {
+        var opts runOptions
+        fs := flag.NewFlagSet("check", flag.ContinueOnError)
+        fs.SetOutput(os.Stdout)
+        opts.register(fs)
+        lint := fs.Bool("lint", false, "also report unused bindings and shadowing")
+        positional, err := parseFlags(fs, args[2:])
+        if err != nil { os.Exit(2) }
+        if len(positional) < 1 {
             usage(args[0])
             return
         }
-        if err := printAST(args[2]); err != nil { fmt.Fprintln(os.Stdout, "[Error]", err) }
+        file, err := opts.applyConfig(fs, positional[0])
+        if err != nil { exit(err) }
+        if err := checkProgram(file, opts, *lint); err != nil { exit(err) }
         return
     }
-    // Default: run program
-    if err := runProgram(args[1]); err != nil { fmt.Fprintln(os.Stdout, "[Error]", err) }
+    if args[1] == "repl" {
+        var opts runOptions
+        fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+        fs.SetOutput(os.Stdout)
+        opts.register(fs)
+        if _, err := parseFlags(fs, args[2:]); err != nil { os.Exit(2) }
+        if _, err := opts.applyConfig(fs, ""); err != nil { exit(err) }
+        ev, err := opts.newEvaluator("")
+        if err != nil { exit(err) }
+        if err := repl.Run(ev, os.Stdin, os.Stdout, repl.DefaultHistoryPath()); err != nil { exit(err) }
+        return
+    }
+    if args[1] == "playground" {
+        fs := flag.NewFlagSet("playground", flag.ContinueOnError)
+        fs.SetOutput(os.Stdout)
+        port := fs.Int("port", 8080, "port to serve the playground on")
+        if err := fs.Parse(args[2:]); err != nil { os.Exit(2) }
+        addr := fmt.Sprintf(":%d", *port)
+        fmt.Fprintf(os.Stdout, "elf playground listening on http://localhost%s\n", addr)
+        if err := playground.ListenAndServe(addr); err != nil { exit(err) }
+        return
+    }
+    // Default: run program (`run <file>` or just `<file>`)
+    cmd, rest := "run", args[1:]
+    if args[1] == "run" || args[1] == "test" { cmd, rest = args[1], args[2:] }
+    var opts runOptions
+    fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+    fs.SetOutput(os.Stdout)
+    opts.register(fs)
+    positional, err := parseFlags(fs, rest)
+    if err != nil { os.Exit(2) }
+    if len(positional) < 1 {
+        usage(args[0])
+        return
+    }
+    file, err := opts.applyConfig(fs, positional[0])
+    if err != nil { exit(err) }
+    // the remaining arguments belong to the program, see args()
+    opts.args = positional[1:]
+    if cmd == "test" {
+        err = testProgram(file, opts)
+    } else {
+        err = runProgram(file, opts)
+    }
+    // coverage is reported even when a part or test failed
+    if cerr := opts.writeCoverage(); err == nil { err = cerr }
+    if err != nil { exit(err) }
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "time"
+
+    "elf-lang/impl/internal/config"
+    "elf-lang/impl/internal/coverage"
+    "elf-lang/impl/internal/evaluator"
+)
+
+// runOptions are the flags accepted by `run` and `test`; any flag left unset
+// falls back to the project config file.
+type runOptions struct {
+    stats      bool
+    configPath string
+    timeout    time.Duration
+    maxMemory  sizeFlag
+    engine     string
+    format     string
+    print      string
+    printMode  evaluator.PrintMode
+    output     string
+    prelude    listFlag
+    paths      listFlag
+    coverage   bool
+    parallel   bool
+    strictIndex bool
+    joinPuts   bool
+    quiet      bool
+    unsortedSets bool
+    warnRedeclared bool
+    autoMemo   bool
+    memoSize   int
+    seed       uint64
+    seeded     bool // --seed was given (0 is a valid seed)
+    profile    *coverage.Profile // set when coverage is enabled
+    args       []string          // program arguments, returned by args()
+}
+
+// diagnostics is where errors, stats and the coverage summary are written.
+// The conformance tests expect them on stdout alongside program output.
+var diagnostics io.Writer = os.Stdout
+
+func registerDiagnostics(fs *flag.FlagSet) {
+    fs.Func("diagnostics", "where errors and stats are written: stdout (the default) or stderr", func(s string) error {
+        switch s {
+        case "stdout": diagnostics = os.Stdout
+        case "stderr": diagnostics = os.Stderr
+        default: return fmt.Errorf("unknown diagnostics stream %q (stdout, stderr)", s)
+        }
+        return nil
+    })
+}
+
+func (o *runOptions) register(fs *flag.FlagSet) {
+    registerDiagnostics(fs)
+    fs.BoolVar(&o.quiet, "quiet", false, "do not print a program's final value, only what it prints with puts")
+    fs.BoolVar(&o.stats, "stats", false, "print wall time, allocation and evaluation counts per part")
+    fs.StringVar(&o.configPath, "config", "", "config file to use instead of discovering elf.toml/.elfrc")
+    fs.DurationVar(&o.timeout, "timeout", 0, "abort evaluation after this duration (e.g. 30s)")
+    fs.Var(&o.maxMemory, "max-memory", "abort evaluation once the live heap exceeds this size (e.g. 512MB)")
+    fs.StringVar(&o.engine, "engine", "", "evaluation engine (tree)")
+    fs.StringVar(&o.format, "format", "", "result output format (text, json)")
+    fs.StringVar(&o.print, "print", "", "how strings are printed: canonical, escaped (quotes escaped too) or raw (unquoted)")
+    fs.StringVar(&o.output, "output", "", "write the result (final value or part answers) to this file instead of stdout")
+    fs.Var(&o.prelude, "prelude", "module to import before the program (repeatable)")
+    fs.Var(&o.paths, "path", "directory to search for imports (repeatable)")
+    fs.BoolVar(&o.autoMemo, "auto-memo", false, "cache the results of function calls that have no effects (IO, randomness, mutable variables)")
+    fs.IntVar(&o.memoSize, "memo-size", 100000, "maximum number of results kept by --auto-memo, least recently used evicted first")
+    fs.Uint64Var(&o.seed, "seed", 0, "seed the random builtins (rand_int, shuffle) for reproducible runs")
+    fs.BoolVar(&o.coverage, "coverage", false, "record line coverage, written to coverage.lcov and coverage.html")
+    fs.BoolVar(&o.strictIndex, "strict-index", false, "fail on out-of-range list and string indexing instead of giving nil (get(i, coll) still gives nil)")
+    fs.BoolVar(&o.joinPuts, "join-puts", false, "print puts arguments separated by single spaces, with no trailing space")
+    fs.BoolVar(&o.warnRedeclared, "warn-redeclared", false, "only warn, rather than fail, when a let declares a name already declared in the same scope")
+    fs.BoolVar(&o.unsortedSets, "unsorted-sets", false, "print sets in the order their elements were added rather than ascending (see also sort_sets)")
+    fs.BoolVar(&o.parallel, "parallel", false, "evaluate part_one and part_two concurrently (--stats allocations then cover both)")
+}
+
+// applyConfig loads the project config and fills in every flag that was not
+// given explicitly on the command line. A directory target is a project: its
+// config is discovered from the directory rather than the working directory,
+// and the returned path is the project's entry file.
+func (o *runOptions) applyConfig(fs *flag.FlagSet, target string) (string, error) {
+    info, err := os.Stat(target)
+    isProject := err == nil && info.IsDir()
+    from := "."
+    if isProject { from = target }
+    var cfg config.Config
+    if o.configPath != "" {
+        cfg, err = config.Load(o.configPath)
+    } else {
+        cfg, err = config.Discover(from)
+    }
+    if err != nil { return "", err }
+    var roots []string
+    if isProject {
+        if target, roots, err = config.Project(target, cfg); err != nil { return "", err }
+    }
+    set := map[string]bool{}
+    fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+    if !set["timeout"] { o.timeout = cfg.Timeout }
+    if !set["max-memory"] { o.maxMemory = sizeFlag(cfg.MaxMemory) }
+    if !set["engine"] { o.engine = cfg.Engine }
+    if !set["format"] { o.format = cfg.Format }
+    if !set["prelude"] { o.prelude = cfg.Prelude }
+    if !set["path"] { o.paths = cfg.Paths }
+    o.paths = append(o.paths, roots...)
+    o.seeded = set["seed"]
+    if o.coverage { o.profile = coverage.New() }
+    if o.printMode, err = evaluator.ParsePrintMode(o.print); err != nil { return "", err }
+    resolved := config.Config{Engine: o.engine, Format: o.format}
+    return target, resolved.Validate()
+}
+
+// newEvaluator builds an evaluator for the program at path, configured by
+// the run options and with any prelude modules already imported.
+func (o *runOptions) newEvaluator(path string) (*evaluator.Evaluator, error) {
+    ev := evaluator.New(os.Stdout)
+    ev.SetFile(path)
+    ev.SetSearchPaths(o.paths)
+    ev.SetArgs(o.args)
+    if o.profile != nil { ev.SetTracer(o.profile.Trace) }
+    if o.seeded { ev.SetSeed(o.seed) }
+    if o.autoMemo { ev.SetAutoMemo(o.memoSize) }
+    ev.SetPrintMode(o.printMode)
+    ev.SetSortSets(!o.unsortedSets)
+    ev.SetStrictIndex(o.strictIndex)
+    ev.SetJoinPuts(o.joinPuts)
+    for _, mod := range o.prelude {
+        if err := ev.Import(mod); err != nil { return nil, err }
+    }
+    if o.stats { ev.EnableStats() }
+    ev.SetMemoryLimit(uint64(o.maxMemory))
+    return ev, nil
+}
+
+// evaluators returns a constructor of evaluators for the program at path,
+// each with its own timeout context; release cancels those contexts.
+func (o *runOptions) evaluators(path string) (newEv func() (*evaluator.Evaluator, error), release func()) {
+    var cancels []context.CancelFunc
+    newEv = func() (*evaluator.Evaluator, error) {
+        ev, err := o.newEvaluator(path)
+        if err != nil { return nil, err }
+        ctx, cancel := o.context()
+        cancels = append(cancels, cancel)
+        ev.SetContext(ctx)
+        return ev, nil
+    }
+    return newEv, func() { for _, cancel := range cancels { cancel() } }
+}
+
+// writeCoverage writes the LCOV and HTML coverage reports and prints a
+// summary, when coverage is enabled.
+func (o *runOptions) writeCoverage() error {
+    if o.profile == nil { return nil }
+    reports, err := o.profile.Report()
+    if err != nil { return err }
+    for name, write := range map[string]func(io.Writer, []coverage.FileReport) error{"coverage.lcov": coverage.WriteLCOV, "coverage.html": coverage.WriteHTML} {
+        f, err := os.Create(name)
+        if err != nil { return err }
+        err = write(f, reports)
+        if cerr := f.Close(); err == nil { err = cerr }
+        if err != nil { return err }
+    }
+    fmt.Fprintf(diagnostics, "%s (coverage.lcov, coverage.html)\n", coverage.Summary(reports))
+    return nil
+}
+
+// context returns the evaluation context, bounded by the timeout if set.
+func (o *runOptions) context() (context.Context, context.CancelFunc) {
+    if o.timeout > 0 { return context.WithTimeout(context.Background(), o.timeout) }
+    return context.Background(), func() {}
+}
+
+// sizeFlag is a byte size flag accepting units, e.g. 512MB.
+type sizeFlag uint64
+
+func (s *sizeFlag) String() string { return evaluator.FormatBytes(uint64(*s)) }
+func (s *sizeFlag) Set(v string) error {
+    n, err := config.ParseSize(v)
+    *s = sizeFlag(n)
+    return err
+}
+
+// listFlag is a repeatable string flag.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
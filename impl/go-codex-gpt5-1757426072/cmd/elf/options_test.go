@@ -0,0 +1,51 @@
+package main
+
+import (
+    "flag"
+    "io"
+    "os"
+    "path/filepath"
+    "regexp"
+    "testing"
+)
+
+// runWith runs src as `elf run <flags> main.elf` would, with an empty config
+// file so none is discovered, returning the error exit would report.
+func runWith(t *testing.T, src string, flags ...string) (string, error) {
+    t.Helper()
+    dir := t.TempDir()
+    path, cfg := filepath.Join(dir, "main.elf"), filepath.Join(dir, "elf.toml")
+    if err := os.WriteFile(path, []byte(src), 0o644); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(cfg, nil, 0o644); err != nil { t.Fatal(err) }
+    var opts runOptions
+    fs := flag.NewFlagSet("run", flag.ContinueOnError)
+    fs.SetOutput(io.Discard)
+    opts.register(fs)
+    if _, err := parseFlags(fs, append(flags, "--config", cfg, "--quiet", path)); err != nil { t.Fatal(err) }
+    file, err := opts.applyConfig(fs, path)
+    if err != nil { t.Fatal(err) }
+    return path, runProgram(file, opts)
+}
+
+func TestTimeout(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"let mut i = 0;\nwhile true { i = i + 1 }", `^Execution timed out at FILE:2:\d+$`},
+        {"let spin = |n| spin(n + 1);\nspin(0)", `^Execution timed out at FILE:1:\d+ in spin \(defined at 1:12\)$`},
+    }
+    for _, tt := range tests {
+        path, err := runWith(t, tt.src, "--timeout", "50ms")
+        if err == nil { t.Errorf("%s: no error", tt.src); continue }
+        want := regexp.MustCompile(regexp.MustCompile(`FILE`).ReplaceAllLiteralString(tt.want, regexp.QuoteMeta(path)))
+        if !want.MatchString(err.Error()) { t.Errorf("%s: got %q, want %s", tt.src, err, want) }
+    }
+    if _, err := runWith(t, "1 + 2", "--timeout", "10s"); err != nil { t.Errorf("a quick program timed out: %v", err) }
+}
+
+func TestMaxMemory(t *testing.T) {
+    // doubles a list until it no longer fits
+    path, err := runWith(t, "let grow = |xs| grow(xs + xs);\ngrow([1, 2, 3])", "--max-memory", "64MB")
+    if err == nil { t.Fatal("no error") }
+    want := regexp.MustCompile(`^Memory limit of 64\.0 MiB exceeded \(live heap \d+\.\d [KMG]iB\) at ` + regexp.QuoteMeta(path) + `:\d+:\d+ in grow \(defined at 1:12\)$`)
+    if !want.MatchString(err.Error()) { t.Errorf("got %q, want %s", err, want) }
+    if _, err := runWith(t, "[1, 2, 3] |> map(|x| x * 2)", "--max-memory", "512MB"); err != nil { t.Errorf("a small program ran out of memory: %v", err) }
+}
@@ -0,0 +1,43 @@
+package analysis
+
+import (
+    "elf-lang/impl/internal/crash"
+    "elf-lang/impl/internal/lexer"
+    "elf-lang/impl/internal/parser"
+)
+
+// Annotate resolves prog and returns a copy in which every identifier with
+// a known binding carries it: declarations describe themselves, references
+// point at the declaration they resolve to. Names only an import() could
+// have bound are reported as module bindings without a declaration.
+func Annotate(prog parser.Program, known []string) (out parser.Program, err error) {
+    defer crash.Recover("analysis", &err)
+    found := map[int]*parser.Binding{} // by identifier offset
+    describe := func(b *binding) *parser.Binding {
+        pb := &parser.Binding{Kind: b.kind.String()}
+        if b.kind != KindBuiltin && b.pos.Line > 0 {
+            pb.Declaration = &parser.Span{Start: position(b.pos), End: position(span(b.pos, b.name))}
+        }
+        return pb
+    }
+    ref := func(s *scope, id parser.Identifier, b *binding) {
+        switch {
+        case b != nil: found[id.Pos.Offset] = describe(b)
+        case s.isOpen(): found[id.Pos.Offset] = &parser.Binding{Kind: KindModule.String()}
+        }
+    }
+    w := &walker{
+        onDeclare: func(b *binding) {
+            if b.pos.Line > 0 { found[b.pos.Offset] = describe(b) }
+        },
+        onRef:    ref,
+        onAssign: ref,
+    }
+    w.program(prog, builtinScope(known))
+    return parser.MapIdentifiers(prog, func(id parser.Identifier) parser.Identifier {
+        if id.Pos.Line > 0 { id.Binding = found[id.Pos.Offset] }
+        return id
+    }), nil
+}
+
+func position(p lexer.Pos) parser.Position { return parser.Position{Line: p.Line, Column: p.Col} }
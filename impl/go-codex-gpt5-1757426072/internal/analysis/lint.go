@@ -0,0 +1,111 @@
+package analysis
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "elf-lang/impl/internal/crash"
+    "elf-lang/impl/internal/lexer"
+    "elf-lang/impl/internal/parser"
+)
+
+// Lint rule names, as shown after each diagnostic and accepted by
+// `// lint:ignore <rule>` comments.
+const (
+    RuleUnusedVariable  = "unused-variable"
+    RuleUnusedParameter = "unused-parameter"
+    RuleShadowing       = "shadowing"
+)
+
+// Diagnostic is a single finding, spanning Pos up to (not including) End.
+type Diagnostic struct {
+    Pos     lexer.Pos
+    End     lexer.Pos
+    Rule    string
+    Message string
+}
+
+func (d Diagnostic) String() string { return fmt.Sprintf("%s: %s [%s]", d.Pos, d.Message, d.Rule) }
+
+// Lint reports unused variables, unused parameters and bindings shadowing an
+// outer user binding. Names starting with `_` are exempt, and a finding is
+// suppressed by a `// lint:ignore [rule]` comment trailing the same line
+// or on the line before.
+func Lint(prog parser.Program) (diags []Diagnostic, err error) {
+    defer crash.Recover("analysis", &err)
+    report := func(b *binding, rule, msg string) {
+        diags = append(diags, Diagnostic{Pos: b.pos, End: span(b.pos, b.name), Rule: rule, Message: msg})
+    }
+    w := &walker{
+        onDeclare: func(b *binding) {
+            if exempt(b) || b.scope.parent == nil { return }
+            if outer := b.scope.parent.lookup(b.name); outer != nil && outer.kind != KindBuiltin {
+                report(b, RuleShadowing, fmt.Sprintf("%s '%s' shadows %s binding declared at %s", b.kind, b.name, outer.kind, outer.pos))
+            }
+        },
+        onClose: func(s *scope) {
+            for _, b := range s.order {
+                if b.used || exempt(b) { continue }
+                switch b.kind {
+                case KindParameter: report(b, RuleUnusedParameter, fmt.Sprintf("unused parameter '%s'", b.name))
+                case KindLocal: report(b, RuleUnusedVariable, fmt.Sprintf("unused variable '%s'", b.name))
+                }
+            }
+        },
+    }
+    w.program(prog, nil)
+    diags = suppress(diags, ignoreComments(prog.Statements))
+    return sortByPos(diags), nil
+}
+
+// sortByPos orders diagnostics by where they appear in the source, since
+// function bodies are walked after the code that follows them.
+func sortByPos(diags []Diagnostic) []Diagnostic {
+    sort.SliceStable(diags, func(i, j int) bool { return diags[i].Pos.Offset < diags[j].Pos.Offset })
+    return diags
+}
+
+// exempt reports whether a binding is excluded from linting: `_`-prefixed
+// names, and synthetic bindings without a source position.
+func exempt(b *binding) bool { return strings.HasPrefix(b.name, "_") || b.pos.Line == 0 }
+
+func span(pos lexer.Pos, name string) lexer.Pos {
+    return lexer.Pos{Offset: pos.Offset + len(name), Line: pos.Line, Col: pos.Col + len(name)}
+}
+
+// ignoreComments maps source lines to the rules ignored there ("" ignores all).
+// A trailing comment covers its own line, a comment on its own line the one
+// after it ends.
+func ignoreComments(stmts []parser.Statement) map[int][]string {
+    lines := map[int][]string{}
+    parser.Inspect(stmts, func(st parser.Statement) {
+        c, ok := st.(parser.CommentStmt)
+        if !ok { return }
+        text := strings.TrimPrefix(c.Value, "//")
+        if block, ok := strings.CutPrefix(c.Value, "/*"); ok { text = strings.TrimSuffix(block, "*/") }
+        rest, ok := strings.CutPrefix(strings.TrimSpace(text), "lint:ignore")
+        if !ok { return }
+        rules := strings.Fields(rest)
+        if len(rules) == 0 { rules = []string{""} }
+        line := c.Pos.Line
+        if !c.Trailing { line += strings.Count(c.Value, "\n") + 1 }
+        lines[line] = append(lines[line], rules...)
+    })
+    return lines
+}
+
+func suppress(diags []Diagnostic, ignored map[int][]string) []Diagnostic {
+    out := diags[:0]
+    for _, d := range diags {
+        if !ignoredAt(ignored[d.Pos.Line], d.Rule) { out = append(out, d) }
+    }
+    return out
+}
+
+func ignoredAt(rules []string, rule string) bool {
+    for _, r := range rules {
+        if r == "" || r == rule { return true }
+    }
+    return false
+}
@@ -0,0 +1,41 @@
+package analysis
+
+import (
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+func TestLint(t *testing.T) {
+    tests := []struct{ src string; want []string }{
+        // a clean program: everything used, shadowing only builtins
+        {"let size = |xs| fold(0, |n, _| n + 1, xs);\nlet total = [1, 2] |> map(|x| x * 2) |> sum;\nputs(size([total]))", nil},
+        {"let f = || {\n  let x = 1;\n  2\n};\nf()", []string{"2:7: unused variable 'x' [unused-variable]"}},
+        {"let f = |a, b| a;\nf(1, 2)", []string{"1:13: unused parameter 'b' [unused-parameter]"}},
+        {"let x = 1;\nlet f = |x| x;\nf(x)", []string{"2:10: parameter 'x' shadows module binding declared at 1:5 [shadowing]"}},
+        {"let n = 1;\nlet f = || {\n  let n = 2;\n  n\n};\nf() + n", []string{"3:7: local 'n' shadows module binding declared at 1:5 [shadowing]"}},
+        {"let f = |n| {\n  let g = |n| n;\n  g(n)\n};\nf(1)", []string{"2:12: parameter 'n' shadows parameter binding declared at 1:10 [shadowing]"}},
+        // diagnostics come in source order, though bodies are walked later
+        {"let f = |a| {\n  let b = 1;\n  0\n};\nlet g = || {\n  let c = 2;\n  f(1)\n};\ng()", []string{
+            "1:10: unused parameter 'a' [unused-parameter]",
+            "2:7: unused variable 'b' [unused-variable]",
+            "6:7: unused variable 'c' [unused-variable]",
+        }},
+        // exemptions and suppressions
+        {"let f = |_a| {\n  let _b = 1;\n  0\n};\nf(1)", nil},
+        {"let f = |a| 0; // lint:ignore unused-parameter\nf(1)", nil},
+        {"let f = |a| 0; // lint:ignore shadowing\nf(1)", []string{"1:10: unused parameter 'a' [unused-parameter]"}},
+        {"// lint:ignore\nlet f = |a| 0;\nf(1)", nil},
+        {"/* lint:ignore\n   unused-parameter */\nlet f = |a| 0;\nf(1)", nil},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        diags, err := Lint(prog)
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        var got []string
+        for _, d := range diags { got = append(got, d.String()) }
+        if strings.Join(got, "\n") != strings.Join(tt.want, "\n") { t.Errorf("%s: got\n%s\nwant\n%s", tt.src, strings.Join(got, "\n"), strings.Join(tt.want, "\n")) }
+    }
+}
@@ -0,0 +1,46 @@
+package analysis
+
+import (
+    "fmt"
+
+    "elf-lang/impl/internal/crash"
+    "elf-lang/impl/internal/parser"
+)
+
+// RuleUndefined marks a reference to a name with no binding in scope.
+const RuleUndefined = "undefined"
+
+// RuleRedeclared marks a let or parameter reusing a name already declared
+// in the same scope.
+const RuleRedeclared = "redeclared"
+
+// Resolve reports identifiers that cannot resolve to an enclosing binding or
+// to one of the known names (the builtins and anything predefined, such as
+// prelude imports). Names referenced after an import() in an enclosing scope
+// are assumed to come from the module. The messages match the evaluator's, so
+// a program failing here would have failed the same way at runtime.
+func Resolve(prog parser.Program, known []string) (diags []Diagnostic, err error) {
+    defer crash.Recover("analysis", &err)
+    undefined := func(s *scope, id parser.Identifier, b *binding) {
+        if b != nil || s.isOpen() { return }
+        diags = append(diags, Diagnostic{Pos: id.Pos, End: span(id.Pos, id.Name), Rule: RuleUndefined, Message: fmt.Sprintf("Identifier can not be found: %s", id.Name)})
+    }
+    w := &walker{onRef: undefined, onAssign: undefined}
+    w.program(prog, builtinScope(known))
+    return sortByPos(diags), nil
+}
+
+// Redeclared reports bindings declaring a name a second time in the same
+// scope, such as `let x = 1; let x = 2;`, which the evaluator would quietly
+// rebind. Declaring the name again in an inner scope shadows it and is
+// fine, as are `_`-prefixed names.
+func Redeclared(prog parser.Program) (diags []Diagnostic, err error) {
+    defer crash.Recover("analysis", &err)
+    w := &walker{onRedeclare: func(prev, b *binding) {
+        // prev may be synthetic, like the `input` a solution's runner binds
+        if exempt(b) || prev.pos.Line == 0 { return }
+        diags = append(diags, Diagnostic{Pos: b.pos, End: span(b.pos, b.name), Rule: RuleRedeclared, Message: fmt.Sprintf("Variable '%s' has already been declared", b.name)})
+    }}
+    w.program(prog, nil)
+    return sortByPos(diags), nil
+}
@@ -0,0 +1,206 @@
+package analysis
+
+import (
+    "elf-lang/impl/internal/lexer"
+    "elf-lang/impl/internal/parser"
+)
+
+// Kind classifies what introduced a binding.
+type Kind int
+
+const (
+    KindBuiltin Kind = iota
+    KindModule       // top-level program binding
+    KindLocal        // let inside a block or function body
+    KindParameter    // function parameter
+)
+
+func (k Kind) String() string {
+    switch k {
+    case KindBuiltin: return "builtin"
+    case KindModule: return "module"
+    case KindLocal: return "local"
+    default: return "parameter"
+    }
+}
+
+// binding is a declared name within a scope.
+type binding struct {
+    name  string
+    kind  Kind
+    pos   lexer.Pos
+    used  bool
+    scope *scope
+}
+
+// scope mirrors one runtime environment of the evaluator.
+type scope struct {
+    parent   *scope
+    names    map[string]*binding
+    order    []*binding // declaration order, for stable reporting
+    deferred []func()   // function bodies, analysed when the scope closes
+    open     bool       // an import() may have bound names not known statically
+}
+
+func newScope(parent *scope) *scope { return &scope{parent: parent, names: map[string]*binding{}} }
+
+func (s *scope) lookup(name string) *binding {
+    for cur := s; cur != nil; cur = cur.parent {
+        if b, ok := cur.names[name]; ok { return b }
+    }
+    return nil
+}
+
+// isOpen reports whether s or an enclosing scope has imported a module.
+func (s *scope) isOpen() bool {
+    for cur := s; cur != nil; cur = cur.parent {
+        if cur.open { return true }
+    }
+    return false
+}
+
+// walker traverses a program with the same scoping rules as the evaluator,
+// reporting declarations, references and closed scopes through its hooks.
+// Function bodies are walked when their enclosing scope closes, because a
+// closure sees every binding of its (live) defining scope by the time it can
+// be called - this is what lets mutually recursive functions resolve.
+type walker struct {
+    onDeclare func(b *binding)
+    onRedeclare func(prev, b *binding) // b declares prev's name again in the same scope
+    onRef     func(s *scope, id parser.Identifier, b *binding) // b is nil when unresolved
+    onAssign  func(s *scope, id parser.Identifier, b *binding)
+    onClose   func(s *scope)
+}
+
+// builtinScope returns a root scope declaring the given builtin names.
+func builtinScope(names []string) *scope {
+    s := newScope(nil)
+    for _, n := range names { s.names[n] = &binding{name: n, kind: KindBuiltin, used: true, scope: s} }
+    return s
+}
+
+func (w *walker) program(prog parser.Program, root *scope) {
+    global := newScope(root)
+    if hasInputSection(prog.Statements) {
+        // the runner binds `input` before any part runs, wherever it is declared
+        w.declare(global, parser.Identifier{Name: "input"}, KindModule).used = true
+    }
+    w.statements(prog.Statements, global, KindModule)
+    w.close(global)
+}
+
+func hasInputSection(stmts []parser.Statement) bool {
+    for _, st := range stmts {
+        if sec, ok := st.(parser.Section); ok {
+            if sec.Name == "input" || (sec.Name == "test" && hasInputSection(sec.Body.Statements)) { return true }
+        }
+    }
+    return false
+}
+
+func (w *walker) declare(s *scope, id parser.Identifier, kind Kind) *binding {
+    b := &binding{name: id.Name, kind: kind, pos: id.Pos, scope: s}
+    if prev, ok := s.names[id.Name]; ok && w.onRedeclare != nil { w.onRedeclare(prev, b) }
+    s.names[id.Name] = b
+    s.order = append(s.order, b)
+    if w.onDeclare != nil { w.onDeclare(b) }
+    return b
+}
+
+func (w *walker) close(s *scope) {
+    for len(s.deferred) > 0 {
+        fn := s.deferred[0]
+        s.deferred = s.deferred[1:]
+        fn()
+    }
+    if w.onClose != nil { w.onClose(s) }
+}
+
+func (w *walker) statements(stmts []parser.Statement, s *scope, kind Kind) {
+    for _, st := range stmts {
+        switch x := st.(type) {
+        case parser.ExpressionStmt:
+            w.expr(x.Value, s, kind)
+        case parser.Section:
+            w.block(x.Body, s)
+        }
+    }
+}
+
+func (w *walker) block(b parser.Block, parent *scope) {
+    s := newScope(parent)
+    w.statements(b.Statements, s, KindLocal)
+    w.close(s)
+}
+
+// expr walks an expression; kind is the binding kind a `let` creates here.
+func (w *walker) expr(e parser.Expr, s *scope, kind Kind) {
+    switch x := e.(type) {
+    case parser.Identifier:
+        b := s.lookup(x.Name)
+        if b != nil { b.used = true }
+        if w.onRef != nil { w.onRef(s, x, b) }
+    case parser.LetExpr:
+        // the value is evaluated before the name is bound
+        w.expr(x.Value, s, kind)
+        w.declare(s, x.Name, kind)
+    case parser.AssignExpr:
+        w.expr(x.Value, s, kind)
+        if w.onAssign != nil { w.onAssign(s, x.Name, s.lookup(x.Name.Name)) }
+    case parser.FunctionLit:
+        s.deferred = append(s.deferred, func() {
+            fs := newScope(s)
+            for _, p := range x.Parameters { w.declare(fs, p, KindParameter) }
+            w.block(x.Body, fs)
+            w.close(fs)
+        })
+    case parser.InfixExpr:
+        w.expr(x.Left, s, kind)
+        w.expr(x.Right, s, kind)
+    case parser.PrefixExpr:
+        w.expr(x.Operand, s, kind)
+    case parser.Spread:
+        w.expr(x.Value, s, kind)
+    case parser.ListLit:
+        for _, it := range x.Items { w.expr(it, s, kind) }
+    case parser.SetLit:
+        for _, it := range x.Items { w.expr(it, s, kind) }
+    case parser.DictLit:
+        for _, it := range x.Items {
+            w.expr(it.Key, s, kind)
+            w.expr(it.Value, s, kind)
+        }
+    case parser.IndexExpr:
+        w.expr(x.Left, s, kind)
+        w.expr(x.Index, s, kind)
+    case parser.IfExpr:
+        w.expr(x.Condition, s, kind)
+        w.block(x.Consequence, s)
+        if x.Alternative != nil { w.block(*x.Alternative, s) }
+    case parser.LoopExpr:
+        if x.Condition != nil { w.expr(x.Condition, s, kind) }
+        w.block(x.Body, s)
+    case parser.BreakExpr:
+        if x.Value != nil { w.expr(x.Value, s, kind) }
+    case parser.MatchExpr:
+        w.expr(x.Subject, s, kind)
+        for _, c := range x.Cases {
+            cs := newScope(s)
+            for _, id := range parser.PatternNames(c.Pattern) { w.declare(cs, id, KindLocal) }
+            w.block(c.Body, cs)
+            w.close(cs)
+        }
+    case parser.CallExpr:
+        w.expr(x.Function, s, kind)
+        for _, a := range x.Arguments { w.expr(a, s, kind) }
+        // import() copies a module's bindings into the calling scope
+        if id, ok := x.Function.(parser.Identifier); ok && id.Name == "import" {
+            if b := s.lookup(id.Name); b != nil && b.kind == KindBuiltin { s.open = true }
+        }
+    case parser.FunctionComposition:
+        for _, f := range x.Functions { w.expr(f, s, kind) }
+    case parser.FunctionThread:
+        w.expr(x.Initial, s, kind)
+        for _, f := range x.Functions { w.expr(f, s, kind) }
+    }
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+    "bufio"
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// FileNames are the config files looked for, in order, in each directory
+// from the working directory upwards.
+var FileNames = []string{"elf.toml", ".elfrc"}
+
+// Config holds project defaults; command-line flags take precedence.
+type Config struct {
+    Path    string        // file the config was read from ("" when none was found)
+    Entry   string        // program run when a project directory is given
+    Prelude []string      // modules imported before the program runs
+    Paths   []string      // import search paths
+    Timeout time.Duration // 0 means no timeout
+    MaxMemory uint64      // live heap limit in bytes, 0 means none
+    Engine  string        // evaluation engine; only "tree" is available
+    Format  string        // result output format: "text" or "json"
+}
+
+// Default returns the configuration used when no config file is found.
+func Default() Config { return Config{Engine: "tree", Format: "text"} }
+
+// EntryNames are the conventional entry files of a project directory without
+// an explicit `entry`.
+var EntryNames = []string{"main.santa", "main.elf"}
+
+// Project resolves a project directory to its entry file and import roots,
+// given the config that applies to it. An `entry` from a manifest inside the
+// directory wins, otherwise a conventional main file is used. The roots are
+// the manifest's directory and the project directory, searched after any
+// configured paths.
+func Project(dir string, cfg Config) (entry string, roots []string, err error) {
+    root, err := filepath.Abs(dir)
+    if err != nil { return "", nil, err }
+    if cfg.Path != "" && filepath.Dir(cfg.Path) != root { roots = append(roots, filepath.Dir(cfg.Path)) }
+    roots = append(roots, root)
+    if cfg.Entry != "" && cfg.Path != "" && filepath.Dir(cfg.Path) == root { return cfg.Entry, roots, nil }
+    for _, name := range EntryNames {
+        candidate := filepath.Join(root, name)
+        if info, err := os.Stat(candidate); err == nil && !info.IsDir() { return candidate, roots, nil }
+    }
+    return "", nil, fmt.Errorf("No entry file found in %s (set `entry` in elf.toml or add %s)", dir, strings.Join(EntryNames, "/"))
+}
+
+// Discover finds the nearest config file at or above dir and loads it.
+func Discover(dir string) (Config, error) {
+    dir, err := filepath.Abs(dir)
+    if err != nil { return Default(), err }
+    for {
+        for _, name := range FileNames {
+            path := filepath.Join(dir, name)
+            if info, err := os.Stat(path); err == nil && !info.IsDir() { return Load(path) }
+        }
+        parent := filepath.Dir(dir)
+        if parent == dir { return Default(), nil }
+        dir = parent
+    }
+}
+
+// Load reads a config file. Relative prelude and search paths are resolved
+// against the directory containing the file.
+func Load(path string) (Config, error) {
+    cfg := Default()
+    cfg.Path = path
+    f, err := os.Open(path)
+    if err != nil { return cfg, err }
+    defer f.Close()
+    values, err := parse(bufio.NewScanner(f))
+    if err != nil { return cfg, fmt.Errorf("%s: %v", path, err) }
+    base := filepath.Dir(path)
+    for key, v := range values {
+        switch key {
+        case "entry":
+            var s string
+            if s, err = str(v); err == nil { cfg.Entry = resolve(s, base) }
+        case "prelude":
+            cfg.Prelude, err = stringList(v, base)
+        case "paths":
+            cfg.Paths, err = stringList(v, base)
+        case "timeout":
+            var s string
+            if s, err = str(v); err == nil { cfg.Timeout, err = time.ParseDuration(s) }
+        case "max_memory":
+            var s string
+            if s, err = str(v); err == nil { cfg.MaxMemory, err = ParseSize(s) }
+        case "engine":
+            cfg.Engine, err = str(v)
+        case "format":
+            cfg.Format, err = str(v)
+        default:
+            err = fmt.Errorf("unknown key %q", key)
+        }
+        if err != nil { return cfg, fmt.Errorf("%s: %s: %v", path, key, err) }
+    }
+    return cfg, cfg.Validate()
+}
+
+// Validate checks that the engine and format are supported.
+func (c Config) Validate() error {
+    if c.Engine != "tree" { return fmt.Errorf("Unknown engine: %s (available: tree)", c.Engine) }
+    if c.Format != "text" && c.Format != "json" { return fmt.Errorf("Unknown output format: %s (available: text, json)", c.Format) }
+    return nil
+}
+
+// sizeUnits are the suffixes accepted by ParseSize; decimal and binary
+// spellings both mean powers of 1024, as in most memory settings.
+var sizeUnits = []struct {
+    suffix string
+    scale  uint64
+}{
+    {"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+    {"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+    {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+    {"B", 1},
+}
+
+// ParseSize parses a byte size such as "512MB", "1.5GiB" or "65536".
+func ParseSize(s string) (uint64, error) {
+    text := strings.ToUpper(strings.TrimSpace(s))
+    scale := uint64(1)
+    for _, u := range sizeUnits {
+        if strings.HasSuffix(text, u.suffix) {
+            text, scale = strings.TrimSpace(strings.TrimSuffix(text, u.suffix)), u.scale
+            break
+        }
+    }
+    n, err := strconv.ParseFloat(text, 64)
+    // !(n >= 0) rejects NaN too
+    if err != nil || !(n >= 0) { return 0, fmt.Errorf("invalid size %q (e.g. 512MB)", s) }
+    if n*float64(scale) >= math.MaxUint64 { return 0, fmt.Errorf("size %q is too large", s) }
+    return uint64(n * float64(scale)), nil
+}
+
+// parse reads the supported TOML subset: `key = value` lines where a value is
+// a string, integer, boolean or array of strings, plus `#` comments.
+func parse(sc *bufio.Scanner) (map[string]any, error) {
+    values := map[string]any{}
+    for line := 1; sc.Scan(); line++ {
+        text := strings.TrimSpace(stripComment(sc.Text()))
+        if text == "" { continue }
+        key, raw, ok := strings.Cut(text, "=")
+        if !ok { return nil, fmt.Errorf("line %d: expected key = value", line) }
+        key = strings.TrimSpace(key)
+        v, err := parseValue(strings.TrimSpace(raw))
+        if err != nil { return nil, fmt.Errorf("line %d: %v", line, err) }
+        values[key] = v
+    }
+    return values, sc.Err()
+}
+
+func parseValue(raw string) (any, error) {
+    switch {
+    case strings.HasPrefix(raw, "\""):
+        return strconv.Unquote(raw)
+    case strings.HasPrefix(raw, "["):
+        if !strings.HasSuffix(raw, "]") { return nil, fmt.Errorf("unterminated array") }
+        var items []string
+        for _, part := range strings.Split(raw[1:len(raw)-1], ",") {
+            part = strings.TrimSpace(part)
+            if part == "" { continue }
+            s, err := strconv.Unquote(part)
+            if err != nil { return nil, fmt.Errorf("array items must be strings") }
+            items = append(items, s)
+        }
+        return items, nil
+    case raw == "true" || raw == "false":
+        return raw == "true", nil
+    default:
+        n, err := strconv.ParseInt(raw, 10, 64)
+        if err != nil { return nil, fmt.Errorf("invalid value %s", raw) }
+        return n, nil
+    }
+}
+
+// stripComment removes a trailing `#` comment that is not inside a string.
+func stripComment(line string) string {
+    inStr := false
+    for i := 0; i < len(line); i++ {
+        switch line[i] {
+        case '\\':
+            if inStr { i++ }
+        case '"':
+            inStr = !inStr
+        case '#':
+            if !inStr { return line[:i] }
+        }
+    }
+    return line
+}
+
+func str(v any) (string, error) {
+    s, ok := v.(string)
+    if !ok { return "", fmt.Errorf("expected a string") }
+    return s, nil
+}
+
+func stringList(v any, base string) ([]string, error) {
+    items, ok := v.([]string)
+    if !ok { return nil, fmt.Errorf("expected an array of strings") }
+    out := make([]string, len(items))
+    for i, it := range items { out[i] = resolve(it, base) }
+    return out, nil
+}
+
+func resolve(path, base string) string {
+    if filepath.IsAbs(path) { return path }
+    return filepath.Join(base, path)
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestParseSize(t *testing.T) {
+    tests := []struct{ in string; want uint64; err string }{
+        {"65536", 65536, ""},
+        {"512B", 512, ""},
+        {"1K", 1 << 10, ""},
+        {"1kb", 1 << 10, ""},
+        {"1KiB", 1 << 10, ""},
+        {"512MB", 512 << 20, ""},
+        {" 2 mib ", 2 << 20, ""},
+        {"1.5GiB", 3 << 29, ""},
+        {"2G", 2 << 30, ""},
+        {"0", 0, ""},
+        {"", 0, `invalid size "" (e.g. 512MB)`},
+        {"MB", 0, `invalid size "MB" (e.g. 512MB)`},
+        {"12TB", 0, `invalid size "12TB" (e.g. 512MB)`},
+        {"-1MB", 0, `invalid size "-1MB" (e.g. 512MB)`},
+        {"lots", 0, `invalid size "lots" (e.g. 512MB)`},
+        {"NaN", 0, `invalid size "NaN" (e.g. 512MB)`},
+        {"Inf", 0, `size "Inf" is too large`},
+        {"18446744073709551616", 0, `size "18446744073709551616" is too large`},
+        {"100000000000GB", 0, `size "100000000000GB" is too large`},
+    }
+    for _, tt := range tests {
+        got, err := ParseSize(tt.in)
+        if tt.err != "" {
+            if err == nil || err.Error() != tt.err { t.Errorf("%q: got %d, %v, want error %s", tt.in, got, err, tt.err) }
+            continue
+        }
+        if err != nil || got != tt.want { t.Errorf("%q: got %d, %v, want %d", tt.in, got, err, tt.want) }
+    }
+}
+
+func TestLoad(t *testing.T) {
+    dir := t.TempDir()
+    tests := []struct{ src string; want Config; err string }{
+        {"", Default(), ""},
+        {`# comments and blank lines are skipped
+
+entry = "main.santa" # trailing comment
+prelude = ["lib/a.elf", "/abs/b.elf", ]
+paths = []
+timeout = "1m30s"
+max_memory = "256MB"
+engine = "tree"
+format = "json"`, Config{
+            Entry: filepath.Join(dir, "main.santa"), Prelude: []string{filepath.Join(dir, "lib/a.elf"), "/abs/b.elf"}, Paths: []string{},
+            Timeout: 90 * time.Second, MaxMemory: 256 << 20, Engine: "tree", Format: "json",
+        }, ""},
+        {`entry = "a # b.elf"`, Config{Entry: filepath.Join(dir, "a # b.elf"), Engine: "tree", Format: "text"}, ""},
+        {`entry = "a \" # b.elf"`, Config{Entry: filepath.Join(dir, `a " # b.elf`), Engine: "tree", Format: "text"}, ""},
+        {"entry", Config{}, "line 1: expected key = value"},
+        {"\n\nentry = main.santa", Config{}, "line 3: invalid value main.santa"},
+        {`entry = "main.santa`, Config{}, "line 1: invalid syntax"},
+        {`paths = ["a"`, Config{}, "line 1: unterminated array"},
+        {`paths = ["a", 1]`, Config{}, "line 1: array items must be strings"},
+        {"entry = 1", Config{}, "entry: expected a string"},
+        {`prelude = "a.elf"`, Config{}, "prelude: expected an array of strings"},
+        {"timeout = true", Config{}, "timeout: expected a string"},
+        {`timeout = "soon"`, Config{}, `timeout: time: invalid duration "soon"`},
+        {`max_memory = "1TB"`, Config{}, `max_memory: invalid size "1TB" (e.g. 512MB)`},
+        {`max_memory = "99999999999GB"`, Config{}, `max_memory: size "99999999999GB" is too large`},
+        {`colour = "red"`, Config{}, `colour: unknown key "colour"`},
+        {`engine = "vm"`, Config{}, "Unknown engine: vm (available: tree)"},
+        {`format = "xml"`, Config{}, "Unknown output format: xml (available: text, json)"},
+    }
+    for _, tt := range tests {
+        path := filepath.Join(dir, "elf.toml")
+        if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil { t.Fatal(err) }
+        got, err := Load(path)
+        if tt.err != "" {
+            want := tt.err
+            if want[0] != 'U' { want = path + ": " + want }
+            if err == nil || err.Error() != want { t.Errorf("%q: got error %v, want %s", tt.src, err, want) }
+            continue
+        }
+        if err != nil { t.Errorf("%q: %v", tt.src, err); continue }
+        tt.want.Path = path
+        if !reflect.DeepEqual(got, tt.want) { t.Errorf("%q: got %+v, want %+v", tt.src, got, tt.want) }
+    }
+}
+
+func TestDiscover(t *testing.T) {
+    root := t.TempDir()
+    nested := filepath.Join(root, "a", "b")
+    if err := os.MkdirAll(nested, 0o755); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(root, ".elfrc"), []byte(`format = "json"`), 0o644); err != nil { t.Fatal(err) }
+    cfg, err := Discover(nested)
+    if err != nil || cfg.Path != filepath.Join(root, ".elfrc") || cfg.Format != "json" { t.Errorf("got %+v, %v, want the root .elfrc", cfg, err) }
+    // elf.toml comes first in a directory, and the nearest directory wins
+    if err := os.WriteFile(filepath.Join(nested, "elf.toml"), nil, 0o644); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(nested, ".elfrc"), []byte(`format = "json"`), 0o644); err != nil { t.Fatal(err) }
+    cfg, err = Discover(nested)
+    if err != nil || cfg.Path != filepath.Join(nested, "elf.toml") || cfg.Format != "text" { t.Errorf("got %+v, %v, want the nested elf.toml", cfg, err) }
+}
@@ -0,0 +1,146 @@
+package coverage
+
+import (
+    "fmt"
+    "html"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+
+    "elf-lang/impl/internal/lexer"
+    "elf-lang/impl/internal/parser"
+)
+
+// Profile counts how many times each source line started a statement. It is
+// safe for concurrent use, so parts run in parallel can share one profile.
+type Profile struct {
+    mu   sync.Mutex
+    hits map[string]map[int]int // file -> line -> hits
+}
+
+func New() *Profile { return &Profile{hits: map[string]map[int]int{}} }
+
+// Trace records a statement execution; it has the evaluator.Tracer signature.
+func (p *Profile) Trace(file string, pos lexer.Pos) {
+    if file == "" || pos.Line == 0 { return }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    lines, ok := p.hits[file]
+    if !ok {
+        lines = map[int]int{}
+        p.hits[file] = lines
+    }
+    lines[pos.Line]++
+}
+
+// FileReport is the coverage of a single source file.
+type FileReport struct {
+    Path   string
+    Source []string    // source lines, for rendering
+    Hits   map[int]int // hit count of every executable line
+}
+
+// Covered returns the number of executable lines that ran at least once and
+// the number of executable lines.
+func (f FileReport) Covered() (hit, total int) {
+    for _, n := range f.Hits {
+        if n > 0 { hit++ }
+    }
+    return hit, len(f.Hits)
+}
+
+// Report combines the recorded hits with the executable lines of every
+// traced file (the lines starting a statement), sorted by path.
+func (p *Profile) Report() ([]FileReport, error) {
+    files := make([]string, 0, len(p.hits))
+    for f := range p.hits { files = append(files, f) }
+    sort.Strings(files)
+    reports := make([]FileReport, 0, len(files))
+    for _, path := range files {
+        data, err := os.ReadFile(path)
+        if err != nil { return nil, err }
+        prog, err := parser.Parse(string(data))
+        if err != nil { return nil, err }
+        hits := map[int]int{}
+        parser.Inspect(prog.Statements, func(st parser.Statement) {
+            if es, ok := st.(parser.ExpressionStmt); ok && es.Pos.Line > 0 { hits[es.Pos.Line] = p.hits[path][es.Pos.Line] }
+        })
+        reports = append(reports, FileReport{Path: path, Source: strings.Split(string(data), "\n"), Hits: hits})
+    }
+    return reports, nil
+}
+
+// Summary formats the overall line coverage of the reports.
+func Summary(reports []FileReport) string {
+    hit, total := 0, 0
+    for _, r := range reports {
+        h, t := r.Covered()
+        hit, total = hit+h, total+t
+    }
+    pct := 100.0
+    if total > 0 { pct = float64(hit) * 100 / float64(total) }
+    return fmt.Sprintf("Coverage: %.1f%% of lines (%d/%d)", pct, hit, total)
+}
+
+// WriteLCOV writes the reports in the LCOV tracefile format.
+func WriteLCOV(w io.Writer, reports []FileReport) error {
+    for _, r := range reports {
+        fmt.Fprintf(w, "SF:%s\n", r.Path)
+        for _, line := range sortedLines(r.Hits) { fmt.Fprintf(w, "DA:%d,%d\n", line, r.Hits[line]) }
+        hit, total := r.Covered()
+        if _, err := fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", total, hit); err != nil { return err }
+    }
+    return nil
+}
+
+// WriteHTML writes a standalone page listing each file with its executable
+// lines marked as covered or missed alongside their hit counts.
+func WriteHTML(w io.Writer, reports []FileReport) error {
+    var b strings.Builder
+    b.WriteString(htmlHead)
+    fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(Summary(reports)))
+    for _, r := range reports {
+        hit, total := r.Covered()
+        fmt.Fprintf(&b, "<h2>%s <small>%d/%d lines</small></h2>\n<table>\n", html.EscapeString(r.Path), hit, total)
+        for i, src := range r.Source {
+            line := i + 1
+            class, count := "", ""
+            if n, ok := r.Hits[line]; ok {
+                class, count = "miss", "0"
+                if n > 0 { class, count = "hit", fmt.Sprint(n) }
+            }
+            fmt.Fprintf(&b, "<tr class=%q><td class=\"n\">%d</td><td class=\"n\">%s</td><td><pre>%s</pre></td></tr>\n", class, line, count, html.EscapeString(src))
+        }
+        b.WriteString("</table>\n")
+    }
+    b.WriteString("</body>\n</html>\n")
+    _, err := io.WriteString(w, b.String())
+    return err
+}
+
+func sortedLines(hits map[int]int) []int {
+    lines := make([]int, 0, len(hits))
+    for l := range hits { lines = append(lines, l) }
+    sort.Ints(lines)
+    return lines
+}
+
+const htmlHead = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>elf-lang coverage</title>
+<style>
+  body { font-family: sans-serif; margin: 2rem; }
+  table { border-collapse: collapse; font-size: 0.9rem; }
+  td { padding: 0 0.5rem; vertical-align: top; }
+  td.n { text-align: right; color: #777; }
+  pre { margin: 0; }
+  tr.hit { background: #e6ffed; }
+  tr.miss { background: #ffeef0; }
+</style>
+</head>
+<body>
+`
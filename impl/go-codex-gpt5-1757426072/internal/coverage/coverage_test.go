@@ -0,0 +1,49 @@
+package coverage
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/evaluator"
+    "elf-lang/impl/internal/parser"
+)
+
+const program = `let check = |n| {
+  if n > 10 {
+    puts("big");
+    "big"
+  } else {
+    "small"
+  }
+};
+check(1);
+check(2)`
+
+func TestReport(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "main.elf")
+    if err := os.WriteFile(path, []byte(program), 0o644); err != nil { t.Fatal(err) }
+    prog, err := parser.Parse(program)
+    if err != nil { t.Fatal(err) }
+    p := New()
+    ev := evaluator.New(io.Discard)
+    ev.SetFile(path)
+    ev.SetTracer(p.Trace)
+    if _, err := ev.Eval(prog); err != nil { t.Fatal(err) }
+
+    reports, err := p.Report()
+    if err != nil { t.Fatal(err) }
+    if len(reports) != 1 || reports[0].Path != path { t.Fatalf("got %+v, want a report for %s", reports, path) }
+    // the branch never taken, lines 3 and 4, is missed
+    want := map[int]int{1: 1, 2: 2, 3: 0, 4: 0, 6: 2, 9: 1, 10: 1}
+    if got := reports[0].Hits; !reflect.DeepEqual(got, want) { t.Errorf("got hits %v, want %v", got, want) }
+    if got := Summary(reports); got != "Coverage: 71.4% of lines (5/7)" { t.Errorf("got %q", got) }
+
+    var lcov strings.Builder
+    if err := WriteLCOV(&lcov, reports); err != nil { t.Fatal(err) }
+    wantLCOV := "SF:" + path + "\nDA:1,1\nDA:2,2\nDA:3,0\nDA:4,0\nDA:6,2\nDA:9,1\nDA:10,1\nLF:7\nLH:5\nend_of_record\n"
+    if lcov.String() != wantLCOV { t.Errorf("got LCOV\n%s\nwant\n%s", lcov.String(), wantLCOV) }
+}
@@ -0,0 +1,36 @@
+package crash
+
+import (
+    "fmt"
+    "os"
+    "runtime/debug"
+)
+
+// IssuesURL is where internal errors should be reported.
+const IssuesURL = "https://github.com/eddmann/santa-lang-workshop/issues"
+
+// InternalError is a Go panic caught at a pipeline entry point: a bug in
+// the interpreter rather than in the program being run.
+type InternalError struct {
+    Stage string // "lexing", "parsing" or "evaluation"
+    Value any    // the recovered panic value
+    Stack []byte
+}
+
+func (e *InternalError) Error() string {
+    return fmt.Sprintf("Internal error during %s: %v (this is a bug in elf, please report it with the program that caused it at %s)", e.Stage, e.Value, IssuesURL)
+}
+
+// Recover converts a panic in progress into an InternalError stored in
+// *err. It must be deferred directly:
+//
+//     defer crash.Recover("evaluation", &err)
+//
+// Setting ELF_TRACEBACK=1 prints the Go stack trace to stderr as well.
+func Recover(stage string, err *error) {
+    r := recover()
+    if r == nil { return }
+    ie := &InternalError{Stage: stage, Value: r, Stack: debug.Stack()}
+    if os.Getenv("ELF_TRACEBACK") != "" { os.Stderr.Write(ie.Stack) }
+    *err = ie
+}
@@ -0,0 +1,99 @@
+package evaluator
+
+import (
+    "io"
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+func TestCallErrors(t *testing.T) {
+    tests := []struct{ src, want, at string }{
+        {"let x = 1;\nx(2)", "Expected a Function, found: Integer", "2:1-2:2 in x(2)"},
+        {"[puts, 1][1](  2,\n  3\n)", "Expected a Function, found: Integer", "1:1-1:13 in [puts, 1][1](2, 3)"},
+        {"push(1, [2], 3)", "Expected 2 arguments to push, found: 3", "1:1-1:5 in push(1, [2], 3)"},
+        {"let p = push(1);\np([2], 3)", "Expected 2 arguments to push, found: 3", "2:1-2:2 in p([2], 3)"},
+        {"[2] |> push(1, 2)", "Expected 2 arguments to push, found: 3, counting the threaded value", "1:8-1:12 in push(1, 2)"},
+        {"bindings(true, 1)", "Expected 0 to 1 arguments to bindings, found: 2", "1:1-1:9 in bindings(true, 1)"},
+        {"size([1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19], 1)", "Expected 1 argument to size, found: 2", "1:1-1:5 in size(...)"},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        _, err = New(io.Discard).Eval(prog)
+        if err == nil || err.Error() != tt.want { t.Errorf("%s: got %v, want %s", tt.src, err, tt.want); continue }
+        if at := Where(err); at != tt.at { t.Errorf("%s: got at %s, want %s", tt.src, at, tt.at) }
+    }
+}
+
+func TestRuntimeErrorLocation(t *testing.T) {
+    tests := []struct{ src, want, at string }{
+        {"let x = 1;\nlet y = x + \"a\" + [2];", "Unsupported operation: String + List", "2:17"},
+        {"1 + (2 - \"a\")", "Unsupported operation: Integer - String", "1:8"},
+        {"let f = |n| {\n  n / 0\n};\n[1] |> map(f)", "Division by zero", "2:5"},
+        {"[1, 2]\n  |> first\n  |> size\n  |> fold(0, 1)", "Unexpected argument: fold(Integer, Integer, Integer)", "4:6"},
+        {"let x = 1;\nx = 2", "Variable 'x' is not mutable", "2:1"},
+        {"if [] > 1 { 1 } else { 2 }", "Unsupported operation: List > Integer", "1:7"},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        _, err = New(io.Discard).Eval(prog)
+        if err == nil || err.Error() != tt.want { t.Errorf("%s: got %v, want %s", tt.src, err, tt.want); continue }
+        if at := Where(err); at != tt.at { t.Errorf("%s: got at %s, want %s", tt.src, at, tt.at) }
+    }
+}
+
+func TestTrace(t *testing.T) {
+    tests := []struct{ src string; want []string }{
+        {"let f = |x| x / 0;\nlet g = |xs| xs |> map(f);\nlet h = || g([1]);\nh()", []string{
+            "at 1:15", "in f, called at 2:20", "in g, called at 3:12", "in h, called at 4:1",
+        }},
+        {"[1] |> map(|x| x(1))", []string{"at 1:16-1:17 in x(1)", "in an anonymous function, called at 1:8"}},
+        {"let f = |n| if n == 0 { 1 / 0 } else { f(n - 1) };\nf(30)", []string{
+            "at 1:27",
+            "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40",
+            "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40",
+            "... 11 more calls",
+            "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40",
+            "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40", "in f, called at 1:40", "in f, called at 2:1",
+        }},
+        {"1 / 0", []string{"at 1:3"}},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        _, err = New(io.Discard).Eval(prog)
+        if err == nil { t.Errorf("%s: no error", tt.src); continue }
+        if got := strings.Join(Trace(err), "\n"); got != strings.Join(tt.want, "\n") { t.Errorf("%s: got\n%s\nwant\n%s", tt.src, got, strings.Join(tt.want, "\n")) }
+    }
+}
+
+func TestOptionalArguments(t *testing.T) {
+    // opt(a, b, [c]) lists the arguments it was called with
+    opt := newVariadicBuiltin("opt", 2, 3, func(_ *Evaluator, args []Value) (Value, error) { return List{Items: args}, nil })
+    tests := []struct{ src, want string }{
+        {"opt(1, 2)", "[1, 2]"},
+        {"opt(1, 2, 3)", "[1, 2, 3]"},
+        {"opt(1)", "|...| { [builtin] }"},
+        {"opt(1)(2)", "[1, 2]"},
+        {"opt(1)(2, 3)", "[1, 2, 3]"},
+        {"opt()(1)(2)", "[1, 2]"},
+        {"3 |> opt(1)", "[1, 3]"},
+        {"3 |> opt(1, 2)", "[1, 2, 3]"},
+        {"opt(1, 2, 3, 4)", "Expected 2 to 3 arguments to opt, found: 4"},
+        {"opt(1)(2, 3, 4)", "Expected 2 to 3 arguments to opt, found: 4"},
+        {"[opt(1)] |> map(|f| f(2, 3, 4))", "Expected 2 to 3 arguments to opt, found: 4"},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        ev := New(io.Discard)
+        ev.Define("opt", opt)
+        v, err := ev.Eval(prog)
+        got := ""
+        if err != nil { got = err.Error() } else { got = Format(v) }
+        if got != tt.want { t.Errorf("%s: got %s, want %s", tt.src, got, tt.want) }
+    }
+}
@@ -0,0 +1,67 @@
+package evaluator
+
+import (
+    "errors"
+    "fmt"
+
+    "elf-lang/impl/internal/lexer"
+)
+
+// call is a user function call in progress, kept on the evaluator's call
+// stack so an error can say how evaluation got to where it arose.
+type call struct {
+    fn   *userFunc
+    at   lexer.Pos // the call, or the builtin call that made it
+    file string    // the file the call is in
+}
+
+// Frame is one call in an error's stack trace.
+type Frame struct {
+    Function string // the function's name, or "an anonymous function"
+    Site     string // where it was called, "" when unknown
+}
+
+func (f Frame) String() string {
+    if f.Site == "" { return "in " + f.Function }
+    return fmt.Sprintf("in %s, called at %s", f.Function, f.Site)
+}
+
+// stack describes the calls in progress, innermost first.
+func (ev *Evaluator) stack() []Frame {
+    if len(ev.calls) == 0 { return nil }
+    out := make([]Frame, len(ev.calls))
+    for i, c := range ev.calls {
+        fr := Frame{Function: c.fn.describe()}
+        if c.at.Line > 0 { fr.Site = site(c.file, c.at) }
+        out[len(out)-1-i] = fr
+    }
+    return out
+}
+
+// Stack returns the calls in progress when err arose, innermost first.
+func Stack(err error) []Frame {
+    var ce *CallError
+    if errors.As(err, &ce) { return ce.Stack }
+    var re *RuntimeError
+    if errors.As(err, &re) { return re.Stack }
+    return nil
+}
+
+// maxTraceFrames bounds the frames Trace lists; deep recursion shows the
+// innermost and outermost calls around a count of those left out.
+const maxTraceFrames = 20
+
+// Trace describes where err arose, a line each: the expression or call,
+// then the function calls in progress from the innermost out.
+func Trace(err error) []string {
+    var lines []string
+    if at := Where(err); at != "" { lines = append(lines, "at "+at) }
+    frames := Stack(err)
+    skipped := len(frames) - maxTraceFrames
+    for i, f := range frames {
+        if skipped > 0 && i == maxTraceFrames/2 { lines = append(lines, fmt.Sprintf("... %d more calls", skipped)) }
+        if skipped > 0 && i >= maxTraceFrames/2 && i < maxTraceFrames/2+skipped { continue }
+        lines = append(lines, f.String())
+    }
+    return lines
+}
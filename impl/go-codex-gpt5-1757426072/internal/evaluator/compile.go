@@ -0,0 +1,840 @@
+package evaluator
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "math/big"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+
+    "elf-lang/impl/internal/lexer"
+    "elf-lang/impl/internal/parser"
+)
+
+// code is a compiled node: a closure evaluating it in the evaluator's
+// current scope. Programs are compiled once, after resolution, so running
+// them no longer switches on the node type at every visit.
+type code func(ev *Evaluator) (Value, error)
+
+// compileProgram compiles the top-level expression statements; comments and
+// sections produce no value (sections run on demand via EvalBlock).
+func compileProgram(prog parser.Program) []code {
+    var out []code
+    for _, st := range prog.Statements {
+        if s, ok := st.(parser.ExpressionStmt); ok { out = append(out, compileStmt(s)) }
+    }
+    return out
+}
+
+func compileStmt(st parser.Statement) code {
+    s, ok := st.(parser.ExpressionStmt)
+    if !ok { return constant(Nil{}) }
+    pos, value := s.Pos, compileExpr(s.Value)
+    return func(ev *Evaluator) (Value, error) {
+        ev.pos = pos
+        if ev.tracer != nil { ev.tracer(ev.file, pos) }
+        return value(ev)
+    }
+}
+
+// compileBlock compiles a block evaluated in a fresh child scope, or in the
+// enclosing scope when the resolver found it binds nothing.
+func compileBlock(b parser.Block) code {
+    stmts := make([]code, len(b.Statements))
+    for i, st := range b.Statements { stmts[i] = compileStmt(st) }
+    run := func(ev *Evaluator) (Value, error) {
+        var last Value = Nil{}
+        for _, run := range stmts {
+            v, err := run(ev)
+            if err != nil { return nil, err }
+            last = v
+        }
+        return last, nil
+    }
+    if b.Names == nil { return run }
+    names := b.Names
+    return func(ev *Evaluator) (Value, error) {
+        outer := ev.env
+        ev.env = newScopeEnv(outer, names)
+        defer func() { ev.env = outer }()
+        return run(ev)
+    }
+}
+
+func compileExprs(es []parser.Expr) []code {
+    out := make([]code, len(es))
+    for i, e := range es { out[i] = compileExpr(e) }
+    return out
+}
+
+// compileExpr compiles e, wrapped to count the evaluation and check the
+// run's limits first, and to locate an error arising in e at e.
+func compileExpr(e parser.Expr) code {
+    run, pos := compileNode(e), parser.PosOf(e)
+    return func(ev *Evaluator) (Value, error) {
+        if ev.stats != nil || ev.ctx != nil || ev.memLimit > 0 {
+            if err := ev.step(); err != nil { return nil, err }
+        }
+        v, err := run(ev)
+        if err != nil { return nil, ev.locate(err, pos) }
+        return v, nil
+    }
+}
+
+// step accounts for one evaluation: stats, cancellation and the memory limit.
+func (ev *Evaluator) step() error {
+    if ev.stats != nil { ev.stats.countEval() }
+    if ev.ctx != nil {
+        ev.steps++
+        if ev.steps%cancelCheckInterval == 0 {
+            if err := ev.ctx.Err(); err != nil { return ev.cancelled(err) }
+        }
+    }
+    if ev.memLimit > 0 && sampledHeap.Load() > ev.memLimit { return ev.checkMemory() }
+    return nil
+}
+
+func constant(v Value) code { return func(*Evaluator) (Value, error) { return v, nil } }
+
+func evalAll(ev *Evaluator, cs []code) ([]Value, error) {
+    vals := make([]Value, len(cs))
+    for i, c := range cs {
+        v, err := c(ev)
+        if err != nil { return nil, err }
+        vals[i] = v
+    }
+    return vals, nil
+}
+
+// itemsCode is compiled list items or call arguments, giving their values.
+type itemsCode func(ev *Evaluator) ([]Value, error)
+
+// compileItems compiles list items or call arguments, a spread among them
+// giving the items of any iterable in its place.
+func compileItems(es []parser.Expr) itemsCode {
+    cs, spread := make([]code, len(es)), make([]bool, len(es))
+    spreads := false
+    for i, e := range es {
+        if s, ok := e.(parser.Spread); ok { e, spread[i], spreads = s.Value, true, true }
+        cs[i] = compileExpr(e)
+    }
+    if !spreads { return func(ev *Evaluator) ([]Value, error) { return evalAll(ev, cs) } }
+    return func(ev *Evaluator) ([]Value, error) {
+        vals := make([]Value, 0, len(cs))
+        for i, c := range cs {
+            v, err := c(ev)
+            if err != nil { return nil, err }
+            if !spread[i] {
+                vals = append(vals, v)
+                continue
+            }
+            if l, ok := v.(List); ok {
+                vals = append(vals, l.Items...)
+                continue
+            }
+            next, ok := open(v)
+            if !ok { return nil, fmt.Errorf("Unable to spread %s", typeName(v)) }
+            if err := each(ev, next, func(x Value) (bool, error) { vals = append(vals, x); return true, nil }); err != nil { return nil, err }
+        }
+        return vals, nil
+    }
+}
+
+func asFunction(v Value) (Function, error) {
+    f, ok := v.(Function)
+    if !ok { return nil, fmt.Errorf("Expected a Function, found: %s", typeName(v)) }
+    return f, nil
+}
+
+// callSite locates a call for errors about the callee: not a function, or
+// given more arguments than a builtin accepts.
+type callSite struct {
+    start, end lexer.Pos // the callee
+    source     string    // the call as written
+}
+
+func siteOf(ex parser.CallExpr) callSite { return callSite{ex.Pos, ex.CalleeEnd, ex.Source} }
+
+// callee is asFunction on the value called at site.
+func (ev *Evaluator) callee(site callSite, v Value) (Function, error) {
+    f, err := asFunction(v)
+    if err != nil { return nil, ev.atCall(site, err) }
+    return f, nil
+}
+
+// checkArgs fails when f is a builtin accepting fewer than n arguments;
+// threaded says the last of them is a threaded value.
+func (ev *Evaluator) checkArgs(site callSite, f Function, n int, threaded bool) error {
+    b, ok := f.(*builtin)
+    if !ok { return nil }
+    err := b.checkArgs(n)
+    if err == nil { return nil }
+    if threaded { err = fmt.Errorf("%w, counting the threaded value", err) }
+    return ev.atCall(site, err)
+}
+
+func (ev *Evaluator) atCall(site callSite, err error) error {
+    if site.start.Line == 0 { return err }
+    return &CallError{Err: err, Site: fmt.Sprintf("%s-%s in %s", ev.at(site.start), site.end, site.describe()), Stack: ev.stack()}
+}
+
+// CallError is an error about the callee of a call. Its message is the
+// plain error, which the conformance tests match exactly; Site says where
+// the call is.
+type CallError struct {
+    Err  error
+    Site  string  // the callee's span and the call, e.g. "main.elf:2:1-2:2 in x(2)"
+    Stack []Frame // the calls in progress, innermost first
+}
+
+func (e *CallError) Error() string { return e.Err.Error() }
+func (e *CallError) Unwrap() error { return e.Err }
+
+// RuntimeError is an error located at the innermost expression it arose
+// in. As with CallError, its message is the plain error.
+type RuntimeError struct {
+    Err  error
+    Site  string  // where the expression starts, e.g. "main.elf:3:9"
+    Stack []Frame // the calls in progress, innermost first
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Error() }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// locate marks err as arising at pos, unless it is already located.
+func (ev *Evaluator) locate(err error, pos lexer.Pos) error {
+    if _, ok := err.(*loopSignal); ok || pos.Line == 0 || Where(err) != "" { return err }
+    return &RuntimeError{Err: err, Site: ev.at(pos), Stack: ev.stack()}
+}
+
+// Where returns the call site or expression err arose at, or "" when it
+// does not know.
+func Where(err error) string {
+    var ce *CallError
+    if errors.As(err, &ce) { return ce.Site }
+    var re *RuntimeError
+    if errors.As(err, &re) { return re.Site }
+    return ""
+}
+
+// maxCallSource bounds how much of a call is quoted; longer calls show only
+// the callee.
+const maxCallSource = 60
+
+func (site callSite) describe() string {
+    if len(site.source) <= maxCallSource { return site.source }
+    return site.source[:site.end.Offset-site.start.Offset] + "(...)"
+}
+
+func compileNode(e parser.Expr) code {
+    switch ex := e.(type) {
+    case parser.IntegerLit:
+        // digits only, underscores skipped
+        var v int64 = 0
+        for i := 0; i < len(ex.Value); i++ {
+            c := ex.Value[i]
+            if c == '_' { continue }
+            n, ok := mulInt(v, 10)
+            if ok { n, ok = addInt(n, int64(c-'0')) }
+            if !ok {
+                b, _ := new(big.Int).SetString(strings.ReplaceAll(ex.Value, "_", ""), 10)
+                return constant(Big{V: b})
+            }
+            v = n
+        }
+        return constant(intValue(v))
+    case parser.DecimalLit:
+        // keep literal for printing; also parse to its exact value
+        s := normalizeDecLiteralString(ex.Value)
+        var d Dec
+        if f, err := strconv.ParseFloat(s, 64); err == nil && shortLiteral(s) {
+            d = Dec{V: f}
+        } else if r, ok := new(big.Rat).SetString(s); ok {
+            d = ratDec(r)
+        } else {
+            // the parser rejects these, but an AST may be built by hand
+            return func(*Evaluator) (Value, error) { return nil, fmt.Errorf("Invalid decimal literal: %s", ex.Value) }
+        }
+        // with an exponent it prints written out, 1.5e3 as 1500
+        if !strings.ContainsAny(s, "eE") { d.Lit = s }
+        return constant(d)
+    case parser.StringLit:
+        return constant(Str{V: ex.Value})
+    case parser.BooleanLit:
+        return constant(Bool{V: ex.Value})
+    case parser.NilLit:
+        return constant(Nil{})
+    case parser.Identifier:
+        name, ref := ex.Name, ex.Ref
+        // builtins are never rebound, so skip walking the scope chain
+        if ref.Builtin { return func(ev *Evaluator) (Value, error) { return ev.builtins.slots[ref.Slot].val, nil } }
+        return func(ev *Evaluator) (Value, error) {
+            b, err := ev.env.lookup(name, ref)
+            if b.mut { ev.effects++ }
+            return b.val, err
+        }
+    case parser.FunctionLit:
+        params := make([]string, len(ex.Parameters))
+        for i, p := range ex.Parameters { params[i] = p.Name }
+        body, pos := compileBlock(ex.Body), ex.Pos
+        return func(ev *Evaluator) (Value, error) {
+            return &userFunc{params: params, body: body, env: ev.env, pos: pos}, nil
+        }
+    case parser.ListLit:
+        items := compileItems(ex.Items)
+        return func(ev *Evaluator) (Value, error) {
+            vals, err := items(ev)
+            if err != nil { return nil, err }
+            return List{Items: vals}, nil
+        }
+    case parser.SetLit:
+        items := compileExprs(ex.Items)
+        return func(ev *Evaluator) (Value, error) {
+            set := newSet(make([]Value, 0, len(items)))
+            for _, it := range items {
+                v, err := it(ev); if err != nil { return nil, err }
+                if _, isDict := v.(Dict); isDict { return nil, fmt.Errorf("Unable to include a Dictionary within a Set") }
+                set = set.with(v)
+            }
+            return set, nil
+        }
+    case parser.DictLit:
+        keys, vals := make([]code, len(ex.Items)), make([]code, len(ex.Items))
+        for i, it := range ex.Items { keys[i], vals[i] = compileExpr(it.Key), compileExpr(it.Value) }
+        return func(ev *Evaluator) (Value, error) {
+            dict := newDict(make([]dictEntry, 0, len(keys)))
+            for i := range keys {
+                k, err := keys[i](ev); if err != nil { return nil, err }
+                if _, isDict := k.(Dict); isDict { return nil, fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
+                v, err := vals[i](ev); if err != nil { return nil, err }
+                // a duplicate key overrides the earlier value
+                dict.put(k, v)
+            }
+            return dict, nil
+        }
+    case parser.LetExpr:
+        value, name, ref := compileExpr(ex.Value), ex.Name.Name, ex.Name.Ref
+        mutable := (ex.Type == "MutableLet")
+        return func(ev *Evaluator) (Value, error) {
+            v, err := value(ev)
+            if err != nil { return nil, err }
+            // name functions after their first binding, for error reports
+            if f, ok := v.(*userFunc); ok && f.name == "" { f.name = name }
+            ev.env.define(name, ref, v, mutable)
+            return v, nil
+        }
+    case parser.AssignExpr:
+        value, name, ref := compileExpr(ex.Value), ex.Name.Name, ex.Name.Ref
+        return func(ev *Evaluator) (Value, error) {
+            v, err := value(ev)
+            if err != nil { return nil, err }
+            ev.effects++
+            if err := ev.env.assign(name, ref, v); err != nil { return nil, err }
+            return v, nil
+        }
+    case parser.InfixExpr:
+        return compileInfix(ex)
+    case parser.PrefixExpr:
+        operand, op := compileExpr(ex.Operand), ex.Operator
+        return func(ev *Evaluator) (Value, error) {
+            v, err := operand(ev)
+            if err != nil { return nil, err }
+            switch t := v.(type) {
+            case Int:
+                if t.V == math.MinInt64 { return bigValue(new(big.Int).Neg(big.NewInt(t.V))), nil }
+                return intValue(-t.V), nil
+            case Big:
+                return bigValue(new(big.Int).Neg(t.V)), nil
+            case Dec:
+                if t.R != nil { return Dec{V: -t.V, R: new(big.Rat).Neg(t.R)}, nil }
+                return Dec{V: -t.V}, nil
+            default:
+                return nil, fmt.Errorf("Unsupported operation: %s %s", op, typeName(v))
+            }
+        }
+    case parser.CallExpr:
+        fn, args, site := compileExpr(ex.Function), compileItems(ex.Arguments), siteOf(ex)
+        return func(ev *Evaluator) (Value, error) {
+            fv, err := fn(ev)
+            if err != nil { return nil, err }
+            f, err := ev.callee(site, fv)
+            if err != nil { return nil, err }
+            vals, err := args(ev)
+            if err != nil { return nil, err }
+            if err := ev.checkArgs(site, f, len(vals), false); err != nil { return nil, err }
+            ev.callAt = site.start
+            return f.call(ev, vals)
+        }
+    case parser.IfExpr:
+        cond, cons, alt := compileExpr(ex.Condition), compileBlock(ex.Consequence), constant(Nil{})
+        if ex.Alternative != nil { alt = compileBlock(*ex.Alternative) }
+        return func(ev *Evaluator) (Value, error) {
+            c, err := cond(ev)
+            if err != nil { return nil, err }
+            if isTruthy(c) { return cons(ev) }
+            return alt(ev)
+        }
+    case parser.MatchExpr:
+        return compileMatch(ex)
+    case parser.LoopExpr:
+        return compileLoop(ex)
+    case parser.BreakExpr:
+        val := constant(Nil{})
+        if ex.Value != nil { val = compileExpr(ex.Value) }
+        return func(ev *Evaluator) (Value, error) {
+            v, err := val(ev)
+            if err != nil { return nil, err }
+            return nil, &loopSignal{brk: true, val: v}
+        }
+    case parser.ContinueExpr:
+        return func(*Evaluator) (Value, error) { return nil, errContinue }
+    case parser.FunctionComposition:
+        fns := compileExprs(ex.Functions)
+        return func(ev *Evaluator) (Value, error) {
+            funs := make([]Function, 0, len(fns))
+            for _, fe := range fns {
+                v, err := fe(ev); if err != nil { return nil, err }
+                f, err := asFunction(v); if err != nil { return nil, err }
+                funs = append(funs, f)
+            }
+            return &composedFunc{functions: funs}, nil
+        }
+    case parser.FunctionThread:
+        return compileThread(ex)
+    case parser.IndexExpr:
+        left, index, pos := compileExpr(ex.Left), compileExpr(ex.Index), ex.Pos
+        return func(ev *Evaluator) (Value, error) {
+            l, err := left(ev)
+            if err != nil { return nil, err }
+            i, err := index(ev)
+            if err != nil { return nil, err }
+            if ev.strictIndex {
+                if err := checkBounds(l, i); err != nil { return nil, ev.locate(err, pos) }
+            }
+            return indexValue(ev, l, i)
+        }
+    default:
+        err := fmt.Errorf("Unsupported expression: %s", strings.TrimPrefix(fmt.Sprintf("%T", e), "parser."))
+        return func(*Evaluator) (Value, error) { return nil, err }
+    }
+}
+
+func compileInfix(ex parser.InfixExpr) code {
+    // logical operators short-circuit on truthiness
+    switch ex.Operator {
+    case "&&", "||":
+        left, right := compileExpr(ex.Left), compileExpr(ex.Right)
+        and := ex.Operator == "&&"
+        return func(ev *Evaluator) (Value, error) {
+            l, err := left(ev); if err != nil { return nil, err }
+            if isTruthy(l) != and { return boolValue(!and), nil }
+            r, err := right(ev); if err != nil { return nil, err }
+            return boolValue(isTruthy(r)), nil
+        }
+    }
+    if _, ok := arithmetic[ex.Operator]; ok {
+        run := compileArith(ex)
+        return func(ev *Evaluator) (Value, error) {
+            n, v, err := run(ev)
+            if err != nil || v != nil { return v, err }
+            return n.value(), nil
+        }
+    }
+    if ex.Operator == ".." || ex.Operator == "..=" {
+        left, right, op := compileExpr(ex.Left), compileExpr(ex.Right), ex.Operator
+        return func(ev *Evaluator) (Value, error) {
+            l, err := left(ev); if err != nil { return nil, err }
+            r, err := right(ev); if err != nil { return nil, err }
+            from, ok1 := l.(Int)
+            to, ok2 := r.(Int)
+            if !ok1 || !ok2 { return nil, fmt.Errorf("Unsupported operation: %s %s %s", typeName(l), op, typeName(r)) }
+            return intRange(from.V, to.V, op == "..="), nil
+        }
+    }
+    if test, ok := comparisons[ex.Operator]; ok {
+        left, right := compileNumeric(ex.Left), compileNumeric(ex.Right)
+        op, relational := ex.Operator, ex.Operator != "==" && ex.Operator != "!="
+        return func(ev *Evaluator) (Value, error) {
+            a, l, err := left(ev); if err != nil { return nil, err }
+            b, r, err := right(ev); if err != nil { return nil, err }
+            if l == nil && r == nil { return boolValue(test(a.compare(b))), nil }
+            if l == nil { l = a.value() }
+            if r == nil { r = b.value() }
+            if !relational { return boolValue(equal(l, r) == (op == "==")), nil }
+            if !orderable(l, r) { return nil, fmt.Errorf("Unsupported operation: %s %s %s", typeName(l), op, typeName(r)) }
+            return boolValue(test(compare(l, r))), nil
+        }
+    }
+    return func(*Evaluator) (Value, error) { return nil, errors.New("Unsupported operator") }
+}
+
+// number is an unboxed Int or Dec. Nested arithmetic passes numbers between
+// operators, so only the outermost result of `a * b + c` is boxed.
+type number struct {
+    i   int64
+    f   float64
+    dec bool
+}
+
+func (n number) value() Value {
+    if n.dec { return Dec{V: n.f} }
+    return intValue(n.i)
+}
+
+// decimal is op's fast path (see decimal) for n and m.
+func (n number) decimal(op decOp, m number) (number, bool) {
+    x, ok1 := n.digits()
+    y, ok2 := m.digits()
+    if !ok1 || !ok2 { return number{}, false }
+    r, ok := op.fast(x, y)
+    if !ok { return number{}, false }
+    f, ok := r.short()
+    return number{f: f, dec: true}, ok
+}
+
+func (n number) digits() (dec, bool) {
+    if n.dec { return floatDec(n.f) }
+    return dec{m: n.i}, true
+}
+
+// compare orders two numbers the way compare orders Int and Dec values.
+func (n number) compare(m number) int {
+    switch {
+    case !n.dec && !m.dec:
+        if n.i < m.i { return -1 } ; if n.i > m.i { return 1 }; return 0
+    case !n.dec: return compareIntDec(n.i, m.f)
+    case !m.dec: return -compareIntDec(m.i, n.f)
+    }
+    return compareFloat(n.f, m.f)
+}
+
+// numCode evaluates an operand as a number; the Value result is set instead
+// when the operand is anything else.
+type numCode func(ev *Evaluator) (number, Value, error)
+
+func compileNumeric(e parser.Expr) numCode {
+    if ex, ok := e.(parser.InfixExpr); ok {
+        if _, ok := arithmetic[ex.Operator]; ok {
+            run := compileArith(ex)
+            // counted like any other node, see compileExpr
+            return func(ev *Evaluator) (number, Value, error) {
+                if ev.stats != nil || ev.ctx != nil || ev.memLimit > 0 {
+                    if err := ev.step(); err != nil { return number{}, nil, err }
+                }
+                return run(ev)
+            }
+        }
+    }
+    run := compileExpr(e)
+    return func(ev *Evaluator) (number, Value, error) {
+        v, err := run(ev)
+        if err != nil { return number{}, nil, err }
+        return toNumber(v)
+    }
+}
+
+func toNumber(v Value) (number, Value, error) {
+    switch x := v.(type) {
+    case Int: return number{i: x.V}, nil, nil
+    case Dec:
+        // an exact value beyond V stays boxed
+        if x.R == nil { return number{f: x.V, dec: true}, nil, nil }
+    }
+    return number{}, v, nil
+}
+
+// compileArith compiles + - * / %. Two numbers take the fast path; anything
+// else (strings, collections, a Big, division by zero, an Integer result
+// that overflows or a Decimal one the fast decimal arithmetic can't give)
+// goes to the generic operator.
+func compileArith(ex parser.InfixExpr) numCode {
+    left, right := compileNumeric(ex.Left), compileNumeric(ex.Right)
+    a, pos := arithmetic[ex.Operator], ex.Pos
+    return func(ev *Evaluator) (number, Value, error) {
+        x, l, err := left(ev); if err != nil { return number{}, nil, err }
+        y, r, err := right(ev); if err != nil { return number{}, nil, err }
+        if l == nil && r == nil {
+            if n, ok := a.fast(x, y); ok { return n, nil, nil }
+        }
+        if l == nil { l = x.value() }
+        if r == nil { r = y.value() }
+        v, err := a.generic(ev, l, r)
+        if err != nil { return number{}, nil, ev.locate(err, pos) }
+        return toNumber(v)
+    }
+}
+
+type arithOp struct {
+    fast    func(a, b number) (number, bool)
+    generic func(ev *Evaluator, l, r Value) (Value, error)
+}
+
+var arithmetic = map[string]arithOp{
+    "+": {
+        func(a, b number) (number, bool) {
+            if a.dec || b.dec { return a.decimal(decAdd, b) }
+            n, ok := addInt(a.i, b.i)
+            return number{i: n}, ok
+        },
+        (*Evaluator).add,
+    },
+    "-": {
+        func(a, b number) (number, bool) {
+            if a.dec || b.dec { return a.decimal(decSub, b) }
+            n, ok := subInt(a.i, b.i)
+            return number{i: n}, ok
+        },
+        (*Evaluator).sub,
+    },
+    "*": {
+        func(a, b number) (number, bool) {
+            if a.dec || b.dec { return a.decimal(decMul, b) }
+            n, ok := mulInt(a.i, b.i)
+            return number{i: n}, ok
+        },
+        (*Evaluator).mul,
+    },
+    "/": {
+        // a zero divisor is reported by ev.div
+        func(a, b number) (number, bool) {
+            if a.dec || b.dec { return a.decimal(decQuo, b) }
+            if b.i == 0 { return number{}, false }
+            n, ok := divInt(a.i, b.i)
+            return number{i: n}, ok
+        },
+        (*Evaluator).div,
+    },
+    "%": {
+        // a zero divisor is reported by ev.mod, as are Decimals
+        func(a, b number) (number, bool) {
+            if a.dec || b.dec || b.i == 0 { return number{}, false }
+            return number{i: a.i % b.i}, true
+        },
+        (*Evaluator).mod,
+    },
+}
+
+// orderable reports whether > < >= <= apply to a and b: two numbers, or two
+// strings, lists, sets or dictionaries. compare orders any two values, for
+// sorting sets and dictionaries, but across other types (and for booleans,
+// nil and functions, as the spec has it) that order is arbitrary and the
+// operators fail instead.
+func orderable(a, b Value) bool {
+    switch a.(type) {
+    case Int, Big, Dec:
+        switch b.(type) {
+        case Int, Big, Dec: return true
+        }
+        return false
+    case Str, List, Set, Dict:
+        return typeName(a) == typeName(b)
+    }
+    return false
+}
+
+// comparisons maps each comparison operator to its test on compare's result.
+var comparisons = map[string]func(c int) bool{
+    "==": func(c int) bool { return c == 0 },
+    "!=": func(c int) bool { return c != 0 },
+    ">": func(c int) bool { return c > 0 },
+    "<": func(c int) bool { return c < 0 },
+    ">=": func(c int) bool { return c >= 0 },
+    "<=": func(c int) bool { return c <= 0 },
+}
+
+// compileThread compiles `initial |> f |> g(x)`. Whatever kind of function
+// a step is (builtin, user function, partial application or composition):
+//   - `x |> f` is `f(x)`, and `x |> g(a, b)` is `g(a, b, x)`: the threaded
+//     value is always the last argument, never the first, which is why the
+//     collection comes last in builtins like fold(init, f, list)
+//   - the step is then called exactly like the direct call, so too few
+//     arguments give a partial application awaiting the rest, and a
+//     builtin given too many fails as it would for `g(a, b, x)`
+//   - `x |> g(a)(b)` calls the function `g(a)` returns with (b, x)
+func compileThread(ex parser.FunctionThread) code {
+    initial := compileExpr(ex.Initial)
+    type threadStep struct {
+        fn   code
+        args itemsCode // no values unless the step is a call
+        site callSite  // zero unless the step is a call
+        pos  lexer.Pos
+    }
+    steps := make([]threadStep, len(ex.Functions))
+    for i, step := range ex.Functions {
+        if ce, ok := step.(parser.CallExpr); ok {
+            steps[i] = threadStep{fn: compileExpr(ce.Function), args: compileItems(ce.Arguments), site: siteOf(ce), pos: ce.Pos}
+        } else {
+            steps[i] = threadStep{fn: compileExpr(step), args: compileItems(nil), pos: parser.PosOf(step)}
+        }
+    }
+    return func(ev *Evaluator) (Value, error) {
+        cur, err := initial(ev)
+        if err != nil { return nil, err }
+        for _, step := range steps {
+            fv, err := step.fn(ev)
+            if err != nil { return nil, err }
+            f, err := ev.callee(step.site, fv)
+            if err != nil { return nil, err }
+            args, err := step.args(ev)
+            if err != nil { return nil, err }
+            if err := ev.checkArgs(step.site, f, len(args)+1, true); err != nil { return nil, err }
+            ev.callAt = step.pos
+            if cur, err = f.call(ev, append(args, cur)); err != nil { return nil, ev.locate(err, step.pos) }
+        }
+        return cur, nil
+    }
+}
+
+// checkBounds fails when an Int index is out of range of a List or String;
+// indexValue itself returns nil for those.
+func checkBounds(left, idxVal Value) error {
+    idx, ok := idxVal.(Int)
+    if !ok { return nil }
+    var size int
+    switch coll := left.(type) {
+    case List: size = len(coll.Items)
+    case Str: size = utf8.RuneCountInString(coll.V)
+    default: return nil
+    }
+    if idx.V < -int64(size) || idx.V >= int64(size) { return fmt.Errorf("Index out of bounds: %d (size %d)", idx.V, size) }
+    return nil
+}
+
+func indexValue(ev *Evaluator, left, idxVal Value) (Value, error) {
+    switch coll := left.(type) {
+    case Iterator:
+        idx, ok := idxVal.(Int)
+        if !ok { return nil, fmt.Errorf("Unable to perform index operation, found: Iterator[%s]", typeName(idxVal)) }
+        return iteratorAt(ev, coll, idx.V)
+    case List:
+        idx, ok := idxVal.(Int)
+        if !ok { return nil, fmt.Errorf("Unable to perform index operation, found: List[%s]", typeName(idxVal)) }
+        i := int(idx.V)
+        if i < 0 { i = len(coll.Items) + i }
+        if i < 0 || i >= len(coll.Items) { return Nil{}, nil }
+        return coll.Items[i], nil
+    case Str:
+        idx, ok := idxVal.(Int)
+        if !ok { return nil, fmt.Errorf("Unable to perform index operation, found: String[%s]", typeName(idxVal)) }
+        c, ok := charAt(coll.V, int(idx.V))
+        if !ok { return Nil{}, nil }
+        return Str{V: c}, nil
+    case Dict:
+        if _, isDict := idxVal.(Dict); isDict { return nil, fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
+        if v, ok := coll.lookup(idxVal); ok { return v, nil }
+        return Nil{}, nil
+    default:
+        return Nil{}, nil
+    }
+}
+
+// matcher reports whether a value matches a compiled pattern, binding the
+// pattern's names into slots as it goes.
+type matcher func(ev *Evaluator, slots []binding, v Value) (bool, error)
+
+// compileMatch compiles a match expression: the first case whose pattern
+// matches the subject runs, in a scope holding the pattern's bindings.
+func compileMatch(ex parser.MatchExpr) code {
+    type matchCase struct {
+        names []string
+        match matcher
+        body  code
+    }
+    subject := compileExpr(ex.Subject)
+    cases := make([]matchCase, len(ex.Cases))
+    for i, c := range ex.Cases { cases[i] = matchCase{c.Names, compilePattern(c.Pattern), compileBlock(c.Body)} }
+    return func(ev *Evaluator) (Value, error) {
+        v, err := subject(ev)
+        if err != nil { return nil, err }
+        for _, c := range cases {
+            if c.names == nil {
+                ok, err := c.match(ev, nil, v)
+                if err != nil { return nil, err }
+                if ok { return c.body(ev) }
+                continue
+            }
+            outer := ev.env
+            env := newScopeEnv(outer, c.names)
+            ok, err := c.match(ev, env.slots, v)
+            if err != nil { return nil, err }
+            if !ok { continue }
+            ev.env = env
+            v, err := c.body(ev)
+            ev.env = outer
+            return v, err
+        }
+        return nil, fmt.Errorf("No match for %s", Format(v))
+    }
+}
+
+func compilePattern(pat parser.Expr) matcher {
+    switch x := pat.(type) {
+    case parser.Wildcard:
+        return func(*Evaluator, []binding, Value) (bool, error) { return true, nil }
+    case parser.Identifier:
+        slot := x.Ref.Slot
+        return func(_ *Evaluator, slots []binding, v Value) (bool, error) {
+            slots[slot] = binding{val: v, set: true}
+            return true, nil
+        }
+    case parser.ListLit:
+        items := make([]matcher, len(x.Items))
+        for i, it := range x.Items { items[i] = compilePattern(it) }
+        return func(ev *Evaluator, slots []binding, v Value) (bool, error) {
+            l, ok := v.(List)
+            if !ok || len(l.Items) != len(items) { return false, nil }
+            for i, m := range items {
+                if ok, err := m(ev, slots, l.Items[i]); !ok || err != nil { return false, err }
+            }
+            return true, nil
+        }
+    }
+    lit := compileExpr(pat)
+    return func(ev *Evaluator, _ []binding, v Value) (bool, error) {
+        want, err := lit(ev)
+        if err != nil { return false, err }
+        return equal(want, v), nil
+    }
+}
+
+// loopSignal is how break and continue leave a loop's body: returned like
+// an error through the expressions enclosing them, up to the loop. The
+// parser only accepts them within a loop of the same function.
+type loopSignal struct {
+    brk bool
+    val Value // given by a break
+}
+
+func (s *loopSignal) Error() string {
+    if s.brk { return "break outside of a loop" }
+    return "continue outside of a loop"
+}
+
+var errContinue = &loopSignal{}
+
+// compileLoop compiles a while or loop, whose body runs in a fresh scope
+// each time around.
+func compileLoop(ex parser.LoopExpr) code {
+    body := compileBlock(ex.Body)
+    var cond code
+    if ex.Condition != nil { cond = compileExpr(ex.Condition) }
+    return func(ev *Evaluator) (Value, error) {
+        for {
+            if cond != nil {
+                c, err := cond(ev)
+                if err != nil { return nil, err }
+                if !isTruthy(c) { return Nil{}, nil }
+            } else if ev.ctx != nil || ev.memLimit > 0 {
+                // an empty body would otherwise never check the limits
+                if err := ev.step(); err != nil { return nil, err }
+            }
+            if _, err := body(ev); err != nil {
+                s, ok := err.(*loopSignal)
+                if !ok { return nil, err }
+                if s.brk { return s.val, nil }
+            }
+        }
+    }
+}
@@ -0,0 +1,81 @@
+package evaluator
+
+import (
+    "io"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+func TestIf(t *testing.T) {
+    prelude := `let sign = |n| if n < 0 { "negative" } else if n == 0 { "zero" } else { "positive" };` + "\n"
+    tests := []testCase{
+        {"sign(-3)", `"negative"`, ""},
+        {"sign(0)", `"zero"`, ""},
+        {"sign(7)", `"positive"`, ""},
+        // without an else, a false condition gives nil
+        {"if false { 1 }", "nil", ""},
+        {"if [1] { 1 }", "1", ""},
+        {"if 1 > 2 { 1 } else if 2 > 3 { 2 }", "nil", ""},
+        {"let mut n = 0; if n == 0 { n = 5 }; n", "5", ""},
+        {"if false { 1 } else if true { 2 } else { 3 } * 10", "20", ""},
+    }
+    runCases(t, prelude, tests)
+}
+
+func TestLoops(t *testing.T) {
+    tests := []testCase{
+        {"let mut i = 0; let mut sum = 0; while i < 5 { i = i + 1; sum = sum + i }; sum", "15", ""},
+        {"while false { 1 }", "nil", ""},
+        {"let mut i = 0; while i < 3 { i = i + 1 }", "nil", ""},
+        // break ends the loop with its value, nil without one
+        {"let mut i = 0; loop { i = i + 1; if i * i > 50 { break i } }", "8", ""},
+        {"loop { break }", "nil", ""},
+        {"let mut i = 0; while true { i = i + 1; if i == 4 { break [i] } }", "[4]", ""},
+        // continue skips the rest of the body, from however deep within it
+        {"let mut i = 0; let mut odd = []; while i < 6 { i = i + 1; if i % 2 == 0 { continue }; odd = odd |> push(i) }; odd", "[1, 3, 5]", ""},
+        {"loop { let x = 1 + match 2 { n -> { break n * 10 } }; x }", "20", ""},
+        // break and continue apply to the innermost loop
+        {"let mut n = 0; let mut i = 0; while i < 3 { i = i + 1; loop { n = n + 1; break }; continue }; n", "3", ""},
+        // each time around gets a fresh scope for the body's lets
+        {"let mut i = 0; let mut fs = []; while i < 3 { let j = i; fs = fs |> push(|| j); i = i + 1 }; fs |> map(|f| f())", "[0, 1, 2]", ""},
+        {"[1, 2] |> map(|x| loop { break x * 3 })", "[3, 6]", ""},
+    }
+    runCases(t, "", tests)
+}
+
+func TestUnsupportedExpression(t *testing.T) {
+    // nodes the parser only builds inside patterns, lists and calls
+    tests := []struct{ expr parser.Expr; want string }{
+        {parser.Wildcard{Type: "Wildcard"}, "Unsupported expression: Wildcard"},
+        {parser.Spread{Type: "Spread", Value: parser.IntegerLit{Type: "Integer", Value: "1"}}, "Unsupported expression: Spread"},
+    }
+    for _, tt := range tests {
+        prog := parser.Program{Type: "Program", Statements: []parser.Statement{parser.ExpressionStmt{Type: "Expression", Value: tt.expr}}}
+        _, err := New(io.Discard).Eval(prog)
+        if err == nil || err.Error() != tt.want { t.Errorf("%T: got %v, want %s", tt.expr, err, tt.want) }
+    }
+}
+
+func TestStrictIndex(t *testing.T) {
+    tests := []struct{ src, want, at string }{
+        {"let xs = [1, 2];\n1 + xs[7]", "Index out of bounds: 7 (size 2)", "2:7"},
+        {"let f = |i| \"ab\"[i];\nf(-3)", "Index out of bounds: -3 (size 2)", "1:17"},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        ev := New(io.Discard)
+        ev.SetStrictIndex(true)
+        _, err = ev.Eval(prog)
+        if err == nil || err.Error() != tt.want { t.Errorf("%s: got %v, want %s", tt.src, err, tt.want); continue }
+        if at := Where(err); at != tt.at { t.Errorf("%s: got at %s, want %s", tt.src, at, tt.at) }
+    }
+    // get(i, coll) still gives nil
+    prog, err := parser.Parse("[get(7, [1, 2]), get(-3, \"ab\")]")
+    if err != nil { t.Fatal(err) }
+    ev := New(io.Discard)
+    ev.SetStrictIndex(true)
+    v, err := ev.Eval(prog)
+    if err != nil || Format(v) != "[nil, nil]" { t.Errorf("got %v, %v, want [nil, nil]", v, err) }
+}
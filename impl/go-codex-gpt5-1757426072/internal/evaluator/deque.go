@@ -0,0 +1,99 @@
+package evaluator
+
+import (
+    "fmt"
+    "sync"
+)
+
+// Deque is an immutable double-ended queue: a window [lo, hi) onto a buffer
+// shared by the deques built from one another. Like a List's tail (see
+// listTail), the buffer records the extent in use, so the deque reaching an
+// end of it can push there in place while the others, which never look past
+// their window, stay unchanged. Pops just narrow the window. Pushing and
+// popping at either end are therefore O(1), amortized over the copies made
+// when a buffer fills or an older deque is pushed onto.
+type Deque struct {
+    buf    *dequeBuf
+    lo, hi int
+}
+
+type dequeBuf struct {
+    mu     sync.Mutex
+    items  []Value
+    lo, hi int // the extent claimed by some deque
+}
+
+func (d Deque) repr() string { return "deque(" + Format(d.list()) + ")" }
+
+func (d Deque) size() int { return d.hi - d.lo }
+
+func (d Deque) list() List {
+    if d.buf == nil { return List{} }
+    return List{Items: d.buf.items[d.lo:d.hi:d.hi]}
+}
+
+// grown copies d into a fresh buffer with room at both ends.
+func (d Deque) grown() Deque {
+    n := d.size()
+    items := make([]Value, 2*n+8)
+    lo := (len(items) - n) / 2
+    copy(items[lo:], d.list().Items)
+    return Deque{buf: &dequeBuf{items: items, lo: lo, hi: lo + n}, lo: lo, hi: lo + n}
+}
+
+func (d Deque) pushBack(v Value) Deque {
+    if d.buf != nil {
+        b := d.buf
+        b.mu.Lock()
+        claimed := d.hi == b.hi && d.hi < len(b.items)
+        if claimed { b.items[d.hi] = v; b.hi++ }
+        b.mu.Unlock()
+        if claimed { return Deque{buf: b, lo: d.lo, hi: d.hi + 1} }
+    }
+    return d.grown().pushBack(v)
+}
+
+func (d Deque) pushFront(v Value) Deque {
+    if d.buf != nil {
+        b := d.buf
+        b.mu.Lock()
+        claimed := d.lo == b.lo && d.lo > 0
+        if claimed { b.items[d.lo-1] = v; b.lo-- }
+        b.mu.Unlock()
+        if claimed { return Deque{buf: b, lo: d.lo - 1, hi: d.hi} }
+    }
+    return d.grown().pushFront(v)
+}
+
+func (ev *Evaluator) defineDequeBuiltins(env *Env) {
+    // deque(list?): a deque of the list's items, or an empty one
+    env.Define("deque", newVariadicBuiltin("deque", 0, 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        if len(args) == 0 { return Deque{}, nil }
+        l, ok := args[0].(List)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: deque(%s)", typeName(args[0])) }
+        return Deque{buf: &dequeBuf{items: l.Items, hi: len(l.Items)}, hi: len(l.Items)}.grown(), nil
+    }), false)
+    pusher := func(name string, push func(Deque, Value) Deque) Function {
+        return newBuiltin(name, 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+            d, ok := args[1].(Deque)
+            if !ok { return nil, fmt.Errorf("Unexpected argument: %s(%s, %s)", name, typeName(args[0]), typeName(args[1])) }
+            return push(d, args[0]), nil
+        })
+    }
+    // push_front(v, dq) and push_back(v, dq): dq with v added at that end
+    env.Define("push_front", pusher("push_front", Deque.pushFront), false)
+    env.Define("push_back", pusher("push_back", Deque.pushBack), false)
+    // pop_front(dq) and pop_back(dq): [v, rest] for the item at that end, or
+    // nil when dq is empty
+    popper := func(name string, front bool) Function {
+        return newBuiltin(name, 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+            d, ok := args[0].(Deque)
+            if !ok { return nil, fmt.Errorf("Unexpected argument: %s(%s)", name, typeName(args[0])) }
+            if d.size() == 0 { return Nil{}, nil }
+            if front { return List{Items: []Value{d.buf.items[d.lo], Deque{buf: d.buf, lo: d.lo + 1, hi: d.hi}}}, nil }
+            return List{Items: []Value{d.buf.items[d.hi-1], Deque{buf: d.buf, lo: d.lo, hi: d.hi - 1}}}, nil
+        })
+    }
+    env.Define("pop_front", popper("pop_front", true), false)
+    env.Define("pop_back", popper("pop_back", false), false)
+}
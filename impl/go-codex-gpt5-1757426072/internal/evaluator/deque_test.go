@@ -0,0 +1,24 @@
+package evaluator
+
+import "testing"
+
+func TestDeque(t *testing.T) {
+    prelude := "let d = deque([2, 3]) |> push_front(1) |> push_back(4);\n"
+    tests := []testCase{
+        {`d`, `deque([1, 2, 3, 4])`, ""},
+        {`[size(d), size(deque())]`, `[4, 0]`, ""},
+        {`pop_front(d)[0]`, `1`, ""},
+        {`pop_back(d)`, `[4, deque([1, 2, 3])]`, ""},
+        {`pop_front(deque())`, `nil`, ""},
+        // older versions are untouched by pushes onto them or their successors
+        {`let a = push_back(5, d); let b = push_back(6, d); [to_list(a), to_list(b), to_list(d)]`, `[[1, 2, 3, 4, 5], [1, 2, 3, 4, 6], [1, 2, 3, 4]]`, ""},
+        {`let r = pop_front(d)[1]; [push_front(0, r), push_front(9, d)]`, `[deque([0, 2, 3, 4]), deque([9, 1, 2, 3, 4])]`, ""},
+        // a queue cycled far past its original buffer
+        {`let spin = |d, n| if n == 0 { d } else { let p = pop_front(d); spin(push_back(p[0], p[1]), n - 1) }; spin(d, 1001) |> to_list`, `[2, 3, 4, 1]`, ""},
+        {`deque([1]) == push_back(1, deque())`, `true`, ""},
+        {`if deque() { 1 } else { 2 }`, `2`, ""},
+        {`push_back(1, [])`, "", "Unexpected argument: push_back(Integer, List)"},
+        {`deque(1)`, "", "Unexpected argument: deque(Integer)"},
+    }
+    runCases(t, prelude, tests)
+}
@@ -0,0 +1,137 @@
+package evaluator
+
+import (
+    "fmt"
+    "slices"
+)
+
+// A Dict keeps its entries in insertion order alongside a hash index of
+// their keys (see hashIndex), shared with the dictionaries assoc derives
+// from it. For a dictionary of n entries:
+//
+//   - looking a key up is O(1)
+//   - assoc of a new key is amortised O(1) on the newest version; on an
+//     older version, or when replacing a key's value, the entries are copied,
+//     O(n)
+//   - a + b is O(len(a) + len(b))
+//   - printing and comparing sort the entries once per value, O(n log n)
+
+// lookup returns the value bound to k.
+func (d Dict) lookup(k Value) (Value, bool) {
+    if d.index == nil { d = newDict(d.Items) }
+    d.index.mu.RLock()
+    defer d.index.mu.RUnlock()
+    i := d.find(hashValue(k), k)
+    if i < 0 { return nil, false }
+    return d.Items[i].Val, true
+}
+
+// find returns the position of key k (hashing to h), or -1. The caller
+// holds the index lock.
+func (d Dict) find(h uint64, k Value) int {
+    return d.index.find(len(d.Items), h, func(i int) bool { return equal(d.Items[i].Key, k) })
+}
+
+// with returns d with k bound to v.
+func (d Dict) with(k, v Value) Dict {
+    if d.index == nil { d = newDict(d.Items) }
+    h := hashValue(k)
+    idx := d.index
+    idx.mu.Lock()
+    defer idx.mu.Unlock()
+    n := len(d.Items)
+    if i := d.find(h, k); i >= 0 {
+        // the keys keep their positions, so the copy shares the index
+        items := make([]dictEntry, n)
+        copy(items, d.Items)
+        items[i].Val = v
+        return Dict{Items: items, sorted: &sortedView[dictEntry]{}, index: idx}
+    }
+    if idx.claim(n, h) { return Dict{Items: append(d.Items, dictEntry{Key: k, Val: v}), sorted: &sortedView[dictEntry]{}, index: idx} }
+    items := make([]dictEntry, n, max(2*n, 4))
+    copy(items, d.Items)
+    fresh := newHashIndex(n, func(i int) uint64 { return hashValue(items[i].Key) })
+    fresh.claim(n, h)
+    return Dict{Items: append(items, dictEntry{Key: k, Val: v}), sorted: &sortedView[dictEntry]{}, index: fresh}
+}
+
+// put binds k to v in place, for a dictionary still being built and not
+// yet shared.
+func (d *Dict) put(k, v Value) {
+    h := hashValue(k)
+    if i := d.find(h, k); i >= 0 {
+        d.Items[i].Val = v
+        return
+    }
+    d.index.claim(len(d.Items), h)
+    d.Items = append(d.Items, dictEntry{Key: k, Val: v})
+}
+
+// merge returns d with every entry of other added, other's values winning.
+func (d Dict) merge(other Dict) Dict {
+    items := make([]dictEntry, len(d.Items), len(d.Items)+len(other.Items))
+    copy(items, d.Items)
+    out := newDict(items)
+    for _, e := range other.Items { out.put(e.Key, e.Val) }
+    return out
+}
+
+func (ev *Evaluator) defineDictBuiltins(env *Env) {
+    // update(key, fn, dict): dict with key bound to fn(its value), nil when absent
+    env.Define("update", newBuiltin("update", 3, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, ok1 := args[1].(Function)
+        dict, ok2 := args[2].(Dict)
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: update(%s, %s, %s)", typeName(args[0]), typeName(args[1]), typeName(args[2])) }
+        return updateDict(ev2, dict, args[0], Nil{}, fn)
+    }), false)
+    // update_d(key, default, fn, dict): as update, with default for an absent key
+    env.Define("update_d", newBuiltin("update_d", 4, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, ok1 := args[2].(Function)
+        dict, ok2 := args[3].(Dict)
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: update_d(%s, %s, %s, %s)", typeName(args[0]), typeName(args[1]), typeName(args[2]), typeName(args[3])) }
+        return updateDict(ev2, dict, args[0], args[1], fn)
+    }), false)
+    // frequencies(coll): each item of a list, or character of a string, to
+    // the number of times it occurs, in order of first occurrence
+    env.Define("frequencies", newBuiltin("frequencies", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        var items []Value
+        switch x := args[0].(type) {
+        case List: items = x.Items
+        case Str: for _, c := range x.V { items = append(items, Str{V: string(c)}) }
+        default: return nil, fmt.Errorf("Unexpected argument: frequencies(%s)", typeName(args[0]))
+        }
+        counts := newDict(nil)
+        for _, it := range items {
+            if _, isDict := it.(Dict); isDict { return nil, fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
+            h := hashValue(it)
+            if i := counts.find(h, it); i >= 0 {
+                counts.Items[i].Val = intValue(counts.Items[i].Val.(Int).V + 1)
+                continue
+            }
+            counts.put(it, intValue(1))
+        }
+        return counts, nil
+    }), false)
+    // most_common(n, dict): the n entries with the largest values, as
+    // [key, value] pairs from the largest down, equal values by key
+    env.Define("most_common", newBuiltin("most_common", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        n, ok1 := args[0].(Int)
+        dict, ok2 := args[1].(Dict)
+        if !ok1 || !ok2 || n.V < 0 { return nil, fmt.Errorf("Unexpected argument: most_common(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        entries := slices.Clone(dict.ordered())
+        slices.SortStableFunc(entries, func(a, b dictEntry) int { return compare(b.Val, a.Val) })
+        entries = entries[:min(int64(len(entries)), n.V)]
+        out := make([]Value, len(entries))
+        for i, e := range entries { out[i] = List{Items: []Value{e.Key, e.Val}} }
+        return List{Items: out}, nil
+    }), false)
+}
+
+func updateDict(ev *Evaluator, dict Dict, key, def Value, fn Function) (Value, error) {
+    if _, isDict := key.(Dict); isDict { return nil, fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
+    cur, ok := dict.lookup(key)
+    if !ok { cur = def }
+    v, err := fn.call(ev, []Value{cur})
+    if err != nil { return nil, err }
+    return dict.with(key, v), nil
+}
@@ -0,0 +1,18 @@
+package evaluator
+
+import "testing"
+
+func TestFrequencies(t *testing.T) {
+    tests := []testCase{
+        {`frequencies("abca")`, `#{"a": 2, "b": 1, "c": 1}`, ""},
+        {`frequencies([1, 1.0, [2], [2], 3])`, `#{1: 2, 3: 1, [2]: 2}`, ""},
+        {`frequencies([])`, `#{}`, ""},
+        {`"hello" |> frequencies |> most_common(2)`, `[["l", 2], ["e", 1]]`, ""},
+        {`most_common(5, #{"a": 1, "b": 3})`, `[["b", 3], ["a", 1]]`, ""},
+        {`most_common(0, #{"a": 1})`, `[]`, ""},
+        {`frequencies(1)`, "", "Unexpected argument: frequencies(Integer)"},
+        {`frequencies([#{}])`, "", "Unable to use a Dictionary as a Dictionary key"},
+        {`most_common(-1, #{})`, "", "Unexpected argument: most_common(Integer, Dictionary)"},
+    }
+    runCases(t, "", tests)
+}
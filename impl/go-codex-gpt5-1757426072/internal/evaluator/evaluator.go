@@ -1,12 +1,21 @@
 package evaluator
 
 import (
-    "errors"
+    "bufio"
+    "context"
     "fmt"
     "io"
+    "math"
+    "math/big"
+    "math/rand/v2"
+    "os"
     "sort"
+    "strconv"
     "strings"
+    "unicode/utf8"
 
+    "elf-lang/impl/internal/crash"
+    "elf-lang/impl/internal/lexer"
     "elf-lang/impl/internal/parser"
 )
 
@@ -15,83 +24,57 @@ type Value interface{ repr() string }
 
 type (
     Int    struct{ V int64 }
-    Dec    struct{ V float64; Lit string }
+    Big    struct{ V *big.Int } // an Integer beyond int64, see bigValue
+    Dec    struct{ V float64; Lit string; R *big.Rat } // see decimal
     Str    struct{ V string }
     Bool   struct{ V bool }
     Nil    struct{}
-    List   struct{ Items []Value }
-    Set    struct{ Items []Value }
-    Dict   struct{ Items []dictEntry }
+    List   struct{ Items []Value; tail *listTail }
+    Set    struct{ Items []Value; sorted *sortedView[Value]; index *hashIndex }
+    Dict   struct{ Items []dictEntry; sorted *sortedView[dictEntry]; index *hashIndex }
 )
 
 func (v Int) repr() string  { return fmt.Sprintf("%d", v.V) }
-func (v Dec) repr() string  { if v.Lit != "" { return v.Lit }; return formatDecimal(v.V) }
-func (v Str) repr() string  { return fmt.Sprintf("\"%s\"", escapeForPrint(v.V)) }
+func (v Big) repr() string  { return v.V.String() }
+func (v Dec) repr() string  {
+    if v.Lit != "" { return v.Lit }
+    if v.R != nil { return formatRat(v.R, v.V) }
+    return formatDecimal(v.V)
+}
+func (v Str) repr() string  { return Format(v) }
 func (v Bool) repr() string { if v.V { return "true" }; return "false" }
 func (v Nil) repr() string  { return "nil" }
-func (v List) repr() string {
-    var b strings.Builder
-    b.WriteByte('[')
-    for i, it := range v.Items {
-        if i > 0 { b.WriteString(", ") }
-        b.WriteString(Format(it))
-    }
-    b.WriteByte(']')
-    return b.String()
-}
-func (v Set) repr() string {
-    // Print in ascending order by value
-    items := make([]Value, len(v.Items))
-    copy(items, v.Items)
-    sort.Slice(items, func(i, j int) bool { return compare(items[i], items[j]) < 0 })
-    var b strings.Builder
-    b.WriteByte('{')
-    for i, it := range items {
-        if i > 0 { b.WriteString(", ") }
-        b.WriteString(Format(it))
-    }
-    b.WriteByte('}')
-    return b.String()
-}
-func (v Dict) repr() string {
-    // Print ascending order by key
-    items := make([]dictEntry, len(v.Items))
-    copy(items, v.Items)
-    sort.Slice(items, func(i, j int) bool { return compare(items[i].Key, items[j].Key) < 0 })
-    var b strings.Builder
-    b.WriteString("#{")
-    for i, it := range items {
-        if i > 0 { b.WriteString(", ") }
-        b.WriteString(Format(it.Key))
-        b.WriteString(": ")
-        b.WriteString(Format(it.Val))
+func (v List) repr() string { return Format(v) }
+func (v Set) repr() string  { return Format(v) }
+func (v Dict) repr() string { return Format(v) }
+
+// formatDecimal writes f as the shortest decimal that rounds to it, which
+// is the decimal its arithmetic works with (see decimal), without an
+// exponent and without a fraction when it is whole.
+func formatDecimal(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+// formatRat writes a Decimal's exact value r in full when it has an end,
+// when its denominator has no prime factors but 2 and 5, and otherwise (1/3
+// has none) as its float64 f.
+func formatRat(r *big.Rat, f float64) string {
+    d := new(big.Int).Set(r.Denom())
+    twos := d.TrailingZeroBits()
+    d.Rsh(d, twos)
+    fives, five, q, m := uint(0), big.NewInt(5), new(big.Int), new(big.Int)
+    for {
+        if q.QuoRem(d, five, m); m.Sign() != 0 { break }
+        d, q = q, d
+        fives++
     }
-    b.WriteByte('}')
-    return b.String()
-}
-
-// decimal formatting to match tests:
-// use fixed 15 decimals then trim trailing zeros/dot
-func formatDecimal(f float64) string {
-    s := fmt.Sprintf("%.15f", f)
-    s = strings.TrimRight(s, "0")
-    if strings.HasSuffix(s, ".") { s = s[:len(s)-1] }
-    if s == "" { return "0" }
-    return s
-}
-
-func escapeForPrint(s string) string {
-    // Do not escape double-quotes; preserve them as-is to match tests
-    // Escape backslash, newline, tab for readability
-    s = strings.ReplaceAll(s, "\\", "\\\\")
-    s = strings.ReplaceAll(s, "\n", "\\n")
-    s = strings.ReplaceAll(s, "\t", "\\t")
+    if !d.IsInt64() || d.Int64() != 1 { return formatDecimal(f) }
+    s := r.FloatString(int(max(twos, fives)))
+    if strings.Contains(s, ".") { s = strings.TrimRight(strings.TrimRight(s, "0"), ".") }
     return s
 }
 
 func normalizeDecLiteralString(s string) string {
     s = strings.ReplaceAll(s, "_", "")
-    if i := strings.IndexByte(s, '.'); i >= 0 {
+    if i := strings.IndexByte(s, '.'); i >= 0 && !strings.ContainsAny(s, "eE") {
         // trim trailing zeros
         s = strings.TrimRight(s, "0")
         if strings.HasSuffix(s, ".") { s = s[:len(s)-1] }
@@ -99,50 +82,175 @@ func normalizeDecLiteralString(s string) string {
     return s
 }
 
+// shortLiteral reports whether a decimal literal has at most 15 significant
+// digits, so its float64 alone holds it (see dec.short).
+func shortLiteral(s string) bool {
+    n := 0
+    for _, c := range s {
+        if c == 'e' || c == 'E' { break }
+        if c < '0' || c > '9' || (n == 0 && c == '0') { continue }
+        n++
+    }
+    return n <= 15
+}
+
 // Environment with mutability
 type binding struct {
     val Value
     mut bool
+    set bool // the slot's let has run
 }
 
+// Env is a scope whose variables live in slots, indexed by the (depth, slot)
+// addresses the resolver gives identifiers; names holds each slot's name for
+// lookups by name. Scopes created from a resolved block share the block's
+// layout, copying it before a name is added at runtime (e.g. by an import).
 type Env struct {
-    store map[string]binding
+    slots []binding
+    names []string
+    owned bool // names is private to this env
     outer *Env
+    small [3]binding // backs slots for small scopes, saving an allocation
 }
 
-func NewEnv(outer *Env) *Env { return &Env{store: map[string]binding{}, outer: outer} }
+func NewEnv(outer *Env) *Env { return &Env{owned: true, outer: outer} }
+
+// newScopeEnv returns an env with unset slots for the given layout.
+func newScopeEnv(outer *Env, names []string) *Env {
+    e := &Env{names: names, outer: outer}
+    if len(names) <= len(e.small) { e.slots = e.small[:len(names)] } else { e.slots = make([]binding, len(names)) }
+    return e
+}
+
+func (e *Env) slot(name string) int { return lastIndex(e.names, name) }
+
+// reserve adds an unset slot for name, returning its index.
+func (e *Env) reserve(name string) int {
+    if !e.owned {
+        e.names = append([]string(nil), e.names...)
+        e.owned = true
+    }
+    e.names = append(e.names, name)
+    e.slots = append(e.slots, binding{})
+    return len(e.slots) - 1
+}
 
-func (e *Env) Define(name string, v Value, mutable bool) { e.store[name] = binding{val: v, mut: mutable} }
+func (e *Env) Define(name string, v Value, mutable bool) {
+    i := e.slot(name)
+    if i < 0 { i = e.reserve(name) }
+    e.slots[i] = binding{val: v, mut: mutable, set: true}
+}
 
 func (e *Env) Get(name string) (Value, error) {
-    if b, ok := e.store[name]; ok { return b.val, nil }
-    if e.outer != nil { return e.outer.Get(name) }
-    return nil, fmt.Errorf("Identifier can not be found: %s", name)
+    b, err := e.get(name)
+    return b.val, err
+}
+
+func (e *Env) get(name string) (binding, error) {
+    for cur := e; cur != nil; cur = cur.outer {
+        if i := cur.slot(name); i >= 0 && cur.slots[i].set { return cur.slots[i], nil }
+    }
+    return binding{}, fmt.Errorf("Identifier can not be found: %s", name)
 }
 
 func (e *Env) Assign(name string, v Value) error {
-    if b, ok := e.store[name]; ok {
-        if !b.mut { return fmt.Errorf("Variable '%s' is not mutable", name) }
-        e.store[name] = binding{val: v, mut: b.mut}
-        return nil
+    for cur := e; cur != nil; cur = cur.outer {
+        if i := cur.slot(name); i >= 0 && cur.slots[i].set { return cur.assignSlot(i, name, v) }
     }
-    if e.outer != nil { return e.outer.Assign(name, v) }
     return fmt.Errorf("Identifier can not be found: %s", name)
 }
 
+func (e *Env) assignSlot(i int, name string, v Value) error {
+    if !e.slots[i].mut { return fmt.Errorf("Variable '%s' is not mutable", name) }
+    e.slots[i].val = v
+    return nil
+}
+
+// at returns the env and slot a resolved name refers to, if that slot is
+// bound under the name; otherwise the caller falls back to a lookup by name.
+func (e *Env) at(name string, ref parser.Ref) (*Env, int, bool) {
+    if !ref.Resolved { return nil, 0, false }
+    t := e
+    for d := ref.Depth; d > 0 && t != nil; d-- { t = t.outer }
+    i := ref.Slot
+    if t == nil || i >= len(t.slots) || t.names[i] != name || !t.slots[i].set { return nil, 0, false }
+    return t, i, true
+}
+
+func (e *Env) lookup(name string, ref parser.Ref) (binding, error) {
+    if t, i, ok := e.at(name, ref); ok { return t.slots[i], nil }
+    return e.get(name)
+}
+
+func (e *Env) assign(name string, ref parser.Ref, v Value) error {
+    if t, i, ok := e.at(name, ref); ok { return t.assignSlot(i, name, v) }
+    return e.Assign(name, v)
+}
+
+// define binds a let's name, in its resolved slot when the env has one.
+func (e *Env) define(name string, ref parser.Ref, v Value, mutable bool) {
+    if i := ref.Slot; ref.Resolved && ref.Depth == 0 && i < len(e.slots) && e.names[i] == name {
+        e.slots[i] = binding{val: v, mut: mutable, set: true}
+        return
+    }
+    e.Define(name, v, mutable)
+}
+
+// each calls fn for every bound slot of the env, in slot order.
+func (e *Env) each(fn func(name string, b binding)) {
+    for i, b := range e.slots {
+        if b.set { fn(e.names[i], b) }
+    }
+}
+
 // Evaluator
 type Evaluator struct {
-    out io.Writer
-    env *Env
+    out       *bufio.Writer // puts output, flushed whenever Eval or EvalBlock returns
+    dst       io.Writer
+    env       *Env
+    stats     *Stats
+    ctx       context.Context
+    steps     uint64
+    sandboxed bool
+    depth     int    // nested user function calls
+    maxDepth  int    // 0 means unlimited
+    memLimit  uint64 // live heap limit in bytes, 0 means unlimited
+
+    builtins    *Env // root scope holding only the builtins
+    file        string
+    searchPaths []string
+    modules     map[string]*module
+    stdin       *stdinSource
+    args        []string
+    tracer      Tracer
+    rng         *rand.Rand // created on first use unless seeded
+    memo        *memoCache // set by SetAutoMemo
+    print       PrintMode  // how puts prints strings
+    strictIndex bool       // out-of-range list and string indexing fails
+    joinPuts    bool       // puts separates arguments without a trailing space
+    effects     uint64     // effectful builtin calls and mutable variable uses so far, see memoCache
+
+    fn     *userFunc // innermost user function being called, nil at top level
+    pos    lexer.Pos // start of the statement being evaluated
+    calls  []call    // user function calls in progress, innermost last
+    callAt lexer.Pos // the call being made, recorded by the function it calls
 }
 
 func New(w io.Writer) *Evaluator {
     env := NewEnv(nil)
-    ev := &Evaluator{out: w, env: env}
+    ev := &Evaluator{out: bufio.NewWriter(w), dst: w, env: env, stdin: &stdinSource{r: os.Stdin}}
     // Built-ins
-    env.Define("puts", newBuiltin("puts", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
-        for _, a := range args { fmt.Fprintf(ev.out, "%s ", a.repr()) }
-        fmt.Fprint(ev.out, "\n")
+    // puts(values...): each value followed by a space (the conformance tests
+    // expect the trailing one), or space separated with SetJoinPuts; puts()
+    // prints an empty line
+    env.Define("puts", newVariadicBuiltin("puts", 0, -1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        w := ev2.out
+        for i, a := range args {
+            if i > 0 && ev2.joinPuts { w.WriteByte(' ') }
+            writeValue(w, a, ev2.print)
+            if !ev2.joinPuts { w.WriteByte(' ') }
+        }
+        w.WriteByte('\n')
         return Nil{}, nil
     }), false)
     // Collections and utilities
@@ -153,7 +261,8 @@ func New(w io.Writer) *Evaluator {
             return x.Items[0], nil
         case Str:
             if len(x.V) == 0 { return Nil{}, nil }
-            return Str{V: x.V[:1]}, nil
+            _, n := utf8.DecodeRuneInString(x.V)
+            return Str{V: x.V[:n]}, nil
         default:
             return Nil{}, nil
         }
@@ -166,67 +275,64 @@ func New(w io.Writer) *Evaluator {
             copy(cp, x.Items[1:])
             return List{Items: cp}, nil
         case Str:
-            if len(x.V) == 0 { return Str{V: ""}, nil }
-            return Str{V: x.V[1:]}, nil
+            _, n := utf8.DecodeRuneInString(x.V)
+            return Str{V: x.V[n:]}, nil
         default:
             return Nil{}, nil
         }
     }), false)
     env.Define("size", newBuiltin("size", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
         switch x := args[0].(type) {
-        case List: return Int{V: int64(len(x.Items))}, nil
-        case Set: return Int{V: int64(len(x.Items))}, nil
-        case Dict: return Int{V: int64(len(x.Items))}, nil
-        case Str: return Int{V: int64(len(x.V))}, nil
-        default: return Int{V: 0}, nil
+        case List: return intValue(int64(len(x.Items))), nil
+        case Set: return intValue(int64(len(x.Items))), nil
+        case Dict: return intValue(int64(len(x.Items))), nil
+        case Str: return intValue(int64(utf8.RuneCountInString(x.V))), nil
+        case PQueue: return intValue(int64(x.size)), nil
+        case Deque: return intValue(int64(x.size())), nil
+        case Iterator:
+            // counted by walking it, so an infinite one never finishes
+            var n int64
+            err := each(ev2, x.open(), func(Value) (bool, error) { n++; return true, nil })
+            return intValue(n), err
+        default: return intValue(0), nil
         }
     }), false)
     env.Define("push", newBuiltin("push", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
         v := args[0]
         switch coll := args[1].(type) {
         case List:
-            cp := make([]Value, 0, len(coll.Items)+1)
-            cp = append(cp, coll.Items...)
-            cp = append(cp, v)
-            return List{Items: cp}, nil
+            return pushList(coll, v), nil
         case Set:
-            // add if not present (structural equality)
-            for _, it := range coll.Items { if equal(it, v) { return coll, nil } }
-            cp := make([]Value, 0, len(coll.Items)+1)
-            cp = append(cp, coll.Items...)
-            cp = append(cp, v)
-            return Set{Items: cp}, nil
+            return coll.with(v), nil
         default:
             return Nil{}, fmt.Errorf("Unsupported operation: %s push", typeName(args[1]))
         }
     }), false)
+    // get(i, coll): coll[i], but always nil when i is out of range
+    env.Define("get", newBuiltin("get", 2, func(ev2 *Evaluator, args []Value) (Value, error) { return indexValue(ev2, args[1], args[0]) }), false)
     env.Define("assoc", newBuiltin("assoc", 3, func(ev2 *Evaluator, args []Value) (Value, error) {
         key := args[0]
         val := args[1]
         dict, ok := args[2].(Dict)
         if !ok { return Nil{}, fmt.Errorf("assoc(...): invalid argument type, expected Dictionary, found %s", typeName(args[2])) }
         if _, isDict := key.(Dict); isDict { return Nil{}, fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
-        // copy and replace
-        replaced := false
-        out := make([]dictEntry, 0, len(dict.Items))
-        for _, e := range dict.Items {
-            if equal(e.Key, key) {
-                if !replaced { out = append(out, dictEntry{Key: key, Val: val}); replaced = true }
-            } else {
-                out = append(out, e)
-            }
-        }
-        if !replaced { out = append(out, dictEntry{Key: key, Val: val}) }
-        return Dict{Items: out}, nil
+        return dict.with(key, val), nil
     }), false)
-    // Higher-order list operations
+    // Higher-order operations, over any iterable (see iter.go)
     env.Define("map", newBuiltin("map", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
         fn, ok1 := args[0].(Function)
-        list, ok2 := args[1].(List)
+        next, ok2 := open(args[1])
         if !ok1 || !ok2 {
             a := typeName(args[0]); b := typeName(args[1])
             return nil, fmt.Errorf("Unexpected argument: map(%s, %s)", a, b)
         }
+        if it, lazy := args[1].(Iterator); lazy { return Iterator{open: func() cursor { return mapCursor(fn, it.open()) }}, nil }
+        list, ok := args[1].(List)
+        if !ok {
+            items, err := collect(ev2, mapCursor(fn, next))
+            if err != nil { return nil, err }
+            return List{Items: items}, nil
+        }
         out := make([]Value, 0, len(list.Items))
         for _, it := range list.Items {
             v, err := fn.call(ev2, []Value{it}); if err != nil { return nil, err }
@@ -236,11 +342,18 @@ func New(w io.Writer) *Evaluator {
     }), false)
     env.Define("filter", newBuiltin("filter", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
         fn, ok1 := args[0].(Function)
-        list, ok2 := args[1].(List)
+        next, ok2 := open(args[1])
         if !ok1 || !ok2 {
             a := typeName(args[0]); b := typeName(args[1])
             return nil, fmt.Errorf("Unexpected argument: filter(%s, %s)", a, b)
         }
+        if it, lazy := args[1].(Iterator); lazy { return Iterator{open: func() cursor { return filterCursor(fn, it.open()) }}, nil }
+        list, ok := args[1].(List)
+        if !ok {
+            items, err := collect(ev2, filterCursor(fn, next))
+            if err != nil { return nil, err }
+            return List{Items: items}, nil
+        }
         out := make([]Value, 0, len(list.Items))
         for _, it := range list.Items {
             v, err := fn.call(ev2, []Value{it}); if err != nil { return nil, err }
@@ -251,23 +364,44 @@ func New(w io.Writer) *Evaluator {
     env.Define("fold", newBuiltin("fold", 3, func(ev2 *Evaluator, args []Value) (Value, error) {
         acc := args[0]
         fn, ok1 := args[1].(Function)
-        list, ok2 := args[2].(List)
+        next, ok2 := open(args[2])
         if !ok1 || !ok2 {
             a := typeName(args[0]); b := typeName(args[1]); c := typeName(args[2])
             return nil, fmt.Errorf("Unexpected argument: fold(%s, %s, %s)", a, b, c)
         }
         cur := acc
-        for _, it := range list.Items {
-            v, err := fn.call(ev2, []Value{cur, it}); if err != nil { return nil, err }
+        err := each(ev2, next, func(it Value) (bool, error) {
+            v, err := fn.call(ev2, []Value{cur, it}); if err != nil { return false, err }
             cur = v
-        }
-        return cur, nil
+            return true, nil
+        })
+        return cur, err
     }), false)
     // Operator functions
     env.Define("+", newBuiltin("+", 2, func(ev2 *Evaluator, args []Value) (Value, error) { return ev.add(args[0], args[1]) }), false)
     env.Define("-", newBuiltin("-", 2, func(ev2 *Evaluator, args []Value) (Value, error) { return ev.sub(args[0], args[1]) }), false)
     env.Define("*", newBuiltin("*", 2, func(ev2 *Evaluator, args []Value) (Value, error) { return ev.mul(args[0], args[1]) }), false)
     env.Define("/", newBuiltin("/", 2, func(ev2 *Evaluator, args []Value) (Value, error) { return ev.div(args[0], args[1]) }), false)
+    env.Define("%", newBuiltin("%", 2, func(ev2 *Evaluator, args []Value) (Value, error) { return ev.mod(args[0], args[1]) }), false)
+    ev.defineIOBuiltins(env)
+    ev.defineModuleBuiltins(env)
+    ev.defineInspectBuiltins(env)
+    ev.defineRandomBuiltins(env)
+    ev.defineSetBuiltins(env)
+    ev.defineDictBuiltins(env)
+    ev.defineStringBuiltins(env)
+    ev.defineNumberBuiltins(env)
+    ev.defineGridBuiltins(env)
+    ev.definePQueueBuiltins(env)
+    ev.defineDequeBuiltins(env)
+    ev.defineTimeBuiltins(env)
+    ev.defineGraphBuiltins(env)
+    ev.defineLazyBuiltins(env)
+    ev.defineIterBuiltins(env)
+    ev.defineListBuiltins(env)
+    // program globals live in their own scope so modules never see them
+    ev.builtins = env
+    ev.env = NewEnv(env)
     return ev
 }
 
@@ -279,287 +413,177 @@ type builtinFunc func(args []Value) (Value, error)
 func (f builtinFunc) repr() string { return "|...| { [builtin] }" }
 func (f builtinFunc) call(ev *Evaluator, args []Value) (Value, error) { return f(args) }
 
-// builtin with arity and partial application support
+// builtin with arity and partial application support. A builtin taking min
+// to max arguments is partially applied while it has fewer than min, and
+// called as soon as it has at least min: optional arguments are only used
+// when given in the same call as the last required one, so `parse_int(s)`
+// parses s in base 10 rather than waiting for more. Optional arguments
+// therefore come before the required ones they qualify, keeping the
+// threaded value last: `s |> parse_int(16)`.
 type builtin struct {
     name  string
-    arity int
-    impl  func(ev *Evaluator, args []Value) (Value, error)
+    min   int // fewer arguments give a partial application
+    max   int // most arguments accepted, -1 for any number
+    impl  func(ev *Evaluator, args []Value) (Value, error) // called with min to max arguments
     pre   []Value
+    effectful bool // see memoCache
 }
 
 func (b *builtin) repr() string { return "|...| { [builtin] }" }
 func (b *builtin) call(ev *Evaluator, args []Value) (Value, error) {
     all := append(append([]Value{}, b.pre...), args...)
-    if len(all) < b.arity {
-        return &builtin{name: b.name, arity: b.arity, impl: b.impl, pre: all}, nil
+    if len(all) < b.min {
+        return &builtin{name: b.name, min: b.min, max: b.max, impl: b.impl, pre: all, effectful: b.effectful}, nil
     }
+    if err := b.checkArgs(len(args)); err != nil { return nil, err }
+    if ev.stats != nil { ev.stats.BuiltinCalls[b.name]++ }
+    if b.effectful { ev.effects++ }
     return b.impl(ev, all)
 }
 
+// checkArgs fails when n more arguments are more than b accepts.
+func (b *builtin) checkArgs(n int) error {
+    n += len(b.pre)
+    if b.max < 0 || n <= b.max { return nil }
+    expected := fmt.Sprint(b.max)
+    if b.min < b.max { expected = fmt.Sprintf("%d to %d", b.min, b.max) }
+    noun := "arguments"
+    if expected == "1" { noun = "argument" }
+    return fmt.Errorf("Expected %s %s to %s, found: %d", expected, noun, b.name, n)
+}
+
 func newBuiltin(name string, arity int, impl func(ev *Evaluator, args []Value) (Value, error)) Function {
-    return &builtin{name: name, arity: arity, impl: impl, pre: nil}
+    return newVariadicBuiltin(name, arity, arity, impl)
+}
+
+// newVariadicBuiltin is newBuiltin for a builtin taking from min up to max
+// arguments (any number when max is -1).
+func newVariadicBuiltin(name string, min, max int, impl func(ev *Evaluator, args []Value) (Value, error)) Function {
+    return &builtin{name: name, min: min, max: max, impl: impl, pre: nil, effectful: effectful[name]}
 }
 
-// Format produces the canonical printed representation for a value
-func Format(v Value) string { return v.repr() }
 
 // Public API
-func (ev *Evaluator) Eval(prog parser.Program) (Value, error) {
+func (ev *Evaluator) Eval(prog parser.Program) (_ Value, err error) {
+    defer ev.out.Flush()
+    defer crash.Recover("evaluation", &err)
     var last Value = Nil{}
-    // Top-level: evaluate statements; only last non-comment value returned
-    for _, st := range prog.Statements {
-        switch s := st.(type) {
-        case parser.CommentStmt:
-            // ignore for last value
-            continue
-        case parser.ExpressionStmt:
-            v, err := ev.evalExpr(s.Value)
-            if err != nil { return nil, err }
-            last = v
-        default:
-            // ignore unknown
-        }
+    // Top-level: only the last expression statement's value is returned
+    for _, run := range compileProgram(ev.resolveProgram(prog)) {
+        v, err := run(ev)
+        if err != nil { return nil, err }
+        last = v
     }
     return last, nil
 }
 
-func (ev *Evaluator) evalStmt(st parser.Statement) (Value, error) {
-    switch s := st.(type) {
-    case parser.ExpressionStmt:
-        return ev.evalExpr(s.Value)
-    case parser.CommentStmt:
-        return Nil{}, nil
-    default:
-        return Nil{}, nil
-    }
+// Tee copies everything the program prints with puts to w as well as to the
+// evaluator's output, letting embedders capture program output separately
+// from the value returned by Eval.
+func (ev *Evaluator) Tee(w io.Writer) {
+    ev.out.Flush()
+    ev.dst = io.MultiWriter(ev.dst, w)
+    ev.out = bufio.NewWriter(ev.dst)
 }
 
-func (ev *Evaluator) evalExpr(e parser.Expr) (Value, error) {
-    switch ex := e.(type) {
-    case parser.IntegerLit:
-        // remove underscores when parsing; strconv can handle, but here digits only
-        // value range fits into int64 for tests
-        var v int64 = 0
-        for i := 0; i < len(ex.Value); i++ {
-            c := ex.Value[i]
-            if c == '_' { continue }
-            v = v*10 + int64(c-'0')
-        }
-        return Int{V: v}, nil
-    case parser.DecimalLit:
-        // keep literal for printing; also parse to float for arithmetic
-        s := normalizeDecLiteralString(ex.Value)
-        var f float64
-        fmt.Sscanf(strings.ReplaceAll(s, "_", ""), "%f", &f)
-        return Dec{V: f, Lit: s}, nil
-    case parser.StringLit:
-        return Str{V: ex.Value}, nil
-    case parser.BooleanLit:
-        return Bool{V: ex.Value}, nil
-    case parser.NilLit:
-        return Nil{}, nil
-    case parser.Identifier:
-        v, err := ev.env.Get(ex.Name)
-        if err != nil { return nil, err }
-        return v, nil
-    case parser.FunctionLit:
-        params := make([]string, len(ex.Parameters))
-        for i, p := range ex.Parameters { params[i] = p.Name }
-        return &userFunc{params: params, body: ex.Body, env: ev.env}, nil
-    case parser.ListLit:
-        items := make([]Value, 0, len(ex.Items))
-        for _, it := range ex.Items { v, err := ev.evalExpr(it); if err != nil { return nil, err }; items = append(items, v) }
-        return List{Items: items}, nil
-    case parser.SetLit:
-        items := make([]Value, 0, len(ex.Items))
-        for _, it := range ex.Items {
-            v, err := ev.evalExpr(it); if err != nil { return nil, err }
-            if _, isDict := v.(Dict); isDict { return nil, fmt.Errorf("Unable to include a Dictionary within a Set") }
-            // dedupe
-            present := false
-            for _, e2 := range items { if equal(e2, v) { present = true; break } }
-            if !present { items = append(items, v) }
-        }
-        return Set{Items: items}, nil
-    case parser.DictLit:
-        items := make([]dictEntry, 0, len(ex.Items))
-        for _, it := range ex.Items {
-            k, err := ev.evalExpr(it.Key); if err != nil { return nil, err }
-            if _, isDict := k.(Dict); isDict { return nil, fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
-            v, err := ev.evalExpr(it.Value); if err != nil { return nil, err }
-            // override if duplicate key
-            replaced := false
-            for i := range items {
-                if equal(items[i].Key, k) { items[i].Val = v; replaced = true; break }
-            }
-            if !replaced { items = append(items, dictEntry{Key: k, Val: v}) }
-        }
-        return Dict{Items: items}, nil
-    case parser.LetExpr:
-        v, err := ev.evalExpr(ex.Value)
-        if err != nil { return nil, err }
-        mutable := (ex.Type == "MutableLet")
-        ev.env.Define(ex.Name.Name, v, mutable)
-        return v, nil
-    case parser.AssignExpr:
-        v, err := ev.evalExpr(ex.Value)
-        if err != nil { return nil, err }
-        if err := ev.env.Assign(ex.Name.Name, v); err != nil { return nil, err }
-        return v, nil
-    case parser.InfixExpr:
-        // evaluate logical with truthiness and short-circuit
-        if ex.Operator == "&&" {
-            l, err := ev.evalExpr(ex.Left); if err != nil { return nil, err }
-            if !isTruthy(l) { return Bool{V: false}, nil }
-            r, err := ev.evalExpr(ex.Right); if err != nil { return nil, err }
-            return Bool{V: isTruthy(r)}, nil
-        }
-        if ex.Operator == "||" {
-            l, err := ev.evalExpr(ex.Left); if err != nil { return nil, err }
-            if isTruthy(l) { return Bool{V: true}, nil }
-            r, err := ev.evalExpr(ex.Right); if err != nil { return nil, err }
-            return Bool{V: isTruthy(r)}, nil
-        }
-        l, err := ev.evalExpr(ex.Left); if err != nil { return nil, err }
-        r, err := ev.evalExpr(ex.Right); if err != nil { return nil, err }
-        switch ex.Operator {
-        case "+": return ev.add(l, r)
-        case "-": return ev.sub(l, r)
-        case "*": return ev.mul(l, r)
-        case "/": return ev.div(l, r)
-        case "==": return Bool{V: equal(l, r)}, nil
-        case "!=": return Bool{V: !equal(l, r)}, nil
-        case ">": return Bool{V: compare(l, r) > 0}, nil
-        case "<": return Bool{V: compare(l, r) < 0}, nil
-        case ">=": return Bool{V: compare(l, r) >= 0}, nil
-        case "<=": return Bool{V: compare(l, r) <= 0}, nil
-        default:
-            return nil, errors.New("Unsupported operator")
-        }
-    case parser.PrefixExpr:
-        v, err := ev.evalExpr(ex.Operand)
-        if err != nil { return nil, err }
-        switch t := v.(type) {
-        case Int:
-            return Int{V: -t.V}, nil
-        case Dec:
-            return Dec{V: -t.V}, nil
-        default:
-            return nil, fmt.Errorf("Unsupported operation: %s %s", ex.Operator, typeName(v))
-        }
-    case parser.CallExpr:
-        fn, err := ev.evalExpr(ex.Function)
-        if err != nil { return nil, err }
-        f, ok := fn.(Function)
-        if !ok { return nil, fmt.Errorf("Expected a Function, found: %s", typeName(fn)) }
-        args := make([]Value, 0, len(ex.Arguments))
-        for _, a := range ex.Arguments { v, err := ev.evalExpr(a); if err != nil { return nil, err }; args = append(args, v) }
-        return f.call(ev, args)
-    case parser.IfExpr:
-        cond, err := ev.evalExpr(ex.Condition)
-        if err != nil { return nil, err }
-        if isTruthy(cond) { return ev.evalBlock(ex.Consequence) }
-        return ev.evalBlock(ex.Alternative)
-    case parser.FunctionComposition:
-        funs := make([]Function, 0, len(ex.Functions))
-        for _, fe := range ex.Functions {
-            v, err := ev.evalExpr(fe); if err != nil { return nil, err }
-            f, ok := v.(Function); if !ok { return nil, fmt.Errorf("Expected a Function, found: %s", typeName(v)) }
-            funs = append(funs, f)
-        }
-        return &composedFunc{functions: funs}, nil
-    case parser.FunctionThread:
-        cur, err := ev.evalExpr(ex.Initial)
-        if err != nil { return nil, err }
-        for _, step := range ex.Functions {
-            if ce, ok := step.(parser.CallExpr); ok {
-                fnVal, err := ev.evalExpr(ce.Function)
-                if err != nil { return nil, err }
-                f, ok := fnVal.(Function); if !ok { return nil, fmt.Errorf("Expected a Function, found: %s", typeName(fnVal)) }
-                args := make([]Value, 0, len(ce.Arguments)+1)
-                for _, a := range ce.Arguments { v, err := ev.evalExpr(a); if err != nil { return nil, err }; args = append(args, v) }
-                args = append(args, cur)
-                cur, err = f.call(ev, args)
-                if err != nil { return nil, err }
-            } else {
-                v, err := ev.evalExpr(step); if err != nil { return nil, err }
-                f, ok := v.(Function); if !ok { return nil, fmt.Errorf("Expected a Function, found: %s", typeName(v)) }
-                cur, err = f.call(ev, []Value{cur})
-                if err != nil { return nil, err }
-            }
-        }
-        return cur, nil
-    case parser.IndexExpr:
-        left, err := ev.evalExpr(ex.Left)
-        if err != nil { return nil, err }
-        idxVal, err := ev.evalExpr(ex.Index)
-        if err != nil { return nil, err }
-        switch coll := left.(type) {
-        case List:
-            idx, ok := idxVal.(Int)
-            if !ok { return nil, fmt.Errorf("Unable to perform index operation, found: List[%s]", typeName(idxVal)) }
-            i := int(idx.V)
-            if i < 0 { i = len(coll.Items) + i }
-            if i < 0 || i >= len(coll.Items) { return Nil{}, nil }
-            return coll.Items[i], nil
-        case Str:
-            idx, ok := idxVal.(Int)
-            if !ok { return nil, fmt.Errorf("Unable to perform index operation, found: String[%s]", typeName(idxVal)) }
-            i := int(idx.V)
-            if i < 0 { i = len(coll.V) + i }
-            if i < 0 || i >= len(coll.V) { return Nil{}, nil }
-            return Str{V: coll.V[i : i+1]}, nil
-        case Dict:
-            if _, isDict := idxVal.(Dict); isDict { return nil, fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
-            for _, e := range coll.Items { if equal(e.Key, idxVal) { return e.Val, nil } }
-            return Nil{}, nil
-        default:
-            return Nil{}, nil
-        }
-    default:
-        // For stage-3, other expressions are not used
-        return Nil{}, nil
-    }
+// Flush writes out anything puts has buffered. Eval and EvalBlock flush
+// before returning, so embedders only need it when sharing the writer mid-run.
+func (ev *Evaluator) Flush() error { return ev.out.Flush() }
+
+// SetPrintMode sets how puts prints strings (canonical by default).
+func (ev *Evaluator) SetPrintMode(m PrintMode) { ev.print = m }
+
+// SetSortSets sets whether sets print in ascending order (the default) or
+// in the order their elements were added; see PrintInsertionOrder.
+func (ev *Evaluator) SetSortSets(on bool) {
+    if on { ev.print &^= PrintInsertionOrder } else { ev.print |= PrintInsertionOrder }
 }
 
-func (ev *Evaluator) evalBlock(b parser.Block) (Value, error) {
-    outer := ev.env
-    ev.env = NewEnv(outer)
-    defer func() { ev.env = outer }()
-    var last Value = Nil{}
-    for _, st := range b.Statements {
-        v, err := ev.evalStmt(st)
-        if err != nil { return nil, err }
-        last = v
+// PrintMode is how the evaluator prints strings; embedders printing its
+// results should use the same.
+func (ev *Evaluator) PrintMode() PrintMode { return ev.print }
+
+// SetStrictIndex makes indexing a List or String out of range fail with
+// "Index out of bounds" rather than give nil; get(i, coll) still gives nil.
+func (ev *Evaluator) SetStrictIndex(on bool) { ev.strictIndex = on }
+
+// SetJoinPuts makes puts separate its arguments with single spaces and end
+// the line without the trailing space the conformance tests expect.
+func (ev *Evaluator) SetJoinPuts(on bool) { ev.joinPuts = on }
+
+// Define binds an immutable name in the evaluator's current scope.
+func (ev *Evaluator) Define(name string, v Value) { ev.env.Define(name, v, false) }
+
+// Names returns every name visible from the evaluator's current scope,
+// builtins included.
+func (ev *Evaluator) Names() []string {
+    var names []string
+    for e := ev.env; e != nil; e = e.outer {
+        e.each(func(name string, _ binding) { names = append(names, name) })
     }
-    return last, nil
+    sort.Strings(names)
+    return names
+}
+
+// Lookup returns the value bound to name in the evaluator's current scope.
+func (ev *Evaluator) Lookup(name string) (Value, bool) {
+    v, err := ev.env.Get(name)
+    return v, err == nil
+}
+
+// EvalBlock evaluates a block (such as a section body) in a fresh child scope.
+func (ev *Evaluator) EvalBlock(b parser.Block) (_ Value, err error) {
+    defer ev.out.Flush()
+    defer crash.Recover("evaluation", &err)
+    return compileBlock(ev.resolveBlock(b))(ev)
 }
 
 // user-defined function with closure environment
 type userFunc struct {
-    params []string
-    body   parser.Block
+    params []string // slot layout of the call scope
+    bound  []Value  // arguments supplied by partial application
+    body   code // compiled body block
     env    *Env
+    name   string    // the name it was first bound to, if any
+    pos    lexer.Pos // where the function literal starts
+    impure bool      // a call had effects, so calls are not memoized
 }
 
 func (f *userFunc) repr() string { return "|...| { [function] }" }
+
+// describe names f for error reports.
+func (f *userFunc) describe() string {
+    if f.name == "" { return "an anonymous function" }
+    return f.name
+}
 func (f *userFunc) call(ev *Evaluator, args []Value) (Value, error) {
+    if len(f.bound) > 0 { args = append(append([]Value(nil), f.bound...), args...) }
     if len(args) < len(f.params) {
-        // partial application: bind provided args into a new env
-        newEnv := NewEnv(f.env)
-        for i, name := range f.params[:len(args)] { newEnv.Define(name, args[i], false) }
-        return &userFunc{params: f.params[len(args):], body: f.body, env: newEnv}, nil
+        // partial application: remember the provided args until the rest arrive
+        return &userFunc{params: f.params, bound: args, body: f.body, env: f.env, name: f.name, pos: f.pos}, nil
     }
-    callEnv := NewEnv(f.env)
+    if ev.memo != nil && !f.impure { return ev.memoCall(f, args) }
+    return f.invoke(ev, args)
+}
+
+// invoke runs the body with the parameters bound to args.
+func (f *userFunc) invoke(ev *Evaluator, args []Value) (Value, error) {
+    if ev.maxDepth > 0 && ev.depth >= ev.maxDepth { return nil, fmt.Errorf("Maximum call depth exceeded: %d", ev.maxDepth) }
+    ev.depth++
+    defer func() { ev.depth-- }()
+    callEnv := newScopeEnv(f.env, f.params)
     // bind parameters (ignore extras)
-    for i, name := range f.params {
-        callEnv.Define(name, args[i], false)
-    }
+    for i := range f.params { callEnv.slots[i] = binding{val: args[i], set: true} }
     // switch into function env
-    saved := ev.env
-    ev.env = callEnv
-    defer func() { ev.env = saved }()
-    return ev.evalBlock(f.body)
+    saved, savedFn, savedPos, savedAt := ev.env, ev.fn, ev.pos, ev.callAt
+    ev.env, ev.fn = callEnv, f
+    ev.calls = append(ev.calls, call{fn: f, at: ev.callAt, file: ev.file})
+    defer func() {
+        ev.env, ev.fn, ev.pos, ev.callAt = saved, savedFn, savedPos, savedAt
+        ev.calls = ev.calls[:len(ev.calls)-1]
+    }()
+    if ev.depth%segmentDepth == 0 { return onNewStack(func() (Value, error) { return f.body(ev) }) }
+    return f.body(ev)
 }
 
 // composed function applying functions left-to-right, passing result forward
@@ -585,21 +609,30 @@ func (ev *Evaluator) add(a, b Value) (Value, error) {
     switch x := a.(type) {
     case Int:
         switch y := b.(type) {
-        case Int: return Int{V: x.V + y.V}, nil
-        case Dec: return Dec{V: float64(x.V) + y.V}, nil
-        case Str: return Str{V: fmt.Sprintf("%s%s", x.repr(), y.V)}, nil
+        case Int:
+            if n, ok := addInt(x.V, y.V); ok { return intValue(n), nil }
+            return bigArith((*big.Int).Add, x, y), nil
+        case Big: return bigArith((*big.Int).Add, x, y), nil
+        case Dec: return decimal(decAdd, x, y, float64(x.V)+y.V), nil
+        case Str: return concat(x, y)
+        }
+    case Big:
+        switch y := b.(type) {
+        case Int, Big: return bigArith((*big.Int).Add, x, y), nil
+        case Dec: return decimal(decAdd, x, y, x.float()+y.V), nil
+        case Str: return concat(x, y)
         }
     case Dec:
         switch y := b.(type) {
-        case Int: return Dec{V: x.V + float64(y.V)}, nil
-        case Dec: return Dec{V: x.V + y.V}, nil
-        case Str: return Str{V: fmt.Sprintf("%s%s", formatDecimal(x.V), y.V)}, nil
+        case Int: return decimal(decAdd, x, y, x.V+float64(y.V)), nil
+        case Big: return decimal(decAdd, x, y, x.V+y.float()), nil
+        case Dec: return decimal(decAdd, x, y, x.V+y.V), nil
+        case Str: return concat(x, y)
         }
     case Str:
-        if y, ok := b.(Str); ok {
-            return Str{V: x.V + y.V}, nil
-        }
-        return Str{V: x.V + b.repr()}, nil
+        return concat(x, b)
+    case Bool, Nil:
+        if y, ok := b.(Str); ok { return concat(x, y) }
     case List:
         if y, ok := b.(List); ok {
             out := make([]Value, 0, len(x.Items)+len(y.Items))
@@ -610,30 +643,15 @@ func (ev *Evaluator) add(a, b Value) (Value, error) {
         return nil, fmt.Errorf("Unsupported operation: List + %s", typeName(b))
     case Set:
         if y, ok := b.(Set); ok {
-            out := make([]Value, 0, len(x.Items)+len(y.Items))
-            // union with structural equality
-            addIfMissing := func(v Value) {
-                for _, it := range out { if equal(it, v) { return } }
-                out = append(out, v)
-            }
-            for _, it := range x.Items { addIfMissing(it) }
-            for _, it := range y.Items { addIfMissing(it) }
-            return Set{Items: out}, nil
+            out := x
+            for _, it := range y.Items { out = out.with(it) }
+            return out, nil
         }
         return nil, fmt.Errorf("Unsupported operation: Set + %s", typeName(b))
     case Dict:
         if y, ok := b.(Dict); ok {
             // right-biased merge
-            out := make([]dictEntry, 0, len(x.Items)+len(y.Items))
-            for _, e := range x.Items { out = append(out, dictEntry{Key: e.Key, Val: e.Val}) }
-            for _, e := range y.Items {
-                replaced := false
-                for i := range out {
-                    if equal(out[i].Key, e.Key) { out[i].Val = e.Val; replaced = true; break }
-                }
-                if !replaced { out = append(out, dictEntry{Key: e.Key, Val: e.Val}) }
-            }
-            return Dict{Items: out}, nil
+            return x.merge(y), nil
         }
         return nil, fmt.Errorf("Unsupported operation: Dictionary + %s", typeName(b))
     }
@@ -644,13 +662,22 @@ func (ev *Evaluator) sub(a, b Value) (Value, error) {
     switch x := a.(type) {
     case Int:
         switch y := b.(type) {
-        case Int: return Int{V: x.V - y.V}, nil
-        case Dec: return Dec{V: float64(x.V) - y.V}, nil
+        case Int:
+            if n, ok := subInt(x.V, y.V); ok { return intValue(n), nil }
+            return bigArith((*big.Int).Sub, x, y), nil
+        case Big: return bigArith((*big.Int).Sub, x, y), nil
+        case Dec: return decimal(decSub, x, y, float64(x.V)-y.V), nil
+        }
+    case Big:
+        switch y := b.(type) {
+        case Int, Big: return bigArith((*big.Int).Sub, x, y), nil
+        case Dec: return decimal(decSub, x, y, x.float()-y.V), nil
         }
     case Dec:
         switch y := b.(type) {
-        case Int: return Dec{V: x.V - float64(y.V)}, nil
-        case Dec: return Dec{V: x.V - y.V}, nil
+        case Int: return decimal(decSub, x, y, x.V-float64(y.V)), nil
+        case Big: return decimal(decSub, x, y, x.V-y.float()), nil
+        case Dec: return decimal(decSub, x, y, x.V-y.V), nil
         }
     }
     return nil, fmt.Errorf("Unsupported operation: %s - %s", typeName(a), typeName(b))
@@ -676,13 +703,22 @@ func (ev *Evaluator) mul(a, b Value) (Value, error) {
     switch x := a.(type) {
     case Int:
         switch y := b.(type) {
-        case Int: return Int{V: x.V * y.V}, nil
-        case Dec: return Dec{V: float64(x.V) * y.V}, nil
+        case Int:
+            if n, ok := mulInt(x.V, y.V); ok { return intValue(n), nil }
+            return bigArith((*big.Int).Mul, x, y), nil
+        case Big: return bigArith((*big.Int).Mul, x, y), nil
+        case Dec: return decimal(decMul, x, y, float64(x.V)*y.V), nil
+        }
+    case Big:
+        switch y := b.(type) {
+        case Int, Big: return bigArith((*big.Int).Mul, x, y), nil
+        case Dec: return decimal(decMul, x, y, x.float()*y.V), nil
         }
     case Dec:
         switch y := b.(type) {
-        case Int: return Dec{V: x.V * float64(y.V)}, nil
-        case Dec: return Dec{V: x.V * y.V}, nil
+        case Int: return decimal(decMul, x, y, x.V*float64(y.V)), nil
+        case Big: return decimal(decMul, x, y, x.V*y.float()), nil
+        case Dec: return decimal(decMul, x, y, x.V*y.V), nil
         }
     }
     return nil, fmt.Errorf("Unsupported operation: %s * %s", typeName(a), typeName(b))
@@ -695,42 +731,102 @@ func (ev *Evaluator) div(a, b Value) (Value, error) {
         case Int:
             if y.V == 0 { return nil, fmt.Errorf("Division by zero") }
             // trunc toward zero
-            return Int{V: x.V / y.V}, nil
+            if n, ok := divInt(x.V, y.V); ok { return intValue(n), nil }
+            return bigArith((*big.Int).Quo, x, y), nil
+        case Big: return bigArith((*big.Int).Quo, x, y), nil
         case Dec:
             if y.V == 0 { return nil, fmt.Errorf("Division by zero") }
-            return Dec{V: float64(x.V) / y.V}, nil
+            return decimal(decQuo, x, y, float64(x.V)/y.V), nil
+        }
+    case Big:
+        switch y := b.(type) {
+        case Int:
+            if y.V == 0 { return nil, fmt.Errorf("Division by zero") }
+            return bigArith((*big.Int).Quo, x, y), nil
+        case Big: return bigArith((*big.Int).Quo, x, y), nil
+        case Dec:
+            if y.V == 0 { return nil, fmt.Errorf("Division by zero") }
+            return decimal(decQuo, x, y, x.float()/y.V), nil
         }
     case Dec:
         switch y := b.(type) {
         case Int:
             if y.V == 0 { return nil, fmt.Errorf("Division by zero") }
-            return Dec{V: x.V / float64(y.V)}, nil
+            return decimal(decQuo, x, y, x.V/float64(y.V)), nil
+        case Big: return decimal(decQuo, x, y, x.V/y.float()), nil
         case Dec:
             if y.V == 0 { return nil, fmt.Errorf("Division by zero") }
-            return Dec{V: x.V / y.V}, nil
+            return decimal(decQuo, x, y, x.V/y.V), nil
         }
     }
     return nil, fmt.Errorf("Unsupported operation: %s / %s", typeName(a), typeName(b))
 }
 
-func equal(a, b Value) bool { return compare(a, b) == 0 }
+// mod is the remainder of Integer division, which truncates toward zero, so
+// it takes a's sign: -7 % 2 is -1, as divmod gives.
+func (ev *Evaluator) mod(a, b Value) (Value, error) {
+    switch x := a.(type) {
+    case Int:
+        switch y := b.(type) {
+        case Int:
+            if y.V == 0 { return nil, fmt.Errorf("Division by zero") }
+            return intValue(x.V % y.V), nil
+        case Big: return bigArith((*big.Int).Rem, x, y), nil
+        }
+    case Big:
+        switch y := b.(type) {
+        case Int:
+            if y.V == 0 { return nil, fmt.Errorf("Division by zero") }
+            return bigArith((*big.Int).Rem, x, y), nil
+        case Big: return bigArith((*big.Int).Rem, x, y), nil
+        }
+    }
+    return nil, fmt.Errorf("Unsupported operation: %s %% %s", typeName(a), typeName(b))
+}
+
+// equal is structural equality. Numbers compare by value, so an Int equals
+// the Dec of the same number (1 == 1.0) and the two are one member of a Set
+// or one key of a Dict: the first stored keeps its place and type, a later
+// one only replaces a key's value. Two Sets are equal when they have the
+// same members, found through their hash indexes in linear time.
+func equal(a, b Value) bool {
+    if x, ok := a.(Set); ok {
+        if y, ok := b.(Set); ok { return x.equals(y) }
+    }
+    return compare(a, b) == 0
+}
+
+// Equal reports whether two values are structurally equal.
+func Equal(a, b Value) bool { return equal(a, b) }
 
 func compare(a, b Value) int {
     switch x := a.(type) {
     case Int:
         switch y := b.(type) {
         case Int: if x.V < y.V { return -1 } ; if x.V > y.V { return 1 }; return 0
+        case Big: return -y.V.Sign() // beyond int64, so past x either way
+        case Dec:
+            if y.R != nil { return compareRat(x, y) }
+            return compareIntDec(x.V, y.V)
+        }
+    case Big:
+        switch y := b.(type) {
+        case Int: return x.V.Sign()
+        case Big: return x.V.Cmp(y.V)
         case Dec:
-            f := float64(x.V)
-            if f < y.V { return -1 } ; if f > y.V { return 1 }; return 0
+            if y.R != nil { return compareRat(x, y) }
+            return compareBigDec(x.V, y.V)
         }
     case Dec:
+        if x.R != nil {
+            if _, ok := toFloat(b); ok { return compareRat(x, b) }
+        }
         switch y := b.(type) {
-        case Int:
-            f := float64(y.V)
-            if x.V < f { return -1 } ; if x.V > f { return 1 }; return 0
+        case Int: return -compareIntDec(y.V, x.V)
+        case Big: return -compareBigDec(y.V, x.V)
         case Dec:
-            if x.V < y.V { return -1 } ; if x.V > y.V { return 1 }; return 0
+            if y.R != nil { return compareRat(x, y) }
+            return compareFloat(x.V, y.V)
         }
     case Str:
         if y, ok := b.(Str); ok {
@@ -744,6 +840,10 @@ func compare(a, b Value) int {
         }
     case Nil:
         if _, ok := b.(Nil); ok { return 0 }
+    case Regex:
+        if y, ok := b.(Regex); ok { return strings.Compare(x.re.String(), y.re.String()) }
+    case Deque:
+        if y, ok := b.(Deque); ok { return compare(x.list(), y.list()) }
     case List:
         if y, ok := b.(List); ok {
             // lexicographic compare by elements then length
@@ -757,8 +857,7 @@ func compare(a, b Value) int {
     case Set:
         if y, ok := b.(Set); ok {
             // compare sorted elements lexicographically then length
-            aItems := make([]Value, len(x.Items)); copy(aItems, x.Items); sort.Slice(aItems, func(i, j int) bool { return compare(aItems[i], aItems[j]) < 0 })
-            bItems := make([]Value, len(y.Items)); copy(bItems, y.Items); sort.Slice(bItems, func(i, j int) bool { return compare(bItems[i], bItems[j]) < 0 })
+            aItems, bItems := x.ordered(), y.ordered()
             n := len(aItems); m := len(bItems)
             for i := 0; i < n && i < m; i++ {
                 c := compare(aItems[i], bItems[i])
@@ -769,8 +868,7 @@ func compare(a, b Value) int {
     case Dict:
         if y, ok := b.(Dict); ok {
             // compare by sorted key-value pairs
-            aItems := make([]dictEntry, len(x.Items)); copy(aItems, x.Items); sort.Slice(aItems, func(i, j int) bool { return compare(aItems[i].Key, aItems[j].Key) < 0 })
-            bItems := make([]dictEntry, len(y.Items)); copy(bItems, y.Items); sort.Slice(bItems, func(i, j int) bool { return compare(bItems[i].Key, bItems[j].Key) < 0 })
+            aItems, bItems := x.ordered(), y.ordered()
             n := len(aItems); m := len(bItems)
             for i := 0; i < n && i < m; i++ {
                 ck := compare(aItems[i].Key, bItems[i].Key)
@@ -786,6 +884,55 @@ func compare(a, b Value) int {
     if ta < tb { return -1 } ; if ta > tb { return 1 } ; return 0
 }
 
+// compareIntDec orders an Int and a Dec exactly, rather than after rounding
+// the Int to a float64, so no two distinct Ints equal the same Dec. NaN
+// comes after every Int, as compareFloat puts it after every number.
+func compareIntDec(i int64, f float64) int {
+    switch {
+    case math.IsNaN(f): return -1
+    case f >= math.MaxInt64: return -1 // 2⁶³ and beyond
+    case f < math.MinInt64: return 1
+    }
+    t := math.Trunc(f)
+    if n := int64(t); i != n {
+        if i < n { return -1 }
+        return 1
+    }
+    if f > t { return -1 } ; if f < t { return 1 }; return 0
+}
+
+// compareRat orders two numbers by their exact values, for a Decimal its
+// float64 only approximates; an infinite or NaN one has none, and the two
+// compare as float64s.
+func compareRat(a, b Value) int {
+    x, ok1 := exact(a)
+    y, ok2 := exact(b)
+    if ok1 && ok2 { return x.Cmp(y) }
+    f, _ := toFloat(a)
+    g, _ := toFloat(b)
+    return compareFloat(f, g)
+}
+
+// compareFloat orders two float64s with NaN equal to itself and after every
+// other number, so that equal stays an equivalence hashValue agrees with
+// and sorting numbers is a total order.
+func compareFloat(a, b float64) int {
+    switch {
+    case a < b: return -1
+    case a > b: return 1
+    case a == b: return 0
+    case math.IsNaN(a) && math.IsNaN(b): return 0
+    case math.IsNaN(a): return 1
+    }
+    return -1
+}
+
+// compareBigDec is compareIntDec for a Big.
+func compareBigDec(i *big.Int, f float64) int {
+    if math.IsNaN(f) { return -1 }
+    return new(big.Float).SetInt(i).Cmp(big.NewFloat(f))
+}
+
 func isTruthy(v Value) bool {
     switch x := v.(type) {
     case Int: return x.V != 0
@@ -796,13 +943,15 @@ func isTruthy(v Value) bool {
     case List: return len(x.Items) > 0
     case Set: return len(x.Items) > 0
     case Dict: return len(x.Items) > 0
+    case PQueue: return x.size > 0
+    case Deque: return x.size() > 0
     default: return true
     }
 }
 
 func typeName(v Value) string {
     switch v.(type) {
-    case Int: return "Integer"
+    case Int, Big: return "Integer"
     case Dec: return "Decimal"
     case Str: return "String"
     case Bool: return "Boolean"
@@ -811,6 +960,11 @@ func typeName(v Value) string {
     case Set: return "Set"
     case Dict: return "Dictionary"
     case Function: return "Function"
+    case Regex: return "Regex"
+    case PQueue: return "PriorityQueue"
+    case Deque: return "Deque"
+    case Delayed: return "Delayed"
+    case Iterator: return "Iterator"
     default: return "Unknown"
     }
 }
@@ -0,0 +1,37 @@
+package evaluator
+
+import (
+    "io"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+// testCase is a program and either its formatted result or, when err is
+// set, the error it fails with.
+type testCase struct{ src, want, err string }
+
+// runCases evaluates each case after prelude in a fresh evaluator.
+func runCases(t *testing.T, prelude string, tests []testCase) {
+    t.Helper()
+    for _, tt := range tests {
+        prog, err := parser.Parse(prelude + tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        v, err := New(io.Discard).Eval(prog)
+        if tt.err != "" {
+            if err == nil || err.Error() != tt.err { t.Errorf("%s: got error %v, want %s", tt.src, err, tt.err) }
+            continue
+        }
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        if got := Format(v); got != tt.want { t.Errorf("%s: got %s, want %s", tt.src, got, tt.want) }
+    }
+}
+
+func eval(t *testing.T, src string) Value {
+    t.Helper()
+    prog, err := parser.Parse(src)
+    if err != nil { t.Fatalf("%s: %v", src, err) }
+    v, err := New(io.Discard).Eval(prog)
+    if err != nil { t.Fatalf("%s: %v", src, err) }
+    return v
+}
@@ -0,0 +1,174 @@
+package evaluator
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// PrintMode selects how strings are printed, optionally combined with
+// PrintInsertionOrder. Otherwise the rest of a value prints the same.
+type PrintMode int
+
+const (
+    // PrintCanonical is the language's printed form: strings in double
+    // quotes with backslash, newline and tab escaped as \\, \n and \t.
+    // Embedded double quotes are left as they are, so "\"" prints as """.
+    PrintCanonical PrintMode = iota
+    // PrintEscaped also escapes double quotes, carriage returns and NULs, so
+    // every printed string is a string literal that reads back as the same
+    // string.
+    PrintEscaped
+    // PrintRaw prints strings as they are, without quotes or escapes.
+    PrintRaw
+)
+
+// PrintInsertionOrder, added to one of the modes above, prints a set's
+// elements in the order they were added instead of ascending.
+const PrintInsertionOrder PrintMode = 1 << 8
+
+var printModes = []string{"canonical", "escaped", "raw"}
+
+func (m PrintMode) String() string {
+    if m&PrintInsertionOrder != 0 { return printModes[m.strings()] + "+insertion-order" }
+    return printModes[m]
+}
+
+// strings is m without PrintInsertionOrder: how it prints strings.
+func (m PrintMode) strings() PrintMode { return m &^ PrintInsertionOrder }
+
+// ParsePrintMode returns the mode named name; empty means canonical.
+func ParsePrintMode(name string) (PrintMode, error) {
+    if name == "" { return PrintCanonical, nil }
+    for i, n := range printModes {
+        if n == name { return PrintMode(i), nil }
+    }
+    return 0, fmt.Errorf("unknown print mode %q (canonical, escaped, raw)", name)
+}
+
+// Format produces the canonical printed representation for a value
+func Format(v Value) string { return PrintCanonical.Format(v) }
+
+// WriteValue streams the canonical printed representation of v to w, without
+// building the string for a large collection in memory first.
+func WriteValue(w io.Writer, v Value) error { return PrintCanonical.Write(w, v) }
+
+// Format is the printed representation of v in mode m.
+func (m PrintMode) Format(v Value) string {
+    var b strings.Builder
+    writeValue(&b, v, m)
+    return b.String()
+}
+
+// Write streams the printed representation of v in mode m to w.
+func (m PrintMode) Write(w io.Writer, v Value) error {
+    bw := bufio.NewWriter(w)
+    writeValue(bw, v, m)
+    return bw.Flush()
+}
+
+// valueWriter is satisfied by both *bufio.Writer and *strings.Builder.
+type valueWriter interface {
+    io.ByteWriter
+    io.StringWriter
+}
+
+func writeValue(w valueWriter, v Value, m PrintMode) {
+    switch x := v.(type) {
+    case Str:
+        writeString(w, x.V, m)
+    case List:
+        w.WriteByte('[')
+        for i, it := range x.Items {
+            if i > 0 { w.WriteString(", ") }
+            writeValue(w, it, m)
+        }
+        w.WriteByte(']')
+    case Set:
+        // Print in ascending order by value, unless asked for insertion order
+        items := x.Items
+        if m&PrintInsertionOrder == 0 { items = x.ordered() }
+        w.WriteByte('{')
+        for i, it := range items {
+            if i > 0 { w.WriteString(", ") }
+            writeValue(w, it, m)
+        }
+        w.WriteByte('}')
+    case Dict:
+        // Print ascending order by key
+        w.WriteString("#{")
+        for i, it := range x.ordered() {
+            if i > 0 { w.WriteString(", ") }
+            writeValue(w, it.Key, m)
+            w.WriteString(": ")
+            writeValue(w, it.Val, m)
+        }
+        w.WriteByte('}')
+    default:
+        w.WriteString(v.repr())
+    }
+}
+
+func writeString(w valueWriter, s string, m PrintMode) {
+    if m.strings() == PrintRaw {
+        w.WriteString(s)
+        return
+    }
+    w.WriteByte('"')
+    start := 0
+    for i := 0; i < len(s); i++ {
+        var esc string
+        switch s[i] {
+        case '\\': esc = `\\`
+        case '\n': esc = `\n`
+        case '\t': esc = `\t`
+        case '"': if m.strings() == PrintEscaped { esc = `\"` }
+        case '\r': if m.strings() == PrintEscaped { esc = `\r` }
+        case 0: if m.strings() == PrintEscaped { esc = `\0` }
+        }
+        if esc == "" { continue }
+        w.WriteString(s[start:i])
+        w.WriteString(esc)
+        start = i + 1
+    }
+    w.WriteString(s[start:])
+    w.WriteByte('"')
+}
+
+// sortedView caches the order a Set or Dict prints and compares its items
+// in. Values are immutable, so the items are sorted at most once per value;
+// a nil view (a value built without newSet or newDict) sorts on every call.
+type sortedView[T any] struct {
+    once  sync.Once
+    items []T
+}
+
+// newSet wraps items, which hold no duplicates.
+func newSet(items []Value) Set { return Set{Items: items, sorted: &sortedView[Value]{}, index: newHashIndex(len(items), func(i int) uint64 { return hashValue(items[i]) })} }
+
+// newDict wraps items, whose keys are distinct.
+func newDict(items []dictEntry) Dict {
+    return Dict{Items: items, sorted: &sortedView[dictEntry]{}, index: newHashIndex(len(items), func(i int) uint64 { return hashValue(items[i].Key) })}
+}
+
+// ordered returns the set's items in ascending order.
+func (s Set) ordered() []Value { return s.sorted.get(s.Items, func(a, b Value) bool { return compare(a, b) < 0 }) }
+
+// ordered returns the dictionary's entries in ascending key order.
+func (d Dict) ordered() []dictEntry { return d.sorted.get(d.Items, func(a, b dictEntry) bool { return compare(a.Key, b.Key) < 0 }) }
+
+func (s *sortedView[T]) get(items []T, less func(a, b T) bool) []T {
+    if s == nil { return sortedCopy(items, less) }
+    s.once.Do(func() { s.items = sortedCopy(items, less) })
+    return s.items
+}
+
+func sortedCopy[T any](items []T, less func(a, b T) bool) []T {
+    out := make([]T, len(items))
+    copy(out, items)
+    sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+    return out
+}
@@ -0,0 +1,155 @@
+package evaluator
+
+import "fmt"
+
+// The traversals take a function from a node to its neighbours and return
+// what they found as #{"dist": dist, "prev": prev}: dist maps each node
+// reached to its distance from the start, and prev to the node it was
+// reached from (nil for the start), for path to walk back along. Nodes can
+// be any value a Dict can key.
+
+type search struct {
+    name       string
+    ev         *Evaluator
+    neighbours Function
+    dist, prev Dict
+}
+
+func newSearch(ev *Evaluator, name string, args []Value) (*search, error) {
+    fn, ok := args[0].(Function)
+    if !ok { return nil, fmt.Errorf("Unexpected argument: %s(%s, %s)", name, typeName(args[0]), typeName(args[1])) }
+    return &search{name: name, ev: ev, neighbours: fn, dist: newDict(nil), prev: newDict(nil)}, nil
+}
+
+func (s *search) seen(n Value) bool { return s.dist.find(hashValue(n), n) >= 0 }
+
+func (s *search) reach(n, from, d Value) error {
+    if _, isDict := n.(Dict); isDict { return fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
+    s.dist.put(n, d)
+    s.prev.put(n, from)
+    return nil
+}
+
+// next calls the neighbours function on n, checking it gave a list.
+func (s *search) next(n Value) ([]Value, error) {
+    v, err := s.neighbours.call(s.ev, []Value{n})
+    if err != nil { return nil, err }
+    l, ok := v.(List)
+    if !ok { return nil, fmt.Errorf("Expected a List from the %s neighbours function, found: %s", s.name, typeName(v)) }
+    return l.Items, nil
+}
+
+func (s *search) result() Value {
+    out := newDict(nil)
+    out.put(Str{V: "dist"}, s.dist)
+    out.put(Str{V: "prev"}, s.prev)
+    return out
+}
+
+// bfs visits nodes in order of their distance in edges from the start.
+func (s *search) bfs(start Value) error {
+    if err := s.reach(start, Nil{}, intValue(0)); err != nil { return err }
+    for queue := []Value{start}; len(queue) > 0; queue = queue[1:] {
+        n := queue[0]
+        ns, err := s.next(n)
+        if err != nil { return err }
+        d, _ := s.dist.lookup(n)
+        for _, m := range ns {
+            if s.seen(m) { continue }
+            if err := s.reach(m, n, intValue(d.(Int).V+1)); err != nil { return err }
+            queue = append(queue, m)
+        }
+    }
+    return nil
+}
+
+// dfs goes as deep as it can before backtracking, visiting neighbours in
+// the order given; a node's distance is its depth in the resulting tree.
+// It keeps its own stack, so long paths can't overflow Go's.
+func (s *search) dfs(start Value) error {
+    type frame struct {
+        n    Value
+        next []Value // neighbours still to try
+    }
+    if err := s.reach(start, Nil{}, intValue(0)); err != nil { return err }
+    ns, err := s.next(start)
+    if err != nil { return err }
+    stack := []frame{{start, ns}}
+    for len(stack) > 0 {
+        top := &stack[len(stack)-1]
+        if len(top.next) == 0 { stack = stack[:len(stack)-1]; continue }
+        m := top.next[0]
+        top.next = top.next[1:]
+        if s.seen(m) { continue }
+        if err := s.reach(m, top.n, intValue(int64(len(stack)))); err != nil { return err }
+        ns, err := s.next(m)
+        if err != nil { return err }
+        stack = append(stack, frame{m, ns})
+    }
+    return nil
+}
+
+// dijkstra visits nodes in order of their cheapest total cost from the
+// start. The neighbours function gives [node, cost] pairs, costs being
+// non-negative numbers.
+func (s *search) dijkstra(start Value) error {
+    q := PQueue{}.push(intValue(0), List{Items: []Value{start, Nil{}}})
+    done := newDict(nil)
+    for q.root != nil {
+        d, v, rest := q.pop()
+        q = rest
+        n, from := v.(List).Items[0], v.(List).Items[1]
+        if done.find(hashValue(n), n) >= 0 { continue }
+        if err := s.reach(n, from, d); err != nil { return err }
+        done.put(n, Nil{})
+        ns, err := s.next(n)
+        if err != nil { return err }
+        for _, e := range ns {
+            pair, ok := e.(List)
+            if !ok || len(pair.Items) != 2 { return fmt.Errorf("Expected a [node, cost] pair from the dijkstra neighbours function, found: %s", typeName(e)) }
+            m, cost := pair.Items[0], pair.Items[1]
+            if c, ok := toFloat(cost); !ok || c < 0 { return fmt.Errorf("Expected a non-negative cost from the dijkstra neighbours function, found: %s", Format(cost)) }
+            if done.find(hashValue(m), m) >= 0 { continue }
+            total, err := s.ev.add(d, cost)
+            if err != nil { return err }
+            q = q.push(total, List{Items: []Value{m, n}})
+        }
+    }
+    return nil
+}
+
+func (ev *Evaluator) defineGraphBuiltins(env *Env) {
+    // bfs(neighbours, start), dfs(neighbours, start) and
+    // dijkstra(neighbours, start): the nodes reachable from start
+    for name, run := range map[string]func(s *search, start Value) error{
+        "bfs": (*search).bfs,
+        "dfs": (*search).dfs,
+        "dijkstra": (*search).dijkstra,
+    } {
+        env.Define(name, newBuiltin(name, 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+            s, err := newSearch(ev2, name, args)
+            if err != nil { return nil, err }
+            if err := run(s, args[1]); err != nil { return nil, err }
+            return s.result(), nil
+        }), false)
+    }
+    // path(to, result): the nodes from the start of a traversal to to, or
+    // nil when it wasn't reached
+    env.Define("path", newBuiltin("path", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        r, ok := args[1].(Dict)
+        var prev Value
+        if ok { prev, ok = r.lookup(Str{V: "prev"}) }
+        prevs, isDict := prev.(Dict)
+        if !ok || !isDict { return nil, fmt.Errorf("Unexpected argument: path(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        var nodes []Value
+        for n := args[0]; ; {
+            p, ok := prevs.lookup(n)
+            if !ok { return Nil{}, nil }
+            nodes = append(nodes, n)
+            if _, isNil := p.(Nil); isNil { break }
+            n = p
+        }
+        for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 { nodes[i], nodes[j] = nodes[j], nodes[i] }
+        return List{Items: nodes}, nil
+    }), false)
+}
@@ -0,0 +1,29 @@
+package evaluator
+
+import "testing"
+
+func TestGraph(t *testing.T) {
+    prelude := `let edges = #{"a": ["b", "c"], "b": ["d"], "c": ["d"], "d": [], "e": ["a"]};
+let next = |n| edges[n];
+let costs = #{"a": [["b", 1], ["c", 5]], "b": [["c", 1], ["d", 7]], "c": [["d", 1]], "d": []};
+let cost = |n| costs[n];
+`
+    tests := []testCase{
+        {`bfs(next, "a")["dist"]`, `#{"a": 0, "b": 1, "c": 1, "d": 2}`, ""},
+        {`"a" |> bfs(next) |> path("d")`, `["a", "b", "d"]`, ""},
+        {`path("e", bfs(next, "a"))`, `nil`, ""},
+        {`path("a", bfs(next, "a"))`, `["a"]`, ""},
+        {`dfs(next, "a")["dist"]`, `#{"a": 0, "b": 1, "c": 1, "d": 2}`, ""},
+        {`dfs(next, "e")["prev"]`, `#{"a": "e", "b": "a", "c": "a", "d": "b", "e": nil}`, ""},
+        {`dijkstra(cost, "a")["dist"]`, `#{"a": 0, "b": 1, "c": 2, "d": 3}`, ""},
+        {`dijkstra(cost, "a") |> path("d")`, `["a", "b", "c", "d"]`, ""},
+        {`dijkstra(|n| if n < 3 { [[n + 1, 0.5]] } else { [] }, 0)["dist"][3]`, `1.5`, ""},
+        // a long path, deeper than a recursive search would comfortably go
+        {`size(dfs(|n| if n < 100000 { [n + 1] } else { [] }, 0)["dist"])`, `100001`, ""},
+        {`bfs(|n| n, 1)`, "", "Expected a List from the bfs neighbours function, found: Integer"},
+        {`dijkstra(|n| [n], 1)`, "", "Expected a [node, cost] pair from the dijkstra neighbours function, found: Integer"},
+        {`dijkstra(|n| [[2, -1]], 1)`, "", "Expected a non-negative cost from the dijkstra neighbours function, found: -1"},
+        {`bfs(1, 2)`, "", "Unexpected argument: bfs(Integer, Integer)"},
+    }
+    runCases(t, prelude, tests)
+}
@@ -0,0 +1,180 @@
+package evaluator
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Grids come in two shapes: a Dict from [x, y] to the character there, as
+// parse_grid builds for lookups and walks, and a List of rows (Lists, or
+// Strings read as lists of characters) for transpose and rotate. x grows
+// to the right and y downwards, matching how puzzle input reads.
+
+// position unpacks an [x, y] list of Integers.
+func position(v Value) (x, y int64, ok bool) {
+    l, ok := v.(List)
+    if !ok || len(l.Items) != 2 { return 0, 0, false }
+    xi, ok1 := l.Items[0].(Int)
+    yi, ok2 := l.Items[1].(Int)
+    return xi.V, yi.V, ok1 && ok2
+}
+
+func positions(x, y int64, offsets [][2]int64) List {
+    items := make([]Value, len(offsets))
+    for i, d := range offsets { items[i] = List{Items: []Value{intValue(x + d[0]), intValue(y + d[1])}} }
+    return List{Items: items}
+}
+
+// the neighbours of a position, in reading order
+var (
+    orthogonal = [][2]int64{{0, -1}, {-1, 0}, {1, 0}, {0, 1}}
+    surrounding = [][2]int64{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+)
+
+// rows unpacks a list of rows, reporting whether they were Strings so the
+// result can be put back the same way.
+func rows(name string, v Value) (out [][]Value, strs bool, err error) {
+    l, ok := v.(List)
+    if !ok { return nil, false, fmt.Errorf("Unexpected argument: %s(%s)", name, typeName(v)) }
+    out = make([][]Value, len(l.Items))
+    if len(l.Items) > 0 { _, strs = l.Items[0].(Str) }
+    for i, r := range l.Items {
+        switch x := r.(type) {
+        case List: out[i] = x.Items
+        case Str:
+            for _, c := range x.V { out[i] = append(out[i], Str{V: string(c)}) }
+        default: return nil, false, fmt.Errorf("Unexpected argument: %s(List of %s)", name, typeName(r))
+        }
+        if _, isStr := r.(Str); isStr != strs { return nil, false, fmt.Errorf("Unexpected argument: %s(List of List and String)", name) }
+        if len(out[i]) != len(out[0]) { return nil, false, fmt.Errorf("Rows passed to %s differ in length: %d and %d", name, len(out[0]), len(out[i])) }
+    }
+    return out, strs, nil
+}
+
+// unrows is the inverse of rows.
+func unrows(rs [][]Value, strs bool) List {
+    items := make([]Value, len(rs))
+    for i, r := range rs {
+        if !strs { items[i] = List{Items: r}; continue }
+        var b strings.Builder
+        for _, c := range r { b.WriteString(c.(Str).V) }
+        items[i] = Str{V: b.String()}
+    }
+    return List{Items: items}
+}
+
+// vector unpacks a list of numbers, such as a 2D or 3D position.
+func vector(v Value) ([]Value, bool) {
+    l, ok := v.(List)
+    if !ok { return nil, false }
+    for _, it := range l.Items {
+        if _, ok := toFloat(it); !ok { return nil, false }
+    }
+    return l.Items, true
+}
+
+// vectors unpacks the two vectors name was given, which must be the same
+// length.
+func vectors(name string, args []Value) (a, b []Value, err error) {
+    a, ok1 := vector(args[0])
+    b, ok2 := vector(args[1])
+    if !ok1 || !ok2 { return nil, nil, fmt.Errorf("Unexpected argument: %s(%s, %s)", name, typeName(args[0]), typeName(args[1])) }
+    if len(a) != len(b) { return nil, nil, fmt.Errorf("Vectors passed to %s differ in length: %d and %d", name, len(a), len(b)) }
+    return a, b, nil
+}
+
+// elementwise applies op to the items of a and b at each position.
+func elementwise(a, b []Value, op func(x, y Value) (Value, error)) (Value, error) {
+    out := make([]Value, len(a))
+    for i := range a {
+        v, err := op(a[i], b[i])
+        if err != nil { return nil, err }
+        out[i] = v
+    }
+    return List{Items: out}, nil
+}
+
+func transpose(rs [][]Value) [][]Value {
+    if len(rs) == 0 { return rs }
+    out := make([][]Value, len(rs[0]))
+    for x := range out {
+        out[x] = make([]Value, len(rs))
+        for y, r := range rs { out[x][y] = r[x] }
+    }
+    return out
+}
+
+func (ev *Evaluator) defineGridBuiltins(env *Env) {
+    // parse_grid(s): each character of s keyed by its [x, y], lines being rows
+    env.Define("parse_grid", newBuiltin("parse_grid", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        s, ok := args[0].(Str)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: parse_grid(%s)", typeName(args[0])) }
+        var items []dictEntry
+        for y, line := range strings.Split(strings.TrimSuffix(s.V, "\n"), "\n") {
+            x := 0
+            for _, c := range strings.TrimSuffix(line, "\r") {
+                items = append(items, dictEntry{Key: List{Items: []Value{intValue(int64(x)), intValue(int64(y))}}, Val: Str{V: string(c)}})
+                x++
+            }
+        }
+        return newDict(items), nil
+    }), false)
+    // neighbours(pos): the four positions sharing an edge with [x, y]
+    env.Define("neighbours", newBuiltin("neighbours", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        x, y, ok := position(args[0])
+        if !ok { return nil, fmt.Errorf("Unexpected argument: neighbours(%s)", typeName(args[0])) }
+        return positions(x, y, orthogonal), nil
+    }), false)
+    // neighbours8(pos): the eight positions sharing an edge or corner with [x, y]
+    env.Define("neighbours8", newBuiltin("neighbours8", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        x, y, ok := position(args[0])
+        if !ok { return nil, fmt.Errorf("Unexpected argument: neighbours8(%s)", typeName(args[0])) }
+        return positions(x, y, surrounding), nil
+    }), false)
+    // transpose(rows): columns become rows
+    env.Define("transpose", newBuiltin("transpose", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        rs, strs, err := rows("transpose", args[0])
+        if err != nil { return nil, err }
+        return unrows(transpose(rs), strs), nil
+    }), false)
+    // rotate(rows): the grid turned a quarter clockwise
+    env.Define("rotate", newBuiltin("rotate", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        rs, strs, err := rows("rotate", args[0])
+        if err != nil { return nil, err }
+        out := transpose(rs)
+        for _, r := range out {
+            for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 { r[i], r[j] = r[j], r[i] }
+        }
+        return unrows(out, strs), nil
+    }), false)
+    // vadd(a, b) and vsub(a, b): the sum and difference of two vectors,
+    // equal-length lists of numbers such as [x, y] or [x, y, z]
+    for name, op := range map[string]func(ev *Evaluator, x, y Value) (Value, error){"vadd": (*Evaluator).add, "vsub": (*Evaluator).sub} {
+        env.Define(name, newBuiltin(name, 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+            a, b, err := vectors(name, args)
+            if err != nil { return nil, err }
+            return elementwise(a, b, func(x, y Value) (Value, error) { return op(ev2, x, y) })
+        }), false)
+    }
+    // vscale(k, v): vector v with every component multiplied by k
+    env.Define("vscale", newBuiltin("vscale", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        _, ok1 := toFloat(args[0])
+        v, ok2 := vector(args[1])
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: vscale(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        return elementwise(v, v, func(x, _ Value) (Value, error) { return ev2.mul(args[0], x) })
+    }), false)
+    // manhattan(a, b): the sum of the absolute differences between the
+    // components of two vectors
+    env.Define("manhattan", newBuiltin("manhattan", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        a, b, err := vectors("manhattan", args)
+        if err != nil { return nil, err }
+        var sum Value = intValue(0)
+        for i := range a {
+            d, err := ev2.sub(a[i], b[i])
+            if err != nil { return nil, err }
+            if f, _ := toFloat(d); f < 0 { d, _ = ev2.sub(intValue(0), d) }
+            if sum, err = ev2.add(sum, d); err != nil { return nil, err }
+        }
+        return sum, nil
+    }), false)
+}
@@ -0,0 +1,30 @@
+package evaluator
+
+import "testing"
+
+func TestGrid(t *testing.T) {
+    tests := []testCase{
+        {`parse_grid("#.\n.#\n")`, `#{[0, 0]: "#", [0, 1]: ".", [1, 0]: ".", [1, 1]: "#"}`, ""},
+        {`parse_grid("ab\r\nc")[[1, 0]]`, `"b"`, ""},
+        {`neighbours([1, 1])`, `[[1, 0], [0, 1], [2, 1], [1, 2]]`, ""},
+        {`neighbours8([0, 0]) |> size`, `8`, ""},
+        {`neighbours8([0, 0]) |> first`, `[-1, -1]`, ""},
+        {`transpose([[1, 2, 3], [4, 5, 6]])`, `[[1, 4], [2, 5], [3, 6]]`, ""},
+        {`transpose(["ab", "cd"])`, `["ac", "bd"]`, ""},
+        {`rotate([[1, 2], [3, 4]])`, `[[3, 1], [4, 2]]`, ""},
+        {`["abc"] |> rotate`, `["a", "b", "c"]`, ""},
+        {`rotate([])`, `[]`, ""},
+        {`vadd([1, 2], [3, -4])`, `[4, -2]`, ""},
+        {`vsub([1, 2, 3], [1, 1, 1])`, `[0, 1, 2]`, ""},
+        {`[[0, 1], [1, 0]] |> map(vscale(3))`, `[[0, 3], [3, 0]]`, ""},
+        {`vscale(0.5, [2, 4])`, `[1, 2]`, ""},
+        {`manhattan([1, 1], [-2, 5])`, `7`, ""},
+        {`manhattan([0, 0, 0], [1.5, -1, 0])`, `2.5`, ""},
+        {`neighbours([1])`, "", "Unexpected argument: neighbours(List)"},
+        {`vadd([1, 2], [1, 2, 3])`, "", "Vectors passed to vadd differ in length: 2 and 3"},
+        {`manhattan([1, "a"], [1, 2])`, "", "Unexpected argument: manhattan(List, List)"},
+        {`transpose([[1], "a"])`, "", "Unexpected argument: transpose(List of List and String)"},
+        {`rotate([[1, 2], [3]])`, "", "Rows passed to rotate differ in length: 2 and 1"},
+    }
+    runCases(t, "", tests)
+}
@@ -0,0 +1,98 @@
+package evaluator
+
+import (
+    "hash/maphash"
+    "math"
+    "sync"
+)
+
+// hashIndex maps the hashes of a Set's items, or a Dict's keys, to their
+// positions so lookups need no scan. Like a List's tail (see listTail), it is
+// shared by the versions of a collection built from one another: positions
+// below a version's length never change, and only the newest version
+// claims the next position and extends the index in place.
+type hashIndex struct {
+    mu    sync.RWMutex
+    n     int            // positions indexed, the length of the newest version
+    heads map[uint64]int // hash to the last position with it, plus one
+    chain []int          // position to the previous one with its hash, plus one
+}
+
+// newHashIndex indexes positions [0, n), hashed by hash.
+func newHashIndex(n int, hash func(i int) uint64) *hashIndex {
+    idx := &hashIndex{n: n, heads: make(map[uint64]int, n), chain: make([]int, 0, n)}
+    for i := 0; i < n; i++ { idx.add(hash(i)) }
+    return idx
+}
+
+func (idx *hashIndex) add(h uint64) {
+    idx.chain = append(idx.chain, idx.heads[h])
+    idx.heads[h] = len(idx.chain)
+}
+
+// find returns the first position below n hashing to h that match accepts,
+// or -1. The caller holds the lock.
+func (idx *hashIndex) find(n int, h uint64, match func(i int) bool) int {
+    for i := idx.heads[h] - 1; i >= 0; i = idx.chain[i] - 1 {
+        if i < n && match(i) { return i }
+    }
+    return -1
+}
+
+// claim indexes position n under h when a version of length n is the newest,
+// reporting whether it was; the caller holds the write lock.
+func (idx *hashIndex) claim(n int, h uint64) bool {
+    if idx.n != n { return false }
+    idx.add(h)
+    idx.n++
+    return true
+}
+
+var hashSeed = maphash.MakeSeed()
+
+// hashValue hashes v consistently with equal: equal values hash alike, so
+// an Int and the Dec of the same number do too.
+func hashValue(v Value) uint64 {
+    switch x := v.(type) {
+    case Int: return hashFloat(float64(x.V))
+    case Big: return hashFloat(x.float())
+    case Dec: return hashFloat(x.V)
+    case Str: return maphash.String(hashSeed, x.V)
+    case Bool:
+        if x.V { return 1 }
+        return 2
+    case Nil: return 3
+    case List:
+        h := uint64(17)
+        for _, it := range x.Items { h = mix(h*31 + hashValue(it)) }
+        return h
+    case Set:
+        // order-independent: a sum of the item hashes
+        h := uint64(19)
+        for _, it := range x.Items { h += hashValue(it) }
+        return mix(h)
+    case Dict:
+        h := uint64(23)
+        for _, e := range x.Items { h += mix(hashValue(e.Key)*31 + hashValue(e.Val)) }
+        return mix(h)
+    case Deque: return mix(hashValue(x.list()) + 29)
+    }
+    // values of other types compare equal by type name alone, see compare
+    return maphash.String(hashSeed, typeName(v))
+}
+
+func hashFloat(f float64) uint64 {
+    if f == 0 { return 0 } // 0.0 and -0.0
+    if math.IsNaN(f) { return 4 }
+    return mix(math.Float64bits(f))
+}
+
+// mix is the splitmix64 finalizer.
+func mix(h uint64) uint64 {
+    h ^= h >> 30
+    h *= 0xbf58476d1ce4e5b9
+    h ^= h >> 27
+    h *= 0x94d049bb133111eb
+    return h ^ h>>31
+}
+
@@ -0,0 +1,124 @@
+package evaluator
+
+import "testing"
+
+// eval returns the value of src, failing the test on any error.
+func TestHashConsistentWithEqual(t *testing.T) {
+    prelude := "let inf = 1e308 * 10;\nlet nan = inf - inf;\n"
+    tests := []struct{ a, b string; equal bool }{
+        {"1", "1.0", true},
+        {"1", "1.5", false},
+        {"0.0", "-0.0", true},
+        {"0", "-0.0", true},
+        {"nan", "nan", true},
+        {"nan", "1", false},
+        {"nan", "1.5", false},
+        {"nan", "inf", false},
+        {"nan", "18446744073709551616", false},
+        {"inf", "1e308 * 100", true},
+        {"18446744073709551616", "18446744073709551616.0", true},
+        {"18446744073709551616", "18446744073709551617", false},
+        {"18446744073709551616", "9223372036854775807", false},
+        // 2⁵³ + 1 has no float64, but the Decimal keeps its exact value
+        {"9007199254740993", "9007199254740993.0", true},
+        {"9007199254740992", "9007199254740993.0", false},
+        // exact Decimals equal only the same exact value
+        {"1.0 / 3", "1.0 / 3", true},
+        {"1.0 / 3", "0.3333333333333333", false},
+        {"0.1 + 0.2", "0.3", true},
+        {`"a"`, `"a"`, true},
+        {"[1, 2.0]", "[1.0, 2]", true},
+        {"[1, 2]", "[2, 1]", false},
+        {"{1, 2.0}", "{2, 1.0}", true},
+        {"#{1: 2.0}", "#{1.0: 2}", true},
+        {"#{1: 2}", "#{1: 3}", false},
+    }
+    for _, tt := range tests {
+        a, b := eval(t, prelude+tt.a), eval(t, prelude+tt.b)
+        if got := equal(a, b); got != tt.equal { t.Errorf("%s == %s: got %v, want %v", tt.a, tt.b, got, tt.equal) }
+        if got := equal(b, a); got != tt.equal { t.Errorf("%s == %s: got %v, want %v", tt.b, tt.a, got, tt.equal) }
+        if tt.equal && hashValue(a) != hashValue(b) { t.Errorf("%s and %s are equal but hash differently", tt.a, tt.b) }
+    }
+}
+
+func TestSetMembership(t *testing.T) {
+    prelude := "let inf = 1e308 * 10;\nlet nan = inf - inf;\n"
+    tests := []struct{ src, want string }{
+        {"{1, 1.0, 2}", "{1, 2}"},
+        {"{0.0, -0.0, 0}", "{0}"},
+        {"{nan, nan, 1}", "{1, NaN}"},
+        {"[contains?(nan, {1}), contains?(nan, {nan}), contains?(1, {nan})]", "[false, true, false]"},
+        {"{18446744073709551616, 18446744073709551616.0}", "{18446744073709551616}"},
+        {"[nan, 2, -inf, 1] |> sort", "[-Inf, 1, 2, NaN]"},
+    }
+    for _, tt := range tests {
+        if got := Format(eval(t, prelude+tt.src)); got != tt.want { t.Errorf("%s: got %s, want %s", tt.src, got, tt.want) }
+    }
+}
+
+// Two versions pushed onto one parent: the first claims the shared index,
+// the second copies, and neither sees the other's member.
+func TestSetFork(t *testing.T) {
+    parent := newSet([]Value{Int{V: 1}}).with(Int{V: 2})
+    a := parent.with(Int{V: 3})
+    b := parent.with(Int{V: 4})
+    if a.index != parent.index { t.Error("the first push did not share the parent's index") }
+    if b.index == parent.index { t.Error("the second push shared the parent's index") }
+    for _, tt := range []struct{ s Set; v int64; want bool }{
+        {parent, 1, true}, {parent, 3, false}, {parent, 4, false},
+        {a, 3, true}, {a, 4, false},
+        {b, 4, true}, {b, 3, false}, {b, 2, true},
+    } {
+        if got := tt.s.contains(Int{V: tt.v}); got != tt.want { t.Errorf("%s contains %d: got %v", Format(tt.s), tt.v, got) }
+    }
+    // each version goes on growing its own index
+    a2, b2 := a.with(Int{V: 5}), b.with(Int{V: 5})
+    if a2.index != a.index || b2.index != b.index { t.Error("the newest versions did not claim their indexes") }
+    if Format(a2) != "{1, 2, 3, 5}" || Format(b2) != "{1, 2, 4, 5}" { t.Errorf("got %s and %s", Format(a2), Format(b2)) }
+    if a.contains(Int{V: 5}) || parent.contains(Int{V: 3}) { t.Error("an older version sees a later member") }
+    // pushing a member returns the set unchanged
+    if again := a.with(Dec{V: 3}); len(again.Items) != 3 || again.index != a.index { t.Errorf("got %s", Format(again)) }
+}
+
+func TestDictKeys(t *testing.T) {
+    prelude := "let inf = 1e308 * 10;\nlet nan = inf - inf;\n"
+    tests := []struct{ src, want string }{
+        {"#{1: \"a\", 1.0: \"b\"}", `#{1: "b"}`},
+        {"#{0.0: 1} |> assoc(-0.0, 2) |> assoc(0, 3)", "#{0: 3}"},
+        {"#{nan: 1, 1: 2}[nan]", "1"},
+        {"[#{nan: 1}[1], #{1: 1}[nan]]", "[nil, nil]"},
+        {"#{18446744073709551616: 1}[18446744073709551616.0]", "1"},
+        {"#{[1, 2]: 1}[[1.0, 2.0]]", "1"},
+        {"#{{1, 2}: 1}[{2, 1}]", "1"},
+    }
+    for _, tt := range tests {
+        if got := Format(eval(t, prelude+tt.src)); got != tt.want { t.Errorf("%s: got %s, want %s", tt.src, got, tt.want) }
+    }
+}
+
+// Dict's version of TestSetFork, with a replaced value sharing the index too.
+func TestDictFork(t *testing.T) {
+    parent := newDict([]dictEntry{{Key: Str{V: "a"}, Val: Int{V: 1}}}).with(Str{V: "b"}, Int{V: 2})
+    a := parent.with(Str{V: "c"}, Int{V: 3})
+    b := parent.with(Str{V: "d"}, Int{V: 4})
+    if a.index != parent.index { t.Error("the first assoc did not share the parent's index") }
+    if b.index == parent.index { t.Error("the second assoc shared the parent's index") }
+    for _, tt := range []struct{ d Dict; k, want string }{
+        {parent, "a", "1"}, {parent, "c", "nil"}, {parent, "d", "nil"},
+        {a, "c", "3"}, {a, "d", "nil"},
+        {b, "d", "4"}, {b, "c", "nil"}, {b, "b", "2"},
+    } {
+        got := "nil"
+        if v, ok := tt.d.lookup(Str{V: tt.k}); ok { got = Format(v) }
+        if got != tt.want { t.Errorf("%s[%q]: got %s, want %s", Format(tt.d), tt.k, got, tt.want) }
+    }
+    a2, b2 := a.with(Str{V: "e"}, Int{V: 5}), b.with(Str{V: "e"}, Int{V: 6})
+    if a2.index != a.index || b2.index != b.index { t.Error("the newest versions did not claim their indexes") }
+    if _, ok := a.lookup(Str{V: "e"}); ok { t.Error("an older version sees a later key") }
+    if v, _ := b2.lookup(Str{V: "e"}); Format(v) != "6" { t.Errorf("got %v", v) }
+    // replacing a value copies the entries but keeps the index
+    r := a2.with(Str{V: "a"}, Int{V: 10})
+    if r.index != a2.index { t.Error("replacing a value did not share the index") }
+    if v, _ := r.lookup(Str{V: "a"}); Format(v) != "10" { t.Errorf("got %v", v) }
+    if v, _ := a2.lookup(Str{V: "a"}); Format(v) != "1" { t.Errorf("the original changed to %v", v) }
+}
@@ -0,0 +1,33 @@
+package evaluator
+
+import "fmt"
+
+// bindingsOf returns the names visible from env mapped to their values, the
+// innermost binding winning when a name is shadowed. The builtins scope is
+// skipped unless withBuiltins is set.
+func (ev *Evaluator) bindingsOf(env *Env, withBuiltins bool) Dict {
+    seen := map[string]bool{}
+    var items []dictEntry
+    for e := env; e != nil; e = e.outer {
+        if e == ev.builtins && !withBuiltins { break }
+        e.each(func(name string, b binding) {
+            if seen[name] { return }
+            seen[name] = true
+            items = append(items, dictEntry{Key: Str{V: name}, Val: b.val})
+        })
+    }
+    return newDict(items)
+}
+
+func (ev *Evaluator) defineInspectBuiltins(env *Env) {
+    // bindings() or bindings(true) to include the builtins
+    env.Define("bindings", newVariadicBuiltin("bindings", 0, 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        withBuiltins := false
+        if len(args) > 0 {
+            b, ok := args[0].(Bool)
+            if !ok { return nil, fmt.Errorf("Unexpected argument: bindings(%s)", typeName(args[0])) }
+            withBuiltins = b.V
+        }
+        return ev2.bindingsOf(ev2.env, withBuiltins), nil
+    }), false)
+}
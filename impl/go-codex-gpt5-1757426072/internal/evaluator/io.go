@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const aocScheme = "aoc://"
+
+// ReadSource reads the contents of a local file or an `aoc://<year>/<day>`
+// puzzle input URL.
+func ReadSource(path string) (string, error) {
+    if strings.HasPrefix(path, aocScheme) {
+        parts := strings.Split(strings.TrimPrefix(path, aocScheme), "/")
+        if len(parts) != 2 { return "", fmt.Errorf("Invalid AoC input URL: %s (expected aoc://<year>/<day>)", path) }
+        year, err1 := strconv.Atoi(parts[0])
+        day, err2 := strconv.Atoi(parts[1])
+        if err1 != nil || err2 != nil { return "", fmt.Errorf("Invalid AoC input URL: %s (expected aoc://<year>/<day>)", path) }
+        return FetchAoCInput(year, day)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil { return "", fmt.Errorf("Unable to read: %s", path) }
+    return string(data), nil
+}
+
+// FetchAoCInput returns the puzzle input for the given day, downloading it
+// with the AOC_SESSION token on first use and caching it under ~/.cache/elf.
+func FetchAoCInput(year, day int) (string, error) {
+    if day < 1 || day > 25 { return "", fmt.Errorf("Invalid AoC day: %d", day) }
+    cachePath, cacheErr := aocCachePath(year, day)
+    if cacheErr == nil {
+        if data, err := os.ReadFile(cachePath); err == nil { return string(data), nil }
+    }
+    session := os.Getenv("AOC_SESSION")
+    if session == "" { return "", errors.New("AOC_SESSION must be set to download puzzle inputs") }
+    url := fmt.Sprintf("https://adventofcode.com/%d/day/%d/input", year, day)
+    req, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil { return "", err }
+    req.AddCookie(&http.Cookie{Name: "session", Value: session})
+    req.Header.Set("User-Agent", "elf-lang (github.com/eddmann/santa-lang-workshop)")
+    client := &http.Client{Timeout: 30 * time.Second}
+    resp, err := client.Do(req)
+    if err != nil { return "", fmt.Errorf("Unable to download AoC input %d/%d: %v", year, day, err) }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(resp.Body)
+    if err != nil { return "", fmt.Errorf("Unable to download AoC input %d/%d: %v", year, day, err) }
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("Unable to download AoC input %d/%d: %s", year, day, resp.Status)
+    }
+    // puzzle inputs always end with a single newline which is never wanted
+    input := strings.TrimSuffix(string(body), "\n")
+    if cacheErr == nil {
+        // caching is best-effort; a failed write only costs a re-download
+        if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err == nil {
+            _ = os.WriteFile(cachePath, []byte(input), 0o644)
+        }
+    }
+    return input, nil
+}
+
+func aocCachePath(year, day int) (string, error) {
+    dir, err := os.UserCacheDir()
+    if err != nil { return "", err }
+    return filepath.Join(dir, "elf", "aoc", strconv.Itoa(year), fmt.Sprintf("%02d.txt", day)), nil
+}
+
+// stdinSource reads piped standard input at most once, on first use.
+type stdinSource struct {
+    r    io.Reader
+    once sync.Once
+    data string
+    err  error
+}
+
+func (s *stdinSource) read() (string, error) {
+    s.once.Do(func() {
+        data, err := io.ReadAll(s.r)
+        s.data, s.err = string(data), err
+    })
+    return s.data, s.err
+}
+
+// SetStdin replaces the reader the stdin() builtin consumes (os.Stdin by default).
+func (ev *Evaluator) SetStdin(r io.Reader) { ev.stdin = &stdinSource{r: r} }
+
+// SetArgs sets the command-line arguments returned by the args() builtin.
+func (ev *Evaluator) SetArgs(args []string) { ev.args = args }
+
+func (ev *Evaluator) defineIOBuiltins(env *Env) {
+    env.Define("args", newBuiltin("args", 0, func(ev2 *Evaluator, args []Value) (Value, error) {
+        items := make([]Value, len(ev2.args))
+        for i, a := range ev2.args { items[i] = Str{V: a} }
+        return List{Items: items}, nil
+    }), false)
+    env.Define("stdin", newBuiltin("stdin", 0, func(ev2 *Evaluator, args []Value) (Value, error) {
+        if err := ev2.checkSandbox("stdin"); err != nil { return nil, err }
+        // a prompt printed before reading must be visible
+        ev2.out.Flush()
+        s, err := ev2.stdin.read()
+        if err != nil { return nil, fmt.Errorf("Unable to read stdin: %v", err) }
+        return Str{V: s}, nil
+    }), false)
+    env.Define("read", newBuiltin("read", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        if err := ev2.checkSandbox("read"); err != nil { return nil, err }
+        path, ok := args[0].(Str)
+        if !ok { return nil, fmt.Errorf("read(...): invalid argument type, expected String, found %s", typeName(args[0])) }
+        s, err := ReadSource(path.V)
+        if err != nil { return nil, err }
+        return Str{V: s}, nil
+    }), false)
+    env.Define("read_aoc", newBuiltin("read_aoc", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        if err := ev2.checkSandbox("read_aoc"); err != nil { return nil, err }
+        year, ok1 := args[0].(Int)
+        day, ok2 := args[1].(Int)
+        if !ok1 || !ok2 {
+            return nil, fmt.Errorf("Unexpected argument: read_aoc(%s, %s)", typeName(args[0]), typeName(args[1]))
+        }
+        s, err := FetchAoCInput(int(year.V), int(day.V))
+        if err != nil { return nil, err }
+        return Str{V: s}, nil
+    }), false)
+}
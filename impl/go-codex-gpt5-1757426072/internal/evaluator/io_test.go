@@ -0,0 +1,76 @@
+package evaluator
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+func TestReadSource(t *testing.T) {
+    // no cached inputs and no session, so nothing is ever downloaded
+    t.Setenv("XDG_CACHE_HOME", t.TempDir())
+    t.Setenv("AOC_SESSION", "")
+    file := filepath.Join(t.TempDir(), "input.txt")
+    if err := os.WriteFile(file, []byte("1\n2\n"), 0o644); err != nil { t.Fatal(err) }
+    tests := []struct{ path, want, err string }{
+        {file, "1\n2\n", ""},
+        {file + ".missing", "", "Unable to read: " + file + ".missing"},
+        {"aoc://2022", "", "Invalid AoC input URL: aoc://2022 (expected aoc://<year>/<day>)"},
+        {"aoc://2022/7/1", "", "Invalid AoC input URL: aoc://2022/7/1 (expected aoc://<year>/<day>)"},
+        {"aoc://2022/seven", "", "Invalid AoC input URL: aoc://2022/seven (expected aoc://<year>/<day>)"},
+        {"aoc:///7", "", "Invalid AoC input URL: aoc:///7 (expected aoc://<year>/<day>)"},
+        {"aoc://2022/0", "", "Invalid AoC day: 0"},
+        {"aoc://2022/26", "", "Invalid AoC day: 26"},
+        {"aoc://2022/7", "", "AOC_SESSION must be set to download puzzle inputs"},
+    }
+    for _, tt := range tests {
+        got, err := ReadSource(tt.path)
+        if tt.err != "" {
+            if err == nil || err.Error() != tt.err { t.Errorf("%s: got error %v, want %s", tt.path, err, tt.err) }
+            continue
+        }
+        if err != nil || got != tt.want { t.Errorf("%s: got %q, %v, want %q", tt.path, got, err, tt.want) }
+    }
+}
+
+func TestAoCCache(t *testing.T) {
+    cache := t.TempDir()
+    t.Setenv("XDG_CACHE_HOME", cache)
+    // without a session a cache miss fails rather than downloading
+    t.Setenv("AOC_SESSION", "")
+    dir := filepath.Join(cache, "elf", "aoc", "2022")
+    if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(dir, "07.txt"), []byte("cached"), 0o644); err != nil { t.Fatal(err) }
+
+    if got, err := ReadSource("aoc://2022/7"); err != nil || got != "cached" { t.Errorf("aoc://2022/7: got %q, %v, want cached", got, err) }
+    if got := Format(eval(t, "read_aoc(2022, 7)")); got != `"cached"` { t.Errorf("read_aoc(2022, 7): got %s, want \"cached\"", got) }
+}
+
+// countingReader counts how often it is read from.
+type countingReader struct {
+    io.Reader
+    reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+    r.reads++
+    return r.Reader.Read(p)
+}
+
+func TestStdin(t *testing.T) {
+    prog, err := parser.Parse("let a = stdin();\nlet b = stdin();\n[a, b, a == b]")
+    if err != nil { t.Fatal(err) }
+    in := &countingReader{Reader: strings.NewReader("1\n2\n")}
+    ev := New(io.Discard)
+    ev.SetStdin(in)
+    if in.reads != 0 { t.Errorf("stdin read %d times before use", in.reads) }
+    v, err := ev.Eval(prog)
+    if err != nil { t.Fatal(err) }
+    if got, want := Format(v), `["1\n2\n", "1\n2\n", true]`; got != want { t.Errorf("got %s, want %s", got, want) }
+    // one read for the data, one for EOF, and none for the second call
+    if in.reads != 2 { t.Errorf("stdin read %d times, want 2", in.reads) }
+}
@@ -0,0 +1,327 @@
+package evaluator
+
+import "fmt"
+
+// Iteration protocol. Every collection, and the Iterator values iterate,
+// unfold, range and the `..` operators make, can be walked with a cursor,
+// which is what map, filter, fold, take, skip and to_list consume. map,
+// filter and skip keep a List a List and an Iterator an Iterator (so
+// infinite ones stay usable), and give a List for anything else. Sets are
+// walked in ascending order, strings by character and dictionaries as
+// [key, value] pairs in insertion order.
+
+// cursor returns the next item and true, or false once exhausted.
+type cursor func(ev *Evaluator) (Value, bool, error)
+
+// Iterator is a lazy sequence. It holds a recipe rather than a position:
+// each walk opens a fresh cursor, so an Iterator can be consumed any number
+// of times (recomputing its items each time), like any other value.
+type Iterator struct{ open func() cursor }
+
+func (it Iterator) repr() string { return "iterator(...)" }
+
+func sliceCursor(items []Value) cursor {
+    i := 0
+    return func(*Evaluator) (Value, bool, error) {
+        if i == len(items) { return nil, false, nil }
+        i++
+        return items[i-1], true, nil
+    }
+}
+
+// open starts a walk over v, reporting false when v isn't iterable.
+func open(v Value) (cursor, bool) {
+    switch x := v.(type) {
+    case List: return sliceCursor(x.Items), true
+    case Set: return sliceCursor(x.ordered()), true
+    case Deque: return sliceCursor(x.list().Items), true
+    case Str:
+        chars := make([]Value, 0, len(x.V))
+        for _, c := range x.V { chars = append(chars, Str{V: string(c)}) }
+        return sliceCursor(chars), true
+    case Dict:
+        pairs := make([]Value, len(x.Items))
+        for i, e := range x.Items { pairs[i] = List{Items: []Value{e.Key, e.Val}} }
+        return sliceCursor(pairs), true
+    case Iterator: return x.open(), true
+    }
+    return nil, false
+}
+
+// each calls f on the items of v until it returns false or fails.
+func each(ev *Evaluator, next cursor, f func(Value) (bool, error)) error {
+    for {
+        v, ok, err := next(ev)
+        if err != nil || !ok { return err }
+        if more, err := f(v); err != nil || !more { return err }
+    }
+}
+
+// collect walks next to the end.
+func collect(ev *Evaluator, next cursor) ([]Value, error) {
+    out := []Value{}
+    err := each(ev, next, func(v Value) (bool, error) { out = append(out, v); return true, nil })
+    return out, err
+}
+
+// mapCursor and filterCursor are map and filter over a cursor, applying fn
+// as items are asked for.
+func mapCursor(fn Function, src cursor) cursor {
+    return func(ev *Evaluator) (Value, bool, error) {
+        v, ok, err := src(ev)
+        if err != nil || !ok { return nil, false, err }
+        v, err = fn.call(ev, []Value{v})
+        return v, err == nil, err
+    }
+}
+
+func filterCursor(fn Function, src cursor) cursor {
+    return func(ev *Evaluator) (Value, bool, error) {
+        for {
+            v, ok, err := src(ev)
+            if err != nil || !ok { return nil, false, err }
+            keep, err := fn.call(ev, []Value{v})
+            if err != nil { return nil, false, err }
+            if isTruthy(keep) { return v, true, nil }
+        }
+    }
+}
+
+// zipCursor pairs up the items of two cursors by fn, ending with the
+// shorter.
+func zipCursor(fn Function, xs, ys cursor) cursor {
+    return func(ev *Evaluator) (Value, bool, error) {
+        x, ok, err := xs(ev)
+        if err != nil || !ok { return nil, false, err }
+        y, ok, err := ys(ev)
+        if err != nil || !ok { return nil, false, err }
+        v, err := fn.call(ev, []Value{x, y})
+        return v, err == nil, err
+    }
+}
+
+// scanCursor gives acc, then each accumulator folding src by fn produces.
+func scanCursor(acc Value, fn Function, src cursor) cursor {
+    started := false
+    return func(ev *Evaluator) (Value, bool, error) {
+        if !started { started = true; return acc, true, nil }
+        v, ok, err := src(ev)
+        if err != nil || !ok { return nil, false, err }
+        acc, err = fn.call(ev, []Value{acc, v})
+        return acc, err == nil, err
+    }
+}
+
+// skipCursor drops the leading items of src that skip reports true for.
+func skipCursor(skip func(ev *Evaluator, v Value) (bool, error), src cursor) cursor {
+    skipping := true
+    return func(ev *Evaluator) (Value, bool, error) {
+        for {
+            v, ok, err := src(ev)
+            if err != nil || !ok { return nil, false, err }
+            if skipping {
+                s, err := skip(ev, v)
+                if err != nil { return nil, false, err }
+                if s { continue }
+                skipping = false
+            }
+            return v, true, nil
+        }
+    }
+}
+
+// lazily is an Iterator of open when lazy, and otherwise the List of the
+// items it gives, as map does.
+func lazily(ev *Evaluator, lazy bool, open func() cursor) (Value, error) {
+    if lazy { return Iterator{open: open}, nil }
+    items, err := collect(ev, open())
+    if err != nil { return nil, err }
+    return List{Items: items}, nil
+}
+
+// intRange is the Integers from from up to to, including to if inclusive;
+// `from..to` and `from..=to` evaluate to it.
+func intRange(from, to int64, inclusive bool) Iterator {
+    return Iterator{open: func() cursor {
+        n, done := from, false
+        return func(*Evaluator) (Value, bool, error) {
+            if done || n > to || n == to && !inclusive { return nil, false, nil }
+            v := n
+            // stepping past to could overflow
+            if n == to { done = true } else { n++ }
+            return intValue(v), true, nil
+        }
+    }}
+}
+
+// iteratorAt walks it to the item at index i, counting back from its end
+// if i is negative; the item is nil when it has no such index.
+func iteratorAt(ev *Evaluator, it Iterator, i int64) (Value, error) {
+    if i < 0 {
+        all, err := collect(ev, it.open())
+        if err != nil { return nil, err }
+        if i += int64(len(all)); i < 0 { return Nil{}, nil }
+        return all[i], nil
+    }
+    var found Value = Nil{}
+    err := each(ev, it.open(), func(v Value) (bool, error) {
+        if i == 0 { found = v }
+        i--
+        return i >= 0, nil
+    })
+    return found, err
+}
+
+func (ev *Evaluator) defineIterBuiltins(env *Env) {
+    // iterate(fn, x): the infinite sequence x, fn(x), fn(fn(x)), ...
+    env.Define("iterate", newBuiltin("iterate", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, ok := args[0].(Function)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: iterate(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        return Iterator{open: func() cursor {
+            var cur Value
+            return func(ev *Evaluator) (Value, bool, error) {
+                if cur == nil { cur = args[1]; return cur, true, nil }
+                v, err := fn.call(ev, []Value{cur})
+                cur = v
+                return v, err == nil, err
+            }
+        }}, nil
+    }), false)
+    // unfold(fn, state): the sequence a user-defined producer generates:
+    // fn(state) gives [item, next state], or nil to end it
+    env.Define("unfold", newBuiltin("unfold", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, ok := args[0].(Function)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: unfold(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        return Iterator{open: func() cursor {
+            state, done := args[1], false
+            return func(ev *Evaluator) (Value, bool, error) {
+                if done { return nil, false, nil }
+                r, err := fn.call(ev, []Value{state})
+                if err != nil { return nil, false, err }
+                if _, end := r.(Nil); end { done = true; return nil, false, nil }
+                pair, ok := r.(List)
+                if !ok || len(pair.Items) != 2 { return nil, false, fmt.Errorf("Expected [item, state] or nil from the unfold function, found: %s", typeName(r)) }
+                state = pair.Items[1]
+                return pair.Items[0], true, nil
+            }
+        }}, nil
+    }), false)
+    // range(from, to): the Integers from from up to, but not including, to
+    env.Define("range", newBuiltin("range", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        from, ok1 := args[0].(Int)
+        to, ok2 := args[1].(Int)
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: range(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        return intRange(from.V, to.V, false), nil
+    }), false)
+    // zip_with(fn, xs, ys): fn of each pair of items at the same position,
+    // up to the end of the shorter; an Iterator if either is one
+    env.Define("zip_with", newBuiltin("zip_with", 3, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, ok := args[0].(Function)
+        _, ok1 := open(args[1])
+        _, ok2 := open(args[2])
+        if !ok || !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: zip_with(%s)", argTypes(args)) }
+        _, lazy1 := args[1].(Iterator)
+        _, lazy2 := args[2].(Iterator)
+        return lazily(ev2, lazy1 || lazy2, func() cursor {
+            xs, _ := open(args[1])
+            ys, _ := open(args[2])
+            return zipCursor(fn, xs, ys)
+        })
+    }), false)
+    // scan(init, fn, xs): the running fold of xs, starting with init and
+    // followed by the accumulator after each item; reductions is the same
+    for _, name := range []string{"scan", "reductions"} {
+        env.Define(name, newBuiltin(name, 3, func(ev2 *Evaluator, args []Value) (Value, error) {
+            fn, ok := args[1].(Function)
+            _, ok1 := open(args[2])
+            if !ok || !ok1 { return nil, fmt.Errorf("Unexpected argument: %s(%s)", name, argTypes(args)) }
+            _, lazy := args[2].(Iterator)
+            return lazily(ev2, lazy, func() cursor {
+                xs, _ := open(args[2])
+                return scanCursor(args[0], fn, xs)
+            })
+        }), false)
+    }
+    // take(n, xs): a list of the first n items of xs, or all of them if fewer
+    env.Define("take", newBuiltin("take", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        n, ok1 := args[0].(Int)
+        next, ok2 := open(args[1])
+        if !ok1 || !ok2 || n.V < 0 { return nil, fmt.Errorf("Unexpected argument: take(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        out := []Value{}
+        if n.V == 0 { return List{Items: out}, nil }
+        err := each(ev2, next, func(v Value) (bool, error) {
+            out = append(out, v)
+            return int64(len(out)) < n.V, nil
+        })
+        if err != nil { return nil, err }
+        return List{Items: out}, nil
+    }), false)
+    // take_while(pred, xs): a list of the leading items of xs pred is
+    // truthy for
+    env.Define("take_while", newBuiltin("take_while", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, ok1 := args[0].(Function)
+        next, ok2 := open(args[1])
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: take_while(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        out := []Value{}
+        err := each(ev2, next, func(v Value) (bool, error) {
+            keep, err := fn.call(ev2, []Value{v})
+            if err != nil || !isTruthy(keep) { return false, err }
+            out = append(out, v)
+            return true, nil
+        })
+        if err != nil { return nil, err }
+        return List{Items: out}, nil
+    }), false)
+    // skip(n, xs), skip_while(pred, xs): xs without its first n items, or
+    // without the leading items pred is truthy for; an Iterator stays one
+    env.Define("skip", newBuiltin("skip", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        n, ok1 := args[0].(Int)
+        _, ok2 := open(args[1])
+        if !ok1 || !ok2 || n.V < 0 { return nil, fmt.Errorf("Unexpected argument: skip(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        _, lazy := args[1].(Iterator)
+        return lazily(ev2, lazy, func() cursor {
+            xs, _ := open(args[1])
+            left := n.V
+            return skipCursor(func(*Evaluator, Value) (bool, error) { left--; return left >= 0, nil }, xs)
+        })
+    }), false)
+    env.Define("skip_while", newBuiltin("skip_while", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, ok1 := args[0].(Function)
+        _, ok2 := open(args[1])
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: skip_while(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        _, lazy := args[1].(Iterator)
+        return lazily(ev2, lazy, func() cursor {
+            xs, _ := open(args[1])
+            return skipCursor(func(ev *Evaluator, v Value) (bool, error) {
+                skip, err := fn.call(ev, []Value{v})
+                return err == nil && isTruthy(skip), err
+            }, xs)
+        })
+    }), false)
+    // find(pred, xs): the first item of xs pred is truthy for, or nil;
+    // any?(pred, xs) and all?(pred, xs): whether pred is truthy for some
+    // or for every item. Each stops at the first item that decides it, so
+    // they also answer for an infinite Iterator once one does.
+    for name, answer := range map[string]func(item Value, found bool) Value{
+        "find": func(item Value, found bool) Value { if found { return item }; return Nil{} },
+        "any?": func(_ Value, found bool) Value { return boolValue(found) },
+        "all?": func(_ Value, found bool) Value { return boolValue(!found) },
+    } {
+        want := name != "all?" // all? looks for an item pred is falsy for
+        env.Define(name, newBuiltin(name, 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+            fn, ok1 := args[0].(Function)
+            next, ok2 := open(args[1])
+            if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: %s(%s, %s)", name, typeName(args[0]), typeName(args[1])) }
+            var item Value
+            found := false
+            err := each(ev2, next, func(v Value) (bool, error) {
+                r, err := fn.call(ev2, []Value{v})
+                if err != nil { return false, err }
+                if isTruthy(r) == want { item, found = v, true }
+                return !found, nil
+            })
+            if err != nil { return nil, err }
+            return answer(item, found), nil
+        }), false)
+    }
+}
@@ -0,0 +1,128 @@
+package evaluator
+
+import "testing"
+
+func TestIteration(t *testing.T) {
+    prelude := "let inc = |x| x + 1; let nats = iterate(inc, 0);\n"
+    tests := []testCase{
+        {`take(3, nats)`, "[0, 1, 2]", ""},
+        // map and filter stay lazy over an infinite sequence
+        {`nats |> map(|x| x * x) |> filter(|x| divmod(x, 2)[1] == 1) |> take(3)`, "[1, 9, 25]", ""},
+        {`nats |> filter(|x| x > 2) |> map(inc) |> take(2)`, "[4, 5]", ""},
+        {`map(inc, nats)`, "iterator(...)", ""},
+        // an Iterator can be walked again from the start
+        {`let xs = map(inc, nats); [take(2, xs), take(3, xs)]`, "[[1, 2], [1, 2, 3]]", ""},
+        {`range(2, 6) |> fold(0, +)`, "14", ""},
+        {`range(3, 1) |> to_list`, "[]", ""},
+        {`unfold(|s| if s[0] > 50 { nil } else { [s[0], [s[1], s[0] + s[1]]] }, [0, 1]) |> to_list`, "[0, 1, 1, 2, 3, 5, 8, 13, 21, 34]", ""},
+        // every collection is iterable, giving a List
+        {`map(inc, {3, 1})`, "[2, 4]", ""},
+        {`filter(|c| c != "b", "abc")`, `["a", "c"]`, ""},
+        {`fold(0, |acc, kv| acc + kv[1], #{"a": 1, "b": 2})`, "3", ""},
+        {`deque([1, 2]) |> push_back(3) |> map(inc)`, "[2, 3, 4]", ""},
+        {`take(2, [1, 2, 3])`, "[1, 2]", ""},
+        {`take(0, nats)`, "[]", ""},
+        {`unfold(|s| s, 1) |> take(1)`, "", "Expected [item, state] or nil from the unfold function, found: Integer"},
+        {`map(inc, 1)`, "", "Unexpected argument: map(Function, Integer)"},
+        {`take(-1, nats)`, "", "Unexpected argument: take(Integer, Iterator)"},
+    }
+    runCases(t, prelude, tests)
+}
+
+func TestRanges(t *testing.T) {
+    tests := []testCase{
+        {"1..5 |> to_list", "[1, 2, 3, 4]", ""},
+        {"1..=5 |> to_list", "[1, 2, 3, 4, 5]", ""},
+        {"let n = 3; [..0..n + 1]", "[0, 1, 2, 3]", ""},
+        {"[..3..3, ..3..=3, ..5..1]", "[3]", ""},
+        {"[..9223372036854775806..=9223372036854775807]", "[9223372036854775806, 9223372036854775807]", ""},
+        // ranges are lazy, so large ones cost nothing to make or pass along
+        {"1..1_000_000 |> filter(|x| x % 2 == 0) |> size", "499999", ""},
+        {"1..=1_000_000_000_000 |> map(|x| x * x) |> take(3)", "[1, 4, 9]", ""},
+        {"1..=4 |> fold(0, +)", "10", ""},
+        {"1..=4 |> map(|x| x * 10)", "iterator(...)", ""},
+        // indexing walks to the item
+        {"(10..20)[3]", "13", ""},
+        {"(10..20)[-1]", "19", ""},
+        {"(10..20)[10]", "nil", ""},
+        {"(10..20)[-11]", "nil", ""},
+        {"get(1, 1..=4 |> map(|x| x * 2))", "4", ""},
+        {"size(0..10)", "10", ""},
+        {"1..2.5", "", "Unsupported operation: Integer .. Decimal"},
+        {`(1..3)["a"]`, "", "Unable to perform index operation, found: Iterator[String]"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestSearch(t *testing.T) {
+    prelude := "let even = |x| x % 2 == 0; let nats = iterate(|x| x + 1, 0);\n"
+    tests := []testCase{
+        {"find(even, [1, 3, 4, 6])", "4", ""},
+        {"find(even, [1, 3])", "nil", ""},
+        {"find(|c| c != \"a\", \"aab\")", `"b"`, ""},
+        {"any?(even, [1, 2])", "true", ""},
+        {"any?(even, [1, 3])", "false", ""},
+        {"any?(even, [])", "false", ""},
+        {"all?(even, [2, 4])", "true", ""},
+        {"all?(even, [2, 3])", "false", ""},
+        {"all?(even, [])", "true", ""},
+        // the predicate's result counts by truthiness
+        {"find(|x| x, [0, [], 5])", "5", ""},
+        // each stops at the first item that decides it, even in an endless sequence
+        {"nats |> find(|x| x * x > 50)", "8", ""},
+        {"nats |> any?(|x| x > 100)", "true", ""},
+        {"nats |> all?(|x| x < 100)", "false", ""},
+        {"let mut calls = 0; [1, 2, 3, 4] |> any?(|x| { calls = calls + 1; x == 2 }); calls", "2", ""},
+        {"1..10 |> all?(|x| x > 0)", "true", ""},
+        {"[[1, 2], [3]] |> map(any?(even))", "[true, false]", ""},
+        {"find(1, [1])", "", "Unexpected argument: find(Integer, List)"},
+        {"all?(even, 1)", "", "Unexpected argument: all?(Function, Integer)"},
+        {"any?(|x| x + \"a\" > 1, [1])", "", "Unsupported operation: String > Integer"},
+    }
+    runCases(t, prelude, tests)
+}
+
+func TestTakeAndSkip(t *testing.T) {
+    prelude := "let nats = iterate(|x| x + 1, 0);\n"
+    tests := []testCase{
+        {"take(2, [1, 2, 3])", "[1, 2]", ""},
+        {"take(5, \"abc\")", `["a", "b", "c"]`, ""},
+        {"1..100 |> take(3)", "[1, 2, 3]", ""},
+        {"skip(1, [1, 2, 3])", "[2, 3]", ""},
+        {"skip(5, [1, 2])", "[]", ""},
+        {"skip(0, \"ab\")", `["a", "b"]`, ""},
+        {"take_while(|x| x < 3, [1, 2, 3, 1])", "[1, 2]", ""},
+        {"take_while(|c| c != \" \", \"ab cd\")", `["a", "b"]`, ""},
+        {"skip_while(|x| x < 3, [1, 2, 3, 1])", "[3, 1]", ""},
+        {"skip_while(|c| c == \" \", \"  ab\")", `["a", "b"]`, ""},
+        {"skip_while(|x| true, [1])", "[]", ""},
+        // an Iterator stays lazy, so endless ones can be skipped into
+        {"nats |> skip(5) |> take(2)", "[5, 6]", ""},
+        {"nats |> skip_while(|x| x < 10) |> take_while(|x| x < 13)", "[10, 11, 12]", ""},
+        {"1..=1_000_000_000 |> skip(10) |> take(1)", "[11]", ""},
+        {"nats |> skip(1)", "iterator(...)", ""},
+        // and can be walked again from the start
+        {"let xs = nats |> skip(2); [take(1, xs), take(2, xs)]", "[[2], [2, 3]]", ""},
+        {"skip(-1, [1])", "", "Unexpected argument: skip(Integer, List)"},
+        {"take_while(1, [1])", "", "Unexpected argument: take_while(Integer, List)"},
+        {"skip_while(|x| x, 1)", "", "Unexpected argument: skip_while(Function, Integer)"},
+    }
+    runCases(t, prelude, tests)
+}
+
+func TestZipAndScan(t *testing.T) {
+    prelude := "let nats = iterate(|x| x + 1, 0);\n"
+    tests := []testCase{
+        {`zip_with(+, [1, 2, 3], [10, 20])`, "[11, 22]", ""},
+        {`zip_with(|a, b| [a, b], "ab", nats)`, "iterator(...)", ""},
+        {`zip_with(|a, b| [a, b], "ab", nats) |> to_list`, `[["a", 0], ["b", 1]]`, ""},
+        {`let xs = [1, 5, 2]; zip_with(|a, b| a - b, rest(xs), xs)`, "[4, -3]", ""},
+        {`scan(0, +, [1, 2, 3])`, "[0, 1, 3, 6]", ""},
+        {`[1, 2, 3] |> reductions(1, *)`, "[1, 1, 2, 6]", ""},
+        {`scan(0, +, [])`, "[0]", ""},
+        {`nats |> scan(0, +) |> take(5)`, "[0, 0, 1, 3, 6]", ""},
+        {`zip_with(+, 1, [])`, "", "Unexpected argument: zip_with(Function, Integer, List)"},
+        {`reductions(0, 1, [])`, "", "Unexpected argument: reductions(Integer, Integer, List)"},
+    }
+    runCases(t, prelude, tests)
+}
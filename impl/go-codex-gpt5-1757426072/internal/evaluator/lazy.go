@@ -0,0 +1,58 @@
+package evaluator
+
+import (
+    "fmt"
+    "sync"
+)
+
+// Delayed is a computation put off by delay until force first needs it.
+// Copies share one state, so the function runs at most once however many
+// places force it, and from however many evaluators (--parallel): a second
+// evaluator forcing it mid-run waits for the result.
+type Delayed struct{ s *delayed }
+
+type delayed struct {
+    mu   sync.Mutex
+    fn   Function
+    by   *Evaluator    // the evaluator running fn, nil once it has finished
+    done chan struct{} // made when fn starts, closed once v and err are set
+    v    Value
+    err  error
+}
+
+func (d Delayed) repr() string { return "delay(...)" }
+
+func (d Delayed) force(ev *Evaluator) (Value, error) {
+    s := d.s
+    s.mu.Lock()
+    if s.done != nil {
+        done, by := s.done, s.by
+        s.mu.Unlock()
+        if by == ev { return nil, fmt.Errorf("Delayed value forced while it is being computed") }
+        <-done
+        return s.v, s.err
+    }
+    s.done, s.by = make(chan struct{}), ev
+    s.mu.Unlock()
+    v, err := s.fn.call(ev, nil)
+    s.mu.Lock()
+    s.v, s.err, s.by, s.fn = v, err, nil, nil
+    close(s.done)
+    s.mu.Unlock()
+    return v, err
+}
+
+func (ev *Evaluator) defineLazyBuiltins(env *Env) {
+    // delay(fn): fn's result, computed when first forced
+    env.Define("delay", newBuiltin("delay", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, ok := args[0].(Function)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: delay(%s)", typeName(args[0])) }
+        return Delayed{s: &delayed{fn: fn}}, nil
+    }), false)
+    // force(v): the result of a delayed computation, running it the first
+    // time; any other value is returned as is
+    env.Define("force", newBuiltin("force", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        if d, ok := args[0].(Delayed); ok { return d.force(ev2) }
+        return args[0], nil
+    }), false)
+}
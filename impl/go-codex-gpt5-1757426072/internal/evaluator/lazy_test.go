@@ -0,0 +1,35 @@
+package evaluator
+
+import (
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+func TestDelayForce(t *testing.T) {
+    tests := []struct{ src, want, out, err string }{
+        {`let d = delay(|| 6 * 7); [force(d), force(d)]`, "[42, 42]", "", ""},
+        // the computation runs once, on first force, and not at all unforced
+        {`let d = delay(|| { puts("ran"); 1 }); puts("before"); force(d) + force(d)`, "2", "\"before\" \n\"ran\" \n", ""},
+        {`let d = delay(|| puts("ran")); 1`, "1", "", ""},
+        {`let ds = [delay(|| 1), delay(|| 2)]; ds |> map(force)`, "[1, 2]", "", ""},
+        {`force(3)`, "3", "", ""},
+        {`delay(|| 1)`, "delay(...)", "", ""},
+        {`let d = delay(|| force(d)); force(d)`, "", "", "Delayed value forced while it is being computed"},
+        {`delay(1)`, "", "", "Unexpected argument: delay(Integer)"},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        var out strings.Builder
+        v, err := New(&out).Eval(prog)
+        if tt.err != "" {
+            if err == nil || err.Error() != tt.err { t.Errorf("%s: got %v, want %s", tt.src, err, tt.err) }
+            continue
+        }
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        if got := Format(v); got != tt.want { t.Errorf("%s: got %s, want %s", tt.src, got, tt.want) }
+        if out.String() != tt.out { t.Errorf("%s: printed %q, want %q", tt.src, out.String(), tt.out) }
+    }
+}
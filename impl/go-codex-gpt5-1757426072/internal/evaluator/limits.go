@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "runtime"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "elf-lang/impl/internal/lexer"
+)
+
+// cancelCheckInterval is the number of evaluations between context checks.
+const cancelCheckInterval = 1024
+
+// SetContext makes evaluation abort with an error once ctx is done.
+func (ev *Evaluator) SetContext(ctx context.Context) { ev.ctx = ctx }
+
+// sandboxMaxDepth bounds user function recursion in the sandbox, well before
+// the Go stack limit would crash the whole process.
+const sandboxMaxDepth = 10_000
+
+// Sandbox disables builtins that reach outside the program, such as reading
+// files or downloading puzzle inputs, and bounds recursion depth.
+func (ev *Evaluator) Sandbox() {
+    ev.sandboxed = true
+    ev.maxDepth = sandboxMaxDepth
+}
+
+func (ev *Evaluator) checkSandbox(name string) error {
+    if ev.sandboxed { return fmt.Errorf("%s(...): not available in the sandbox", name) }
+    return nil
+}
+
+// ReadInput reads a file or `aoc://` input on behalf of the program,
+// honouring the sandbox.
+func (ev *Evaluator) ReadInput(path string) (string, error) {
+    if err := ev.checkSandbox("read"); err != nil { return "", err }
+    return ReadSource(path)
+}
+
+// cancelled reports an aborted evaluation along with what was executing.
+func (ev *Evaluator) cancelled(err error) error {
+    if errors.Is(err, context.DeadlineExceeded) { return errors.New("Execution timed out" + ev.location()) }
+    return errors.New("Execution cancelled" + ev.location())
+}
+
+// at describes pos in the file being evaluated.
+func (ev *Evaluator) at(pos lexer.Pos) string { return site(ev.file, pos) }
+
+// site describes pos in file, which may be unnamed.
+func site(file string, pos lexer.Pos) string {
+    if file == "" { return pos.String() }
+    return file + ":" + pos.String()
+}
+
+// location describes what is executing: the statement and, inside a call,
+// the function being run.
+func (ev *Evaluator) location() string {
+    var loc string
+    if ev.pos.Line > 0 { loc += " at " + ev.at(ev.pos) }
+    if f := ev.fn; f != nil { loc += fmt.Sprintf(" in %s (defined at %s)", f.describe(), f.pos) }
+    return loc
+}
+
+// heapWatchInterval is how often the live heap is sampled once any
+// evaluator has a memory limit. Sampling in the background (rather than
+// every so many evaluations) also catches a few evaluations allocating
+// exponentially more each time.
+const heapWatchInterval = 5 * time.Millisecond
+
+var (
+    heapWatch   sync.Once
+    sampledHeap atomic.Uint64
+)
+
+// SetMemoryLimit makes evaluation abort once the live heap grows beyond
+// limit bytes; 0 means no limit.
+func (ev *Evaluator) SetMemoryLimit(limit uint64) {
+    ev.memLimit = limit
+    if limit == 0 { return }
+    heapWatch.Do(func() {
+        sampledHeap.Store(liveHeap())
+        go func() {
+            for range time.Tick(heapWatchInterval) { sampledHeap.Store(liveHeap()) }
+        }()
+    })
+}
+
+// checkMemory is called once the sampled heap is over the limit.
+func (ev *Evaluator) checkMemory() error {
+    // only memory that is still reachable counts against the limit
+    runtime.GC()
+    heap := liveHeap()
+    sampledHeap.Store(heap)
+    if heap <= ev.memLimit { return nil }
+    return fmt.Errorf("Memory limit of %s exceeded (live heap %s)%s", FormatBytes(ev.memLimit), FormatBytes(heap), ev.location())
+}
+
+// FormatBytes formats a byte count with a binary unit, e.g. "1.5 MiB".
+func FormatBytes(n uint64) string {
+    const unit = 1024
+    if n < unit { return fmt.Sprintf("%d B", n) }
+    div, exp := uint64(unit), 0
+    for m := n / unit; m >= unit; m /= unit { div *= unit; exp++ }
+    return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,126 @@
+package evaluator
+
+import (
+    "fmt"
+    "slices"
+    "sync/atomic"
+)
+
+// listTail is shared by the lists built over one backing array by push,
+// recording how much of the array is in use. A list using all of it can have
+// a value appended in place: the slots past a list's length are invisible to
+// it, so every list sharing the array stays unchanged. The claim on the next
+// slot is atomic as values may be shared between evaluators (--parallel).
+type listTail struct{ used atomic.Int64 }
+
+// pushList returns l with v appended, in amortized constant time when l is
+// the longest list over its backing array; otherwise the items are copied
+// into a new array with room to grow.
+func pushList(l List, v Value) List {
+    n := len(l.Items)
+    if l.tail != nil && n < cap(l.Items) && l.tail.used.CompareAndSwap(int64(n), int64(n+1)) {
+        return List{Items: append(l.Items, v), tail: l.tail}
+    }
+    items := make([]Value, n, max(2*n, 4))
+    copy(items, l.Items)
+    tail := &listTail{}
+    tail.used.Store(int64(n + 1))
+    return List{Items: append(items, v), tail: tail}
+}
+
+// items collects any iterable into a fresh slice the caller may reorder.
+func items(ev *Evaluator, v Value) ([]Value, bool, error) {
+    if l, isList := v.(List); isList { return append([]Value{}, l.Items...), true, nil }
+    next, ok := open(v)
+    if !ok { return nil, false, nil }
+    out, err := collect(ev, next)
+    return out, true, err
+}
+
+func (ev *Evaluator) defineListBuiltins(env *Env) {
+    // sort(xs): the items of xs in ascending order, the order Sets print in
+    env.Define("sort", newBuiltin("sort", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        xs, ok, err := items(ev2, args[0])
+        if !ok { return nil, fmt.Errorf("Unexpected argument: sort(%s)", typeName(args[0])) }
+        if err != nil { return nil, err }
+        slices.SortStableFunc(xs, compare)
+        return List{Items: xs}, nil
+    }), false)
+    // sort_by(key, xs): the items of xs in ascending order of key(item),
+    // calling key once per item; items with equal keys keep their order
+    env.Define("sort_by", newBuiltin("sort_by", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, isFn := args[0].(Function)
+        xs, ok, err := items(ev2, args[1])
+        if !isFn || !ok { return nil, fmt.Errorf("Unexpected argument: sort_by(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        if err != nil { return nil, err }
+        keyed := make([]dictEntry, len(xs))
+        for i, x := range xs {
+            k, err := fn.call(ev2, []Value{x})
+            if err != nil { return nil, err }
+            keyed[i] = dictEntry{Key: k, Val: x}
+        }
+        slices.SortStableFunc(keyed, func(a, b dictEntry) int { return compare(a.Key, b.Key) })
+        for i, e := range keyed { xs[i] = e.Val }
+        return List{Items: xs}, nil
+    }), false)
+    // sort_with(cmp, xs): the items of xs ordered by cmp(a, b), an Integer
+    // below, equal to or above 0 when a goes before, with or after b;
+    // items cmp finds equal keep their order
+    env.Define("sort_with", newBuiltin("sort_with", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, isFn := args[0].(Function)
+        xs, ok, err := items(ev2, args[1])
+        if !isFn || !ok { return nil, fmt.Errorf("Unexpected argument: sort_with(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        if err != nil { return nil, err }
+        // the first error stops the comparisons mattering; sort still finishes
+        var failed error
+        slices.SortStableFunc(xs, func(a, b Value) int {
+            if failed != nil { return 0 }
+            v, err := fn.call(ev2, []Value{a, b})
+            if err != nil { failed = err; return 0 }
+            switch n := v.(type) {
+            case Int: return int(max(-1, min(1, n.V)))
+            case Big: return n.V.Sign()
+            }
+            failed = fmt.Errorf("Expected an Integer from the sort_with function, found: %s", typeName(v))
+            return 0
+        })
+        if failed != nil { return nil, failed }
+        return List{Items: xs}, nil
+    }), false)
+    // group_by(key, xs): a dictionary from each key(item) to the list of
+    // items with that key, keys in order of first occurrence and items in
+    // their order in xs
+    env.Define("group_by", newBuiltin("group_by", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, isFn := args[0].(Function)
+        xs, ok, err := items(ev2, args[1])
+        if !isFn || !ok { return nil, fmt.Errorf("Unexpected argument: group_by(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        if err != nil { return nil, err }
+        groups := newDict(nil)
+        for _, x := range xs {
+            k, err := fn.call(ev2, []Value{x})
+            if err != nil { return nil, err }
+            if _, isDict := k.(Dict); isDict { return nil, fmt.Errorf("Unable to use a Dictionary as a Dictionary key") }
+            if i := groups.find(hashValue(k), k); i >= 0 {
+                groups.Items[i].Val = pushList(groups.Items[i].Val.(List), x)
+                continue
+            }
+            groups.put(k, List{Items: []Value{x}})
+        }
+        return groups, nil
+    }), false)
+    // partition(pred, xs): [the items pred holds for, the rest], each in
+    // their order in xs
+    env.Define("partition", newBuiltin("partition", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        fn, isFn := args[0].(Function)
+        xs, ok, err := items(ev2, args[1])
+        if !isFn || !ok { return nil, fmt.Errorf("Unexpected argument: partition(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        if err != nil { return nil, err }
+        in, out := []Value{}, []Value{}
+        for _, x := range xs {
+            v, err := fn.call(ev2, []Value{x})
+            if err != nil { return nil, err }
+            if isTruthy(v) { in = append(in, x) } else { out = append(out, x) }
+        }
+        return List{Items: []Value{List{Items: in}, List{Items: out}}}, nil
+    }), false)
+}
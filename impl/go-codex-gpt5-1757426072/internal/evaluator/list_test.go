@@ -0,0 +1,60 @@
+package evaluator
+
+import "testing"
+
+func TestSort(t *testing.T) {
+    tests := []testCase{
+        {`sort([3, 1.5, 2])`, "[1.5, 2, 3]", ""},
+        {`sort(["b", "a", "c"])`, `["a", "b", "c"]`, ""},
+        {`let xs = [2, 1]; [sort(xs), xs]`, "[[1, 2], [2, 1]]", ""},
+        // a stable sort, so equal keys keep their order
+        {`sort_by(size, ["ccc", "a", "bb", "d"])`, `["a", "d", "bb", "ccc"]`, ""},
+        {`#{"x": 3, "y": 1, "z": 2} |> sort_by(|kv| -kv[1]) |> map(first)`, `["x", "z", "y"]`, ""},
+        {`sort_with(|a, b| b - a, [1, 3, 2])`, "[3, 2, 1]", ""},
+        {`sort_with(|a, b| 0, [3, 1, 2])`, "[3, 1, 2]", ""},
+        // a Big result orders by its sign
+        {`sort_with(|a, b| (b - a) * 92233720368547758070, [1, 3, 2])`, "[3, 2, 1]", ""},
+        {`sort({3, 1}) |> first`, "1", ""},
+        {`iterate(|x| x - 1, 3) |> take(3) |> sort`, "[1, 2, 3]", ""},
+        {`sort_with(|a, b| a < b, [1, 2])`, "", "Expected an Integer from the sort_with function, found: Boolean"},
+        {`sort(1)`, "", "Unexpected argument: sort(Integer)"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestGroupBy(t *testing.T) {
+    tests := []testCase{
+        {`group_by(size, ["ab", "c", "de", "f", "ghi"])`, `#{1: ["c", "f"], 2: ["ab", "de"], 3: ["ghi"]}`, ""},
+        {`group_by(|x| x > 1, [1, 2, 3]) |> to_list |> map(first)`, "[false, true]", ""},
+        {`group_by(|c| c, "abca")`, `#{"a": ["a", "a"], "b": ["b"], "c": ["c"]}`, ""},
+        {`group_by(|x| #{}, [1])`, "", "Unable to use a Dictionary as a Dictionary key"},
+        {`partition(|x| x > 2, [1, 3, 2, 4])`, "[[3, 4], [1, 2]]", ""},
+        {`[1, 2, 3] |> partition(|x| false)`, "[[], [1, 2, 3]]", ""},
+        {`partition(|x| x < 2, iterate(|x| x + 1, 0) |> take(4))`, "[[0, 1], [2, 3]]", ""},
+        {`partition(1, [1])`, "", "Unexpected argument: partition(Integer, List)"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestSpread(t *testing.T) {
+    prelude := "let xs = [2, 3]; let add3 = |a, b, c| a + b + c;\n"
+    tests := []testCase{
+        {"[1, ..xs, 4]", "[1, 2, 3, 4]", ""},
+        {"[..xs, ..xs]", "[2, 3, 2, 3]", ""},
+        {"[..[], 1]", "[1]", ""},
+        {"[..xs] == xs", "true", ""},
+        // anything iterable spreads, in the order it iterates
+        {"[..{3, 1}, ..\"ab\"]", `[1, 3, "a", "b"]`, ""},
+        {"[..#{1: 2}]", "[[1, 2]]", ""},
+        {"[..(iterate(|x| x * 2, 1) |> take(3))]", "[1, 2, 4]", ""},
+        // call arguments, counted once spread
+        {"add3(..xs, 10)", "15", ""},
+        {"add3(1, ..xs)", "6", ""},
+        {"add3(..[1, 2, 3])", "6", ""},
+        {"add3(..xs)", "|...| { [function] }", ""},
+        {"1 |> add3(..xs)", "6", ""},
+        {"[..1]", "", "Unable to spread Integer"},
+        {"add3(..nil)", "", "Unable to spread Nil"},
+    }
+    runCases(t, prelude, tests)
+}
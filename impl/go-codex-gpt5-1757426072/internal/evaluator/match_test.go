@@ -0,0 +1,28 @@
+package evaluator
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+    prelude := "let describe = |v| match v { 0 -> \"zero\", -1 -> \"minus one\", [] -> \"empty\", [x] -> x, [_, [y, _]] -> y, [a, b] -> a + b, _ -> \"other\" };\n"
+    tests := []testCase{
+        {"describe(0)", `"zero"`, ""},
+        {"describe(-1)", `"minus one"`, ""},
+        {"describe([])", `"empty"`, ""},
+        {"describe([5])", "5", ""},
+        {"describe([1, [2, 3]])", "2", ""},
+        {"describe([1, 2])", "3", ""},
+        {"describe([1, 2, 3])", `"other"`, ""},
+        {"describe(\"zero\")", `"other"`, ""},
+        // the first matching case wins, and a name matches anything
+        {"match 1 { n -> n + 1, 1 -> 0 }", "2", ""},
+        {`match "a" { "b" -> 1, "a" -> 2 }`, "2", ""},
+        {"match nil { false -> 1, nil -> 2 }", "2", ""},
+        {"match 2.5 { 2.5 -> true, _ -> false }", "true", ""},
+        // bindings are local to their case, and block bodies can bind more
+        {"let n = 1; match 5 { n -> n }; n", "1", ""},
+        {"match [2, 3] { [a, b] -> { let c = a * b; c + 1 }, }", "7", ""},
+        {"let k = 10; [1, 2] |> map(|v| match v { 1 -> k, m -> m * k })", "[10, 20]", ""},
+        {"match 3 { 1 -> 1, 2 -> 2 }", "", "No match for 3"},
+    }
+    runCases(t, prelude, tests)
+}
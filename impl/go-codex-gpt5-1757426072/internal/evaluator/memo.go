@@ -0,0 +1,131 @@
+package evaluator
+
+import (
+    "container/list"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// effectful builtins do IO, draw random numbers or depend on the scope they
+// are called from; a call to one makes the calling functions impure.
+var effectful = map[string]bool{
+    "puts": true, "read": true, "read_aoc": true, "stdin": true,
+    "import": true, "bindings": true, "rand_int": true, "shuffle": true,
+    "sort_sets": true,
+}
+
+// memoCache is the --auto-memo cache of user function results, keyed by the
+// function and its arguments and evicting the least recently used entry
+// beyond its limit. A call is only cached when it had no effects: it called
+// no effectful builtin and neither read nor assigned a mutable variable, so
+// its result depends on nothing but its arguments.
+type memoCache struct {
+    limit   int
+    entries map[memoKey]*list.Element
+    order   *list.List // of memoEntry, most recently used first
+}
+
+type memoKey struct {
+    fn   *userFunc
+    args string
+}
+
+type memoEntry struct {
+    key memoKey
+    val Value
+}
+
+// SetAutoMemo caches the results of pure function calls, keeping at most
+// limit results; a limit of 0 disables it.
+func (ev *Evaluator) SetAutoMemo(limit int) {
+    ev.memo = nil
+    if limit > 0 { ev.memo = &memoCache{limit: limit, entries: map[memoKey]*list.Element{}, order: list.New()} }
+}
+
+func (m *memoCache) get(k memoKey) (Value, bool) {
+    el, ok := m.entries[k]
+    if !ok { return nil, false }
+    m.order.MoveToFront(el)
+    return el.Value.(memoEntry).val, true
+}
+
+func (m *memoCache) put(k memoKey, v Value) {
+    m.entries[k] = m.order.PushFront(memoEntry{key: k, val: v})
+    if m.order.Len() > m.limit {
+        oldest := m.order.Back()
+        m.order.Remove(oldest)
+        delete(m.entries, oldest.Value.(memoEntry).key)
+    }
+}
+
+// memoCall calls f through the memo cache.
+func (ev *Evaluator) memoCall(f *userFunc, args []Value) (Value, error) {
+    var b strings.Builder
+    for _, a := range args[:len(f.params)] {
+        // calls taking functions are not cached: they have no identity to key by
+        if !writeKey(&b, a) { return f.invoke(ev, args) }
+    }
+    k := memoKey{fn: f, args: b.String()}
+    if v, ok := ev.memo.get(k); ok { return v, nil }
+    before := ev.effects
+    v, err := f.invoke(ev, args)
+    if err != nil { return nil, err }
+    if ev.effects != before {
+        f.impure = true
+        return v, nil
+    }
+    ev.memo.put(k, v)
+    return v, nil
+}
+
+// writeKey writes an unambiguous encoding of v, reporting false for values
+// that can not be keyed (functions).
+func writeKey(b *strings.Builder, v Value) bool {
+    switch x := v.(type) {
+    case Int:
+        b.WriteByte('i')
+        b.WriteString(strconv.FormatInt(x.V, 10))
+    case Big:
+        b.WriteByte('i')
+        b.WriteString(x.V.String())
+    case Dec:
+        b.WriteByte('d')
+        b.WriteString(strconv.FormatUint(math.Float64bits(x.V), 16))
+        if x.R != nil { b.WriteByte('/'); b.WriteString(x.R.String()) }
+    case Str:
+        b.WriteByte('s')
+        b.WriteString(strconv.Itoa(len(x.V)))
+        b.WriteByte(':')
+        b.WriteString(x.V)
+    case Bool:
+        if x.V { b.WriteByte('T') } else { b.WriteByte('F') }
+    case Nil:
+        b.WriteByte('N')
+    case List:
+        return writeKeys(b, 'l', x.Items)
+    case Set:
+        return writeKeys(b, 'e', x.ordered())
+    case Dict:
+        items := x.ordered()
+        b.WriteByte('m')
+        b.WriteString(strconv.Itoa(len(items)))
+        for _, it := range items {
+            if !writeKey(b, it.Key) || !writeKey(b, it.Val) { return false }
+        }
+    default:
+        return false
+    }
+    b.WriteByte(';')
+    return true
+}
+
+func writeKeys(b *strings.Builder, tag byte, items []Value) bool {
+    b.WriteByte(tag)
+    b.WriteString(strconv.Itoa(len(items)))
+    for _, it := range items {
+        if !writeKey(b, it) { return false }
+    }
+    b.WriteByte(';')
+    return true
+}
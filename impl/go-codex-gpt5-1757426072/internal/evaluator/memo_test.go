@@ -0,0 +1,53 @@
+package evaluator
+
+import (
+    "io"
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+func TestAutoMemo(t *testing.T) {
+    tests := []struct{ src, want, out string; entries int }{
+        // exponential without the cache
+        {"let fib = |n| if n < 2 { n } else { fib(n - 1) + fib(n - 2) };\nfib(90)", "2880067194370816120", "", 91},
+        // keys tell apart values of different types or exact values
+        {"let f = |x| x / 2;\n[f(1), f(1.0), f(1)]", "[0, 0.5, 0]", "", 2},
+        {"let f = |x| x * 3;\n[f(1.0 / 3), f(0.3333333333333333)]", "[1, 0.9999999999999999]", "", 2},
+        {`let f = |s| [s]; [f("a;i1;"), f("a"), f(["a"]), f("a")]`, `[["a;i1;"], ["a"], [["a"]], ["a"]]`, "", 3},
+        // and agree for equal Sets and Dicts, whatever their order
+        {"let f = |s| size(s);\n[f({1, 2}), f({2, 1}), f(#{1: 2, 3: 4}), f(#{3: 4, 1: 2})]", "[2, 2, 2, 2]", "", 2},
+        // impure calls run every time and are never cached
+        {"let f = |x| { puts(x); x };\n[f(1), f(1)]", "[1, 1]", "1 \n1 \n", 0},
+        {"let g = |x| { puts(x); x };\nlet f = |x| g(x) + 1;\n[f(1), f(1)]", "[2, 2]", "1 \n1 \n", 0},
+        {"let mut n = 0;\nlet f = |x| x + n;\nlet a = f(1);\nn = 5;\n[a, f(1)]", "[1, 6]", "", 0},
+        // calls given a function are not cached, calls of the function are
+        {"let ap = |g, x| g(x);\n[ap(|x| x + 1, 1), ap(|x| x + 2, 1)]", "[2, 3]", "", 2},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        var out strings.Builder
+        ev := New(&out)
+        ev.SetAutoMemo(1000)
+        v, err := ev.Eval(prog)
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        if got := Format(v); got != tt.want { t.Errorf("%s: got %s, want %s", tt.src, got, tt.want) }
+        if out.String() != tt.out { t.Errorf("%s: printed %q, want %q", tt.src, out.String(), tt.out) }
+        if n := ev.memo.order.Len(); n != tt.entries { t.Errorf("%s: got %d cached results, want %d", tt.src, n, tt.entries) }
+    }
+}
+
+func TestAutoMemoLimit(t *testing.T) {
+    prog, err := parser.Parse("let f = |x| x * 2;\n[f(1), f(2), f(3), f(1)]")
+    if err != nil { t.Fatal(err) }
+    ev := New(io.Discard)
+    ev.SetAutoMemo(2)
+    v, err := ev.Eval(prog)
+    if err != nil || Format(v) != "[2, 4, 6, 2]" { t.Fatalf("got %v, %v", v, err) }
+    // f(1) was evicted by f(3), then cached again in place of f(2)
+    var keys []string
+    for el := ev.memo.order.Front(); el != nil; el = el.Next() { keys = append(keys, el.Value.(memoEntry).key.args) }
+    if got := strings.Join(keys, " "); got != "i1; i3;" { t.Errorf("got keys %s, want i1; i3;", got) }
+}
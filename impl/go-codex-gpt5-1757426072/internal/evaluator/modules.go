@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "elf-lang/impl/internal/parser"
+)
+
+// moduleExts are tried in order when an import path has no extension.
+var moduleExts = []string{"", ".santa", ".elf"}
+
+// module is an imported file, evaluated once per evaluator.
+type module struct {
+    env     *Env
+    loading bool
+}
+
+// SetFile records the path of the program being evaluated; imports are
+// resolved relative to its directory before the search paths.
+func (ev *Evaluator) SetFile(path string) { ev.file = path }
+
+// SetSearchPaths sets the directories imports are resolved against.
+func (ev *Evaluator) SetSearchPaths(paths []string) { ev.searchPaths = paths }
+
+// Import evaluates the module at path (once) and binds its top-level names
+// in the current scope, as the `import` builtin does.
+func (ev *Evaluator) Import(path string) error {
+    resolved, err := ev.resolveModule(path)
+    if err != nil { return err }
+    if ev.modules == nil { ev.modules = map[string]*module{} }
+    mod, ok := ev.modules[resolved]
+    if ok && mod.loading { return fmt.Errorf("Import cycle detected: %s", path) }
+    if !ok {
+        mod = &module{env: NewEnv(ev.builtins), loading: true}
+        ev.modules[resolved] = mod
+        if err := ev.evalModule(resolved, mod.env); err != nil {
+            delete(ev.modules, resolved)
+            return err
+        }
+        mod.loading = false
+    }
+    mod.env.each(func(name string, b binding) { ev.env.Define(name, b.val, false) })
+    return nil
+}
+
+func (ev *Evaluator) evalModule(path string, env *Env) error {
+    data, err := os.ReadFile(path)
+    if err != nil { return fmt.Errorf("Unable to read module: %s", path) }
+    prog, err := parser.Parse(string(data))
+    if err != nil { return fmt.Errorf("%s: %v", path, err) }
+    savedEnv, savedFile := ev.env, ev.file
+    ev.env, ev.file = env, path
+    defer func() { ev.env, ev.file = savedEnv, savedFile }()
+    _, err = ev.Eval(prog)
+    return err
+}
+
+// resolveModule finds the file an import refers to, trying the importing
+// file's directory first and then each search path.
+func (ev *Evaluator) resolveModule(path string) (string, error) {
+    var dirs []string
+    if filepath.IsAbs(path) {
+        dirs = []string{""}
+    } else {
+        if ev.file != "" { dirs = append(dirs, filepath.Dir(ev.file)) } else { dirs = append(dirs, ".") }
+        dirs = append(dirs, ev.searchPaths...)
+    }
+    for _, dir := range dirs {
+        for _, ext := range moduleExts {
+            candidate := filepath.Join(dir, path+ext)
+            if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+                if abs, err := filepath.Abs(candidate); err == nil { return abs, nil }
+                return candidate, nil
+            }
+        }
+    }
+    return "", fmt.Errorf("Module can not be found: %s", path)
+}
+
+func (ev *Evaluator) defineModuleBuiltins(env *Env) {
+    env.Define("import", newBuiltin("import", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        if err := ev2.checkSandbox("import"); err != nil { return nil, err }
+        path, ok := args[0].(Str)
+        if !ok { return nil, fmt.Errorf("import(...): invalid argument type, expected String, found %s", typeName(args[0])) }
+        if err := ev2.Import(strings.TrimSpace(path.V)); err != nil { return nil, err }
+        return Nil{}, nil
+    }), false)
+}
@@ -0,0 +1,460 @@
+package evaluator
+
+import (
+    "fmt"
+    "math"
+    "math/big"
+    "slices"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// defaultEpsilon is approx_eq's tolerance when none is given: far above the
+// noise of a few float64 operations, far below any difference a puzzle
+// answer cares about.
+const defaultEpsilon = 1e-9
+
+// approxEqual reports whether two numbers differ by at most eps, scaled by
+// their magnitude once that is above 1 so large values get the same
+// relative slack as small ones.
+func approxEqual(a, b, eps float64) bool {
+    if a == b { return true }
+    return math.Abs(a-b) <= eps*max(1, math.Abs(a), math.Abs(b))
+}
+
+// ApproxEqual is Equal, except that two Decimals only need to agree to
+// within the default epsilon. Test expectations use it, so a part
+// computing 0.1 + 0.2 passes against 0.3.
+func ApproxEqual(a, b Value) bool {
+    x, ok1 := a.(Dec)
+    y, ok2 := b.(Dec)
+    if ok1 && ok2 { return approxEqual(x.V, y.V, defaultEpsilon) }
+    return equal(a, b)
+}
+
+// toFloat is v as a float64, for Integers and Decimals alike.
+func toFloat(v Value) (float64, bool) {
+    switch x := v.(type) {
+    case Int: return float64(x.V), true
+    case Big: return x.float(), true
+    case Dec: return x.V, true
+    }
+    return 0, false
+}
+
+// An Integer outside the int64 range is a Big: arithmetic on Ints that
+// overflows promotes its result rather than wrapping around, and bigValue
+// demotes a result back to an Int once it fits. So each Integer has the
+// one representation, and an Int is never equal to a Big.
+func bigValue(n *big.Int) Value {
+    if n.IsInt64() { return intValue(n.Int64()) }
+    return Big{V: n}
+}
+
+// toBig is an Int or Big as a big.Int.
+func toBig(v Value) (*big.Int, bool) {
+    switch x := v.(type) {
+    case Int: return big.NewInt(x.V), true
+    case Big: return x.V, true
+    }
+    return nil, false
+}
+
+// bigArith applies op, one of big.Int's Add, Sub, Mul, Quo or Rem, to two
+// Integers.
+func bigArith(op func(z, x, y *big.Int) *big.Int, a, b Value) Value {
+    x, _ := toBig(a)
+    y, _ := toBig(b)
+    return bigValue(op(new(big.Int), x, y))
+}
+
+// A Decimal is exact: V is its float64, and R, when the shortest decimal
+// that rounds to V (the digits it prints as) isn't the number, its exact
+// value. decimal applies op to the operands' exact values, so 0.1 + 0.2 is
+// 0.3 and 1.0 / 3 * 3 is 1, not the float64 results 0.30000000000000004
+// and 0.9999999999999999. Most results are short decimals that int64 digits
+// compute and V alone holds; the rest take big.Rats. An infinite or NaN
+// operand has no exact value; f, the float64 result, is used.
+func decimal(op decOp, a, b Value, f float64) Value {
+    if x, ok := decOf(a); ok {
+        if y, ok := decOf(b); ok {
+            if r, ok := op.fast(x, y); ok {
+                if f, ok := r.short(); ok { return Dec{V: f} }
+            }
+        }
+    }
+    x, ok1 := exact(a)
+    y, ok2 := exact(b)
+    if !ok1 || !ok2 { return Dec{V: f} }
+    return ratDec(op.exact(new(big.Rat), x, y))
+}
+
+// maxRatBits bounds a Decimal's exact value: one needing more bits, as
+// dividing by 3 over and over soon does, is rounded to its float64 rather
+// than left to grow without end.
+const maxRatBits = 1024
+
+// ratDec is the Decimal r, keeping r only when its float64 doesn't print
+// as it.
+func ratDec(r *big.Rat) Dec {
+    f, _ := r.Float64()
+    if math.IsInf(f, 0) || r.Num().BitLen()+r.Denom().BitLen() > maxRatBits { return Dec{V: f} }
+    if s, _ := exact(Dec{V: f}); s.Cmp(r) == 0 { return Dec{V: f} }
+    return Dec{V: f, R: r}
+}
+
+// A decOp is an arithmetic operator on decimals: fast works on int64
+// digits, and reports false when they can't hold the result, which exact
+// then gives from big.Rats.
+type decOp struct {
+    fast  func(x, y dec) (dec, bool)
+    exact func(z, x, y *big.Rat) *big.Rat
+}
+
+var (
+    decAdd = decOp{func(x, y dec) (dec, bool) {
+        x, y, ok := align(x, y)
+        if !ok { return dec{}, false }
+        m, ok := addInt(x.m, y.m)
+        return dec{m, x.e}, ok
+    }, (*big.Rat).Add}
+    decSub = decOp{func(x, y dec) (dec, bool) {
+        x, y, ok := align(x, y)
+        if !ok { return dec{}, false }
+        m, ok := subInt(x.m, y.m)
+        return dec{m, x.e}, ok
+    }, (*big.Rat).Sub}
+    decMul = decOp{func(x, y dec) (dec, bool) {
+        m, ok := mulInt(x.m, y.m)
+        return dec{m, x.e + y.e}, ok
+    }, (*big.Rat).Mul}
+    // with the exponents aligned the quotient is x.m / y.m, a decimal when
+    // enough zeros appended to x.m make the division exact
+    decQuo = decOp{func(x, y dec) (dec, bool) {
+        x, y, ok := align(x, y)
+        if !ok || y.m == 0 { return dec{}, false }
+        for e := 0; ; e-- {
+            if x.m%y.m == 0 {
+                q, ok := divInt(x.m, y.m)
+                return dec{q, e}, ok
+            }
+            if x.m, ok = mulInt(x.m, 10); !ok { return dec{}, false }
+        }
+    }, (*big.Rat).Quo}
+)
+
+// A dec is the decimal m × 10^e, for the arithmetic on Decimals that fits
+// an int64.
+type dec struct {
+    m int64
+    e int
+}
+
+// decOf is an Int, or a Decimal V holds, as a dec.
+func decOf(v Value) (dec, bool) {
+    switch x := v.(type) {
+    case Int: return dec{m: x.V}, true
+    case Dec:
+        if x.R != nil { return dec{}, false }
+        return floatDec(x.V)
+    }
+    return dec{}, false
+}
+
+func floatDec(f float64) (dec, bool) {
+    if math.IsInf(f, 0) || math.IsNaN(f) { return dec{}, false }
+    // at most 17 digits, which an int64 holds: d.ddde±xx
+    var buf [32]byte
+    s := strconv.AppendFloat(buf[:0], f, 'e', -1, 64)
+    var d dec
+    neg, frac, i := s[0] == '-', false, 0
+    if neg { i++ }
+    for ; s[i] != 'e'; i++ {
+        if s[i] == '.' { frac = true; continue }
+        d.m = d.m*10 + int64(s[i]-'0')
+        if frac { d.e-- }
+    }
+    exp, sign := 0, s[i+1]
+    for _, c := range s[i+2:] { exp = exp*10 + int(c-'0') }
+    if sign == '-' { exp = -exp }
+    d.e += exp
+    if neg { d.m = -d.m }
+    return d, true
+}
+
+// align rescales x and y to the smaller of their exponents.
+func align(x, y dec) (dec, dec, bool) {
+    if x.e < y.e { y, x, ok := align(y, x); return x, y, ok }
+    for ; x.e > y.e; x.e-- {
+        m, ok := mulInt(x.m, 10)
+        if !ok { return x, y, false }
+        x.m = m
+    }
+    return x, y, true
+}
+
+// pow10 holds the powers of ten a float64 represents exactly.
+var pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// exactFloat reports whether float64(m) is exact.
+func exactFloat(m int64) bool { return m < 1<<53 && m > -1<<53 }
+
+// float rounds d to a float64 when one operation on exact float64s does
+// it: an m below 2⁵³ times or over an exact power of ten.
+func (d dec) float() (float64, bool) {
+    if !exactFloat(d.m) { return 0, false }
+    switch {
+    case d.e >= 0 && d.e < len(pow10): return float64(d.m) * pow10[d.e], true
+    case d.e < 0 && -d.e < len(pow10): return float64(d.m) / pow10[-d.e], true
+    }
+    return 0, false
+}
+
+// short is d as a float64 that prints as d, which holds for any decimal of
+// at most 15 significant digits.
+func (d dec) short() (float64, bool) {
+    for d.m != 0 && d.m%10 == 0 && (d.m >= 1e15 || d.m <= -1e15) { d.m /= 10; d.e++ }
+    if d.m >= 1e15 || d.m <= -1e15 { return 0, false }
+    return d.float()
+}
+
+// exact is a number as the big.Rat decimal works with.
+func exact(v Value) (*big.Rat, bool) {
+    switch x := v.(type) {
+    case Int: return new(big.Rat).SetInt64(x.V), true
+    case Big: return new(big.Rat).SetInt(x.V), true
+    case Dec:
+        if x.R != nil { return x.R, true }
+        if math.IsInf(x.V, 0) || math.IsNaN(x.V) { return nil, false }
+        var buf [32]byte
+        r, ok := new(big.Rat).SetString(string(strconv.AppendFloat(buf[:0], x.V, 'g', -1, 64)))
+        return r, ok
+    }
+    return nil, false
+}
+
+func (v Big) float() float64 {
+    f, _ := new(big.Float).SetInt(v.V).Float64()
+    return f
+}
+
+// addInt, subInt, mulInt and divInt are int64 arithmetic that reports
+// whether the result fits; divInt expects a non-zero divisor.
+func addInt(a, b int64) (int64, bool) { n := a + b; return n, (n > a) == (b > 0) }
+
+func subInt(a, b int64) (int64, bool) { n := a - b; return n, (n < a) == (b > 0) }
+
+func mulInt(a, b int64) (int64, bool) {
+    if a == 0 || b == 0 { return 0, true }
+    n := a * b
+    // MinInt64 * -1 wraps to MinInt64, which n / b doesn't catch
+    return n, n/b == a && !(a == math.MinInt64 && b == -1)
+}
+
+func divInt(a, b int64) (int64, bool) { return a / b, !(a == math.MinInt64 && b == -1) }
+
+func gcdInt(a, b int64) int64 {
+    for b != 0 { a, b = b, a%b }
+    if a < 0 { return -a }
+    return a
+}
+
+// gcd and lcm are never negative, and like the arithmetic operators give a
+// Big when the result doesn't fit an Int.
+func gcd(a, b Value) Value {
+    if x, y, ok := negatableInts(a, b); ok { return intValue(gcdInt(x, y)) }
+    x, _ := toBig(a)
+    y, _ := toBig(b)
+    return bigValue(new(big.Int).GCD(nil, nil, x, y))
+}
+
+func lcm(a, b Value) Value {
+    if x, y, ok := negatableInts(a, b); ok {
+        if x == 0 || y == 0 { return intValue(0) }
+        if l, ok := mulInt(x/gcdInt(x, y), y); ok && l != math.MinInt64 {
+            if l < 0 { return intValue(-l) }
+            return intValue(l)
+        }
+    }
+    x, _ := toBig(a)
+    y, _ := toBig(b)
+    if x.Sign() == 0 || y.Sign() == 0 { return intValue(0) }
+    l := new(big.Int).Quo(x, new(big.Int).GCD(nil, nil, x, y))
+    return bigValue(l.Abs(l.Mul(l, y)))
+}
+
+// negatableInts is a and b as int64s when both are Ints that can be negated
+// without overflowing.
+func negatableInts(a, b Value) (x, y int64, ok bool) {
+    i, ok1 := a.(Int)
+    j, ok2 := b.(Int)
+    if !ok1 || !ok2 || i.V == math.MinInt64 || j.V == math.MinInt64 { return 0, 0, false }
+    return i.V, j.V, true
+}
+
+// argTypes lists the types of args, for an Unexpected argument error.
+func argTypes(args []Value) string {
+    names := make([]string, len(args))
+    for i, a := range args { names[i] = typeName(a) }
+    return strings.Join(names, ", ")
+}
+
+// integers unpacks a builtin's Integer arguments, given directly or as a
+// single List, for gcd and lcm.
+func integers(name string, args []Value) ([]Value, error) {
+    if l, ok := args[0].(List); ok && len(args) == 1 { args = l.Items }
+    for _, a := range args {
+        if _, ok := toBig(a); !ok { return nil, fmt.Errorf("Unexpected argument: %s(%s)", name, argTypes(args)) }
+    }
+    return args, nil
+}
+
+// A radix is the digits of a base, each worth its position less the
+// position of '0': "0123456789abcdef" is hexadecimal, and "=-012" is
+// balanced base 5, where '=' is -2 and '-' is -1.
+type radix struct {
+    digits []rune
+    zero   int
+    fold   bool // digits match either case, for the bases named by number
+}
+
+const alphanumeric = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// radixOf reads a base given as an Integer from 2 to 36 or a string of at
+// least two distinct digits.
+func radixOf(v Value) (radix, bool) {
+    switch x := v.(type) {
+    case Int:
+        if x.V < 2 || x.V > 36 { return radix{}, false }
+        return radix{digits: []rune(alphanumeric[:x.V]), fold: true}, true
+    case Str:
+        r := radix{digits: []rune(x.V)}
+        seen := map[rune]bool{}
+        for i, d := range r.digits {
+            if seen[d] { return radix{}, false }
+            seen[d] = true
+            if d == '0' { r.zero = i }
+        }
+        return r, len(r.digits) >= 2
+    }
+    return radix{}, false
+}
+
+// signed reports whether negative numbers need a '-', rather than having
+// negative digits of their own.
+func (r radix) signed() bool { return r.zero == 0 }
+
+func (r radix) value(d rune) (int64, bool) {
+    if r.fold { d = unicode.ToLower(d) }
+    for i, c := range r.digits {
+        if c == d { return int64(i - r.zero), true }
+    }
+    return 0, false
+}
+
+func (r radix) parse(s string) (*big.Int, bool) {
+    neg := false
+    if r.signed() && strings.HasPrefix(s, "-") { neg, s = true, s[1:] }
+    if s == "" { return nil, false }
+    b := big.NewInt(int64(len(r.digits)))
+    n := new(big.Int)
+    for _, d := range s {
+        v, ok := r.value(d)
+        if !ok { return nil, false }
+        n.Mul(n, b).Add(n, big.NewInt(v))
+    }
+    if neg { n.Neg(n) }
+    return n, true
+}
+
+func (r radix) format(n *big.Int) string {
+    if n.Sign() == 0 { return string(r.digits[r.zero]) }
+    b, lo := big.NewInt(int64(len(r.digits))), big.NewInt(int64(-r.zero))
+    x := new(big.Int).Set(n)
+    neg := r.signed() && n.Sign() < 0
+    if neg { x.Neg(x) }
+    var out []rune
+    d := new(big.Int)
+    for x.Sign() != 0 {
+        // the digit in [lo, lo+base) congruent to x, then the rest
+        d.Sub(x, lo).Mod(d, b).Add(d, lo)
+        out = append(out, r.digits[d.Int64()+int64(r.zero)])
+        x.Sub(x, d).Quo(x, b)
+    }
+    if neg { out = append(out, '-') }
+    slices.Reverse(out)
+    return string(out)
+}
+
+func parseInt(ev *Evaluator, args []Value) (Value, error) {
+    if _, ok := args[0].(Int); ok && len(args) == 1 { return &builtin{name: "parse_int", min: 2, max: 2, impl: parseInt, pre: args}, nil }
+    var named Value = Int{V: 10}
+    if len(args) == 2 { named = args[0] }
+    base, ok := radixOf(named)
+    s, isStr := args[len(args)-1].(Str)
+    if !ok || !isStr { return nil, fmt.Errorf("Unexpected argument: parse_int(%s)", argTypes(args)) }
+    n, ok := base.parse(strings.TrimSpace(s.V))
+    if !ok { return nil, fmt.Errorf("Unable to parse %s as an Integer in base %s", Format(s), Format(named)) }
+    return bigValue(n), nil
+}
+
+func (ev *Evaluator) defineNumberBuiltins(env *Env) {
+    // approx_eq(epsilon?, a, b): whether numbers a and b agree to within
+    // epsilon (1e-9 by default), relative to their size above 1
+    env.Define("approx_eq", newVariadicBuiltin("approx_eq", 2, 3, func(ev2 *Evaluator, args []Value) (Value, error) {
+        eps, ok := defaultEpsilon, true
+        if len(args) == 3 { eps, ok = toFloat(args[0]) }
+        a, ok1 := toFloat(args[len(args)-2])
+        b, ok2 := toFloat(args[len(args)-1])
+        if !ok || eps < 0 || !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: approx_eq(%s)", argTypes(args)) }
+        return boolValue(approxEqual(a, b, eps)), nil
+    }), false)
+    // gcd(a, b, ...) and lcm(a, b, ...): the greatest common divisor and least
+    // common multiple of the Integers, or of the Integers in a single list,
+    // never negative; an empty list gives 0 and 1, the values that leave the
+    // other Integers' results unchanged
+    type fold struct { op func(a, b Value) Value; empty int64 }
+    for name, f := range map[string]fold{"gcd": {gcd, 0}, "lcm": {lcm, 1}} {
+        env.Define(name, newVariadicBuiltin(name, 1, -1, func(ev2 *Evaluator, args []Value) (Value, error) {
+            ns, err := integers(name, args)
+            if err != nil { return nil, err }
+            if len(ns) == 0 { return intValue(f.empty), nil }
+            acc := f.op(ns[0], ns[0])
+            for _, n := range ns[1:] { acc = f.op(acc, n) }
+            return acc, nil
+        }), false)
+    }
+    // parse_int(base?, s): the Integer s writes in base (10 by default), an
+    // Integer from 2 to 36 or a string of digits (see radix). As an Integer
+    // can't itself be parsed, parse_int(2) is a partial application.
+    env.Define("parse_int", newVariadicBuiltin("parse_int", 1, 2, parseInt), false)
+    // to_base(base, n): n written in base, as parse_int reads it
+    env.Define("to_base", newBuiltin("to_base", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        base, ok1 := radixOf(args[0])
+        n, ok2 := toBig(args[1])
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: to_base(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        return Str{V: base.format(n)}, nil
+    }), false)
+    // divmod(a, b): [a / b, the remainder], truncating toward zero like /,
+    // so the remainder takes a's sign
+    env.Define("divmod", newBuiltin("divmod", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        if x, y, ok := negatableInts(args[0], args[1]); ok && y != 0 { return List{Items: []Value{intValue(x / y), intValue(x % y)}}, nil }
+        a, ok1 := toBig(args[0])
+        b, ok2 := toBig(args[1])
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: divmod(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        if b.Sign() == 0 { return nil, fmt.Errorf("Division by zero") }
+        q, r := new(big.Int).QuoRem(a, b, new(big.Int))
+        return List{Items: []Value{bigValue(q), bigValue(r)}}, nil
+    }), false)
+    // mod_pow(base, exp, mod): base to the power exp, modulo mod, in
+    // [0, mod) without overflowing along the way
+    env.Define("mod_pow", newBuiltin("mod_pow", 3, func(ev2 *Evaluator, args []Value) (Value, error) {
+        base, ok1 := toBig(args[0])
+        exp, ok2 := toBig(args[1])
+        mod, ok3 := toBig(args[2])
+        if !ok1 || !ok2 || !ok3 || exp.Sign() < 0 || mod.Sign() <= 0 { return nil, fmt.Errorf("Unexpected argument: mod_pow(%s, %s, %s)", typeName(args[0]), typeName(args[1]), typeName(args[2])) }
+        b := new(big.Int).Mod(base, mod)
+        return bigValue(b.Exp(b, exp, mod)), nil
+    }), false)
+}
@@ -0,0 +1,134 @@
+package evaluator
+
+import "testing"
+
+func TestApproxEq(t *testing.T) {
+    tests := []testCase{
+        {`approx_eq(0.1 + 0.2, 0.3)`, "true", ""},
+        {`approx_eq(1.0, 1.001)`, "false", ""},
+        {`approx_eq(0.01, 1.0, 1.001)`, "true", ""},
+        {`approx_eq(1, 1.0)`, "true", ""},
+        // relative above 1, so large values aren't held to a tighter bound
+        {`approx_eq(1000000000000.0001, 1000000000000)`, "true", ""},
+        {`[0.3, 0.4] |> map(approx_eq(0.1 + 0.2))`, "[true, false]", ""},
+        {`approx_eq("a", 1)`, "", "Unexpected argument: approx_eq(String, Integer)"},
+        {`approx_eq(-1, 1, 1)`, "", "Unexpected argument: approx_eq(Integer, Integer, Integer)"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestApproxEqual(t *testing.T) {
+    if !ApproxEqual(Dec{V: 0.1 + 0.2}, Dec{V: 0.3}) { t.Error("0.1 + 0.2 should approximately equal 0.3") }
+    if ApproxEqual(Int{V: 1}, Dec{V: 1 + 1e-12}) { t.Error("only two Decimals compare approximately") }
+    if !ApproxEqual(List{Items: []Value{Int{V: 1}}}, List{Items: []Value{Dec{V: 1}}}) { t.Error("other values compare with Equal") }
+}
+
+func TestIntegerMath(t *testing.T) {
+    tests := []testCase{
+        {`gcd(12, 18)`, "6", ""},
+        {`gcd(-4, 6, 10)`, "2", ""},
+        {`gcd([0, 0])`, "0", ""},
+        {`lcm(4, 6)`, "12", ""},
+        {`[3, 5, 7] |> lcm`, "105", ""},
+        {`lcm(-3)`, "3", ""},
+        {`[gcd([]), lcm([])]`, "[0, 1]", ""},
+        {`divmod(7, 2)`, "[3, 1]", ""},
+        {`divmod(-7, 2)`, "[-3, -1]", ""},
+        {`mod_pow(2, 10, 1000)`, "24", ""},
+        {`mod_pow(-2, 3, 5)`, "2", ""},
+        {`mod_pow(3, 200, 1000000007)`, "136318165", ""},
+        {`mod_pow(123456789, 1000000, 9223372036854775807) < 9223372036854775807`, "true", ""},
+        // results beyond an Int, and Big arguments, are Bigs
+        {`lcm(4611686018427387904, 3)`, "13835058055282163712", ""},
+        {`lcm([9223372036854775807, 2])`, "18446744073709551614", ""},
+        {`lcm(-9223372036854775807 - 1, 3)`, "27670116110564327424", ""},
+        {`gcd(-9223372036854775807 - 1, 0)`, "9223372036854775808", ""},
+        {`gcd(92233720368547758070, 10)`, "10", ""},
+        {`gcd([92233720368547758070, 36893488147419103228])`, "18446744073709551614", ""},
+        {`lcm(92233720368547758070, 4)`, "184467440737095516140", ""},
+        {`divmod(-9223372036854775807 - 1, -1)`, "[9223372036854775808, 0]", ""},
+        {`divmod(92233720368547758075, 10)`, "[9223372036854775807, 5]", ""},
+        {`divmod(-92233720368547758075, 92233720368547758070)`, "[-1, -5]", ""},
+        {`mod_pow(2, 100, 92233720368547758070)`, "18446744211148505086", ""},
+        {`mod_pow(92233720368547758071, 92233720368547758070, 7)`, "1", ""},
+        {`gcd(1, 2.0)`, "", "Unexpected argument: gcd(Integer, Decimal)"},
+        {`divmod(1, 0)`, "", "Division by zero"},
+        {`[7 % 3, -7 % 2, 7 % -2, 2 + 10 % 4 * 3]`, "[1, -1, 1, 8]", ""},
+        {`[18446744073709551617 % 10, 5 % 18446744073709551617, %(9, 4)]`, "[7, 5, 1]", ""},
+        {`[1, 2, 3, 4] |> filter(|n| n % 2 == 0)`, "[2, 4]", ""},
+        {`1 % 0`, "", "Division by zero"},
+        {`1.5 % 1`, "", "Unsupported operation: Decimal % Integer"},
+        {`"a" % 2`, "", "Unsupported operation: String % Integer"},
+        {`mod_pow(2, -1, 5)`, "", "Unexpected argument: mod_pow(Integer, Integer, Integer)"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestRadix(t *testing.T) {
+    tests := []testCase{
+        {`parse_int(" 42\n")`, "42", ""},
+        {`parse_int(2, "1011")`, "11", ""},
+        {`parse_int(16, "-FF")`, "-255", ""},
+        {`["10", "11"] |> map(parse_int(2))`, "[2, 3]", ""},
+        {`to_base(2, 11)`, `"1011"`, ""},
+        {`to_base(16, -255)`, `"-ff"`, ""},
+        {`to_base(36, 0)`, `"0"`, ""},
+        {`to_base(2, -9223372036854775807 - 1) |> size`, "65", ""},
+        // custom digits, including balanced ones worth less than zero
+        {`parse_int("=-012", "1=-0-2")`, "1747", ""},
+        {`to_base("=-012", 1747)`, `"1=-0-2"`, ""},
+        {`to_base("=-012", -3)`, `"-2"`, ""},
+        {`parse_int("=-012", "-2")`, "-3", ""},
+        {`to_base("ab", 5)`, `"bab"`, ""},
+        {`parse_int(2, "12")`, "", `Unable to parse "12" as an Integer in base 2`},
+        {`parse_int("99999999999999999999")`, "99999999999999999999", ""},
+        {`to_base(16, parse_int(16, "123456789abcdef0123"))`, `"123456789abcdef0123"`, ""},
+        {`parse_int(1, "0")`, "", "Unexpected argument: parse_int(Integer, String)"},
+        {`to_base("aa", 1)`, "", "Unexpected argument: to_base(String, Integer)"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestBigIntegers(t *testing.T) {
+    tests := []testCase{
+        {`let pow = |b, n| if n == 0 { 1 } else { b * pow(b, n - 1) }; pow(2, 70)`, "1180591620717411303424", ""},
+        {`9223372036854775807 + 1`, "9223372036854775808", ""},
+        {`-9223372036854775807 - 2`, "-9223372036854775809", ""},
+        {`let n = -9223372036854775807 - 1; [-n, n / -1, n * -1]`, "[9223372036854775808, 9223372036854775808, 9223372036854775808]", ""},
+        {`4611686018427387904 * 4 / 8`, "2305843009213693952", ""},
+        {`123_456_789_012_345_678_901_234_567_890 - 123_456_789_012_345_678_901_234_567_889`, "1", ""},
+        // back within int64 a result is an ordinary Integer again
+        {`let big = 9223372036854775807 * 2; [big / 2 == 9223372036854775807, {big / 2, 9223372036854775807} |> size]`, "[true, 1]", ""},
+        {`[2 * 9223372036854775807 > 9223372036854775807, -9223372036854775809 < -9223372036854775808]`, "[true, true]", ""},
+        {`sort([100000000000000000000, 1, -100000000000000000000, 1.5])`, "[-100000000000000000000, 1, 1.5, 100000000000000000000]", ""},
+        {`[18446744073709551616 == 18446744073709551616.0, #{18446744073709551616: 1}[18446744073709551616]]`, "[true, 1]", ""},
+        {`18446744073709551616 + 0.5`, "18446744073709551616.5", ""},
+        {`"n=" + 18446744073709551616`, `"n=18446744073709551616"`, ""},
+        {`18446744073709551616 + []`, "", "Unsupported operation: Integer + List"},
+        {`18446744073709551616 / 0`, "", "Division by zero"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+    tests := []testCase{
+        {`0.1 + 0.2`, "0.3", ""},
+        {`[0.1 + 0.2 == 0.3, 0.3 - 0.1 == 0.2, 1.1 * 1.1 == 1.21]`, "[true, true, true]", ""},
+        {`3.14 + 1`, "4.14", ""},
+        {`[1.1 * 3, 0.7 / 0.1, 2.675 * 100, 10 / 2.5]`, "[3.3, 7, 267.5, 4]", ""},
+        {`[1 / 3.0, 2 / 3.0]`, "[0.3333333333333333, 0.6666666666666666]", ""},
+        {`0.1 * 3 > 0.3`, "false", ""},
+        {`[0.0000001 * 3, 100000000000000000000.5 + 1]`, "[0.0000003, 100000000000000000001.5]", ""},
+        // too many digits for an int64, so exact with big.Rats
+        {`0.3333333333333333 * 0.3333333333333333`, "0.11111111111111108888888888888889", ""},
+        {`123456789.123456789 * 1000`, "123456789123.456789", ""},
+        {`[1.0 / 3 * 3, 1.0 / 3, -(2.0 / 3) * 3]`, "[1, 0.3333333333333333, -2]", ""},
+        {`[1.0 / 3 == 0.3333333333333333, 1.0 / 3 > 0.3333333333333333, 10.0 / 3 * 3 == 10]`, "[false, true, true]", ""},
+        {`18446744073709551616 * 0.5 == 9223372036854775808`, "true", ""},
+        {`[1, 2, 3] |> map(|n| n * 0.1) |> fold(0, |a, b| a + b)`, "0.6", ""},
+        {`[1.5e9, 2E-3, 1_000.5e2, 1.50e10, -2.5e+2]`, "[1500000000, 0.002, 100050, 15000000000, -250]", ""},
+        {`[1e3 == 1000, 1e-7 + 2e-7, 6.02e23 / 1e23]`, "[true, 0.0000003, 6.02]", ""},
+        {`1.5 / 0`, "", "Division by zero"},
+    }
+    runCases(t, "", tests)
+}
@@ -0,0 +1,75 @@
+package evaluator
+
+import "fmt"
+
+// PQueue is an immutable priority queue: a persistent leftist heap, so
+// pushing and popping are O(log n) and leave the queue they started from
+// untouched. Lower priorities come out first, and equal priorities in the
+// order they went in. Like functions, queues aren't compared by content.
+type PQueue struct {
+    root *pqNode
+    size int
+    seq  uint64 // pushes so far, ordering equal priorities
+}
+
+type pqNode struct {
+    prio, val   Value
+    seq         uint64
+    rank        int // length of the rightmost path
+    left, right *pqNode
+}
+
+func (q PQueue) repr() string { return fmt.Sprintf("priority_queue(<%d>)", q.size) }
+
+func (n *pqNode) before(m *pqNode) bool {
+    c := compare(n.prio, m.prio)
+    return c < 0 || c == 0 && n.seq < m.seq
+}
+
+func rank(n *pqNode) int {
+    if n == nil { return 0 }
+    return n.rank
+}
+
+// meld merges two heaps, copying only the nodes along their right spines.
+func meld(a, b *pqNode) *pqNode {
+    if a == nil { return b }
+    if b == nil { return a }
+    if b.before(a) { a, b = b, a }
+    l, r := a.left, meld(a.right, b)
+    if rank(l) < rank(r) { l, r = r, l }
+    return &pqNode{prio: a.prio, val: a.val, seq: a.seq, rank: rank(r) + 1, left: l, right: r}
+}
+
+func (q PQueue) push(prio, v Value) PQueue {
+    return PQueue{root: meld(q.root, &pqNode{prio: prio, val: v, seq: q.seq, rank: 1}), size: q.size + 1, seq: q.seq + 1}
+}
+
+// pop returns the first entry's priority and value and the queue without
+// it; q must not be empty.
+func (q PQueue) pop() (prio, v Value, rest PQueue) {
+    return q.root.prio, q.root.val, PQueue{root: meld(q.root.left, q.root.right), size: q.size - 1, seq: q.seq}
+}
+
+func (ev *Evaluator) definePQueueBuiltins(env *Env) {
+    // priority_queue(): an empty queue
+    env.Define("priority_queue", newBuiltin("priority_queue", 0, func(ev2 *Evaluator, args []Value) (Value, error) {
+        return PQueue{}, nil
+    }), false)
+    // pq_push(priority, v, pq): pq with v added at priority; the queue comes
+    // last like every collection, so pushes thread: pq |> pq_push(0, start)
+    env.Define("pq_push", newBuiltin("pq_push", 3, func(ev2 *Evaluator, args []Value) (Value, error) {
+        q, ok := args[2].(PQueue)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: pq_push(%s, %s, %s)", typeName(args[0]), typeName(args[1]), typeName(args[2])) }
+        return q.push(args[0], args[1]), nil
+    }), false)
+    // pq_pop(pq): [priority, v, rest] for the lowest priority entry, or nil
+    // when pq is empty
+    env.Define("pq_pop", newBuiltin("pq_pop", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        q, ok := args[0].(PQueue)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: pq_pop(%s)", typeName(args[0])) }
+        if q.root == nil { return Nil{}, nil }
+        prio, v, rest := q.pop()
+        return List{Items: []Value{prio, v, rest}}, nil
+    }), false)
+}
@@ -0,0 +1,22 @@
+package evaluator
+
+import "testing"
+
+func TestPriorityQueue(t *testing.T) {
+    prelude := `let q = priority_queue() |> pq_push(5, "e") |> pq_push(1, "a") |> pq_push(3, "c") |> pq_push(1, "b");
+let drain = |q| if q { let t = pq_pop(q); [t[1]] + drain(t[2]) } else { [] };
+`
+    tests := []testCase{
+        // lowest priority first, ties in insertion order
+        {`drain(q)`, `["a", "b", "c", "e"]`, ""},
+        {`pq_pop(q) |> first`, `1`, ""},
+        // popping and pushing leave the original queue as it was
+        {`let r = pq_pop(q)[2]; [size(r), size(q), drain(pq_push(0, "z", r))]`, `[3, 4, ["z", "b", "c", "e"]]`, ""},
+        {`priority_queue() |> pq_push([1, 2], "l") |> pq_push([1, 1], "k") |> drain`, `["k", "l"]`, ""},
+        {`pq_pop(priority_queue())`, `nil`, ""},
+        {`if priority_queue() { 1 } else { 2 }`, `2`, ""},
+        {`pq_pop([1])`, "", "Unexpected argument: pq_pop(List)"},
+        {`pq_push(1, 2, [])`, "", "Unexpected argument: pq_push(Integer, Integer, List)"},
+    }
+    runCases(t, prelude, tests)
+}
@@ -0,0 +1,32 @@
+package evaluator
+
+import (
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+func TestPutsOutput(t *testing.T) {
+    tests := []struct{ src, want, joined string }{
+        {`puts(1)`, "1 \n", "1\n"},
+        {`puts(1, 2)`, "1 2 \n", "1 2\n"},
+        {`puts("a", [1, 2], nil)`, "\"a\" [1, 2] nil \n", "\"a\" [1, 2] nil\n"},
+        {`puts()`, "\n", "\n"},
+        {`puts(); puts(1, 2); puts()`, "\n1 2 \n\n", "\n1 2\n\n"},
+        {`[1, 2] |> map(puts)`, "1 \n2 \n", "1\n2\n"},
+    }
+    for _, tt := range tests {
+        prog, err := parser.Parse(tt.src)
+        if err != nil { t.Fatalf("%s: %v", tt.src, err) }
+        for _, join := range []bool{false, true} {
+            var out strings.Builder
+            ev := New(&out)
+            ev.SetJoinPuts(join)
+            if _, err := ev.Eval(prog); err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+            want := tt.want
+            if join { want = tt.joined }
+            if out.String() != want { t.Errorf("%s (joined %v): got %q, want %q", tt.src, join, out.String(), want) }
+        }
+    }
+}
@@ -0,0 +1,34 @@
+package evaluator
+
+import (
+    "fmt"
+    "math/rand/v2"
+)
+
+// SetSeed makes the random builtins deterministic: the same seed produces
+// the same sequence of results for the whole run.
+func (ev *Evaluator) SetSeed(seed uint64) { ev.rng = rand.New(rand.NewPCG(seed, seed)) }
+
+func (ev *Evaluator) random() *rand.Rand {
+    if ev.rng == nil { ev.rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())) }
+    return ev.rng
+}
+
+func (ev *Evaluator) defineRandomBuiltins(env *Env) {
+    // rand_int(min, max): a random integer between min and max inclusive
+    env.Define("rand_int", newBuiltin("rand_int", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        lo, ok1 := args[0].(Int)
+        hi, ok2 := args[1].(Int)
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: rand_int(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        if lo.V > hi.V { lo, hi = hi, lo }
+        return Int{V: lo.V + ev2.random().Int64N(hi.V-lo.V+1)}, nil
+    }), false)
+    env.Define("shuffle", newBuiltin("shuffle", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        list, ok := args[0].(List)
+        if !ok { return nil, fmt.Errorf("shuffle(...): invalid argument type, expected List, found %s", typeName(args[0])) }
+        items := make([]Value, len(list.Items))
+        copy(items, list.Items)
+        ev2.random().Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+        return List{Items: items}, nil
+    }), false)
+}
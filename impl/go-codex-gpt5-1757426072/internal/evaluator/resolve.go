@@ -0,0 +1,262 @@
+package evaluator
+
+import "elf-lang/impl/internal/parser"
+
+// The resolver rewrites an AST before evaluation so that identifiers carry
+// the (depth, slot) address of their binding and every block records the
+// slot layout of its scope, letting the evaluator index environments rather
+// than search them by name.
+//
+// Every `let` in a scope is given a slot up front. A reference that runs
+// before its let (or that an import() may have rebound) finds the slot unset
+// or misnamed and falls back to a lookup by name, which keeps the semantics
+// of the name-based environments: bindings are only visible once defined.
+
+// rscope is the resolver's view of a runtime scope: either an existing Env
+// (the program or module scope and everything enclosing it) or the layout
+// of a block or call environment created later.
+type rscope struct {
+    parent *rscope
+    env    *Env     // existing environment, nil for a future one
+    names  []string // layout of a future environment
+    open   bool     // an import() may bind further names here at runtime
+}
+
+func (s *rscope) slot(name string) int {
+    if s.env != nil { return s.env.slot(name) }
+    return lastIndex(s.names, name)
+}
+
+func (s *rscope) declare(name string) {
+    if s.slot(name) >= 0 { return }
+    if s.env != nil {
+        s.env.reserve(name)
+        return
+    }
+    s.names = append(s.names, name)
+}
+
+func (s *rscope) ref(name string) parser.Ref {
+    depth := 0
+    for cur := s; cur != nil; cur = cur.parent {
+        if i := cur.slot(name); i >= 0 { return parser.Ref{Depth: depth, Slot: i, Resolved: true, Builtin: cur.parent == nil} }
+        // an import may define the name here at runtime, shadowing outer scopes
+        if cur.open { break }
+        depth++
+    }
+    return parser.Ref{}
+}
+
+// envScopes returns resolver scopes mirroring env and its enclosing envs.
+func envScopes(env *Env) *rscope {
+    if env == nil { return nil }
+    return &rscope{parent: envScopes(env.outer), env: env}
+}
+
+// resolveProgram resolves top-level statements in the evaluator's current
+// scope; sections are left for EvalBlock to resolve when they run.
+func (ev *Evaluator) resolveProgram(prog parser.Program) parser.Program {
+    prog.Statements = resolveStmts(prog.Statements, envScopes(ev.env))
+    return prog
+}
+
+// resolveBlock resolves a block that will run in a child of the current scope.
+func (ev *Evaluator) resolveBlock(b parser.Block) parser.Block { return resolveBlock(b, envScopes(ev.env)) }
+
+func resolveBlock(b parser.Block, parent *rscope) parser.Block {
+    s := &rscope{parent: parent}
+    declare(b.Statements, s)
+    if len(s.names) == 0 && !s.open {
+        // a block binding nothing runs in its enclosing scope
+        b.Statements, b.Names = resolveStmts(b.Statements, parent), nil
+        return b
+    }
+    b.Statements = resolveStmts(b.Statements, s)
+    b.Names = append(make([]string, 0, len(s.names)), s.names...)
+    return b
+}
+
+func resolveStmts(stmts []parser.Statement, s *rscope) []parser.Statement {
+    declare(stmts, s)
+    out := make([]parser.Statement, len(stmts))
+    for i, st := range stmts {
+        if es, ok := st.(parser.ExpressionStmt); ok {
+            es.Value = resolveExpr(es.Value, s)
+            st = es
+        }
+        out[i] = st
+    }
+    return out
+}
+
+// declare gives every let in stmts a slot in s, and marks s open if they
+// import a module.
+func declare(stmts []parser.Statement, s *rscope) {
+    for _, st := range stmts {
+        es, ok := st.(parser.ExpressionStmt)
+        if !ok { continue }
+        eachDirect(es.Value, func(e parser.Expr) {
+            switch x := e.(type) {
+            case parser.LetExpr:
+                s.declare(x.Name.Name)
+            case parser.CallExpr:
+                if id, ok := x.Function.(parser.Identifier); ok && id.Name == "import" { s.open = true }
+            }
+        })
+    }
+}
+
+// eachDirect calls fn for e and its subexpressions evaluated in the same
+// scope, not descending into blocks or function bodies.
+func eachDirect(e parser.Expr, fn func(parser.Expr)) {
+    fn(e)
+    each := func(es ...parser.Expr) { for _, x := range es { eachDirect(x, fn) } }
+    switch x := e.(type) {
+    case parser.LetExpr: each(x.Value)
+    case parser.AssignExpr: each(x.Value)
+    case parser.InfixExpr: each(x.Left, x.Right)
+    case parser.PrefixExpr: each(x.Operand)
+    case parser.Spread: each(x.Value)
+    case parser.ListLit: each(x.Items...)
+    case parser.SetLit: each(x.Items...)
+    case parser.DictLit:
+        for _, it := range x.Items { each(it.Key, it.Value) }
+    case parser.IndexExpr: each(x.Left, x.Index)
+    case parser.IfExpr: each(x.Condition)
+    case parser.MatchExpr: each(x.Subject)
+    case parser.LoopExpr:
+        if x.Condition != nil { each(x.Condition) }
+    case parser.BreakExpr:
+        if x.Value != nil { each(x.Value) }
+    case parser.CallExpr:
+        each(x.Function)
+        each(x.Arguments...)
+    case parser.FunctionComposition: each(x.Functions...)
+    case parser.FunctionThread:
+        each(x.Initial)
+        each(x.Functions...)
+    }
+}
+
+func resolveExprs(es []parser.Expr, s *rscope) []parser.Expr {
+    if es == nil { return nil }
+    out := make([]parser.Expr, len(es))
+    for i, e := range es { out[i] = resolveExpr(e, s) }
+    return out
+}
+
+func resolveExpr(e parser.Expr, s *rscope) parser.Expr {
+    switch x := e.(type) {
+    case parser.Identifier:
+        x.Ref = s.ref(x.Name)
+        return x
+    case parser.LetExpr:
+        x.Value = resolveExpr(x.Value, s)
+        x.Name.Ref = s.ref(x.Name.Name)
+        return x
+    case parser.AssignExpr:
+        x.Value = resolveExpr(x.Value, s)
+        x.Name.Ref = s.ref(x.Name.Name)
+        return x
+    case parser.FunctionLit:
+        // calls bind the parameters in their own scope, the body in a child
+        fs := &rscope{parent: s}
+        params := make([]parser.Identifier, len(x.Parameters))
+        for i, p := range x.Parameters {
+            fs.names = append(fs.names, p.Name)
+            p.Ref = parser.Ref{Slot: i, Resolved: true}
+            params[i] = p
+        }
+        if x.Parameters == nil { params = nil }
+        x.Parameters, x.Body = params, resolveBlock(x.Body, fs)
+        return x
+    case parser.InfixExpr:
+        x.Left, x.Right = resolveExpr(x.Left, s), resolveExpr(x.Right, s)
+        return x
+    case parser.PrefixExpr:
+        x.Operand = resolveExpr(x.Operand, s)
+        return x
+    case parser.Spread:
+        x.Value = resolveExpr(x.Value, s)
+        return x
+    case parser.ListLit:
+        x.Items = resolveExprs(x.Items, s)
+        return x
+    case parser.SetLit:
+        x.Items = resolveExprs(x.Items, s)
+        return x
+    case parser.DictLit:
+        if x.Items == nil { return x }
+        items := make([]parser.DictEntry, len(x.Items))
+        for i, it := range x.Items { items[i] = parser.DictEntry{Key: resolveExpr(it.Key, s), Value: resolveExpr(it.Value, s)} }
+        x.Items = items
+        return x
+    case parser.IndexExpr:
+        x.Left, x.Index = resolveExpr(x.Left, s), resolveExpr(x.Index, s)
+        return x
+    case parser.IfExpr:
+        x.Condition = resolveExpr(x.Condition, s)
+        x.Consequence = resolveBlock(x.Consequence, s)
+        if x.Alternative != nil {
+            alt := resolveBlock(*x.Alternative, s)
+            x.Alternative = &alt
+        }
+        return x
+    case parser.LoopExpr:
+        if x.Condition != nil { x.Condition = resolveExpr(x.Condition, s) }
+        x.Body = resolveBlock(x.Body, s)
+        return x
+    case parser.BreakExpr:
+        if x.Value != nil { x.Value = resolveExpr(x.Value, s) }
+        return x
+    case parser.MatchExpr:
+        // each case binds its pattern's names in its own scope, the body in a child
+        x.Subject = resolveExpr(x.Subject, s)
+        cases := make([]parser.MatchCase, len(x.Cases))
+        for i, c := range x.Cases {
+            cs := &rscope{parent: s}
+            for _, id := range parser.PatternNames(c.Pattern) { cs.declare(id.Name) }
+            if len(cs.names) == 0 {
+                c.Body = resolveBlock(c.Body, s)
+            } else {
+                c.Pattern, c.Body, c.Names = resolvePattern(c.Pattern, cs), resolveBlock(c.Body, cs), cs.names
+            }
+            cases[i] = c
+        }
+        x.Cases = cases
+        return x
+    case parser.CallExpr:
+        x.Function, x.Arguments = resolveExpr(x.Function, s), resolveExprs(x.Arguments, s)
+        return x
+    case parser.FunctionComposition:
+        x.Functions = resolveExprs(x.Functions, s)
+        return x
+    case parser.FunctionThread:
+        x.Initial, x.Functions = resolveExpr(x.Initial, s), resolveExprs(x.Functions, s)
+        return x
+    }
+    return e
+}
+
+// resolvePattern addresses the names a pattern binds by their slot in the
+// case scope cs.
+func resolvePattern(pat parser.Expr, cs *rscope) parser.Expr {
+    switch x := pat.(type) {
+    case parser.Identifier:
+        x.Ref = parser.Ref{Slot: cs.slot(x.Name), Resolved: true}
+        return x
+    case parser.ListLit:
+        items := make([]parser.Expr, len(x.Items))
+        for i, it := range x.Items { items[i] = resolvePattern(it, cs) }
+        x.Items = items
+        return x
+    }
+    return pat
+}
+
+func lastIndex(names []string, name string) int {
+    for i := len(names) - 1; i >= 0; i-- {
+        if names[i] == name { return i }
+    }
+    return -1
+}
@@ -0,0 +1,85 @@
+package evaluator
+
+import (
+    "fmt"
+    "strings"
+)
+
+// contains reports whether v is a member of s.
+func (s Set) contains(v Value) bool {
+    if s.index == nil { s = newSet(s.Items) }
+    s.index.mu.RLock()
+    defer s.index.mu.RUnlock()
+    return s.find(hashValue(v), v) >= 0
+}
+
+// find returns the position of v (hashing to h) among the items, or -1.
+// The caller holds the index lock.
+func (s Set) find(h uint64, v Value) int {
+    return s.index.find(len(s.Items), h, func(i int) bool { return equal(s.Items[i], v) })
+}
+
+// equals reports whether s and t have the same members, looking each of
+// s's up in t rather than sorting both.
+func (s Set) equals(t Set) bool {
+    if len(s.Items) != len(t.Items) { return false }
+    for _, v := range s.Items {
+        if !t.contains(v) { return false }
+    }
+    return true
+}
+
+// with returns s with v added, or s itself when v is already a member.
+// Pushing onto the newest version appends in place; pushing onto an older
+// one copies the items and indexes them afresh.
+func (s Set) with(v Value) Set {
+    if s.index == nil { s = newSet(s.Items) }
+    h := hashValue(v)
+    idx := s.index
+    idx.mu.Lock()
+    defer idx.mu.Unlock()
+    if s.find(h, v) >= 0 { return s }
+    n := len(s.Items)
+    if idx.claim(n, h) { return Set{Items: append(s.Items, v), sorted: &sortedView[Value]{}, index: idx} }
+    items := make([]Value, n, max(2*n, 4))
+    copy(items, s.Items)
+    fresh := newHashIndex(n, func(i int) uint64 { return hashValue(items[i]) })
+    fresh.claim(n, h)
+    return Set{Items: append(items, v), sorted: &sortedView[Value]{}, index: fresh}
+}
+
+func (ev *Evaluator) defineSetBuiltins(env *Env) {
+    // to_list(coll): a set's elements in the order they were added, a list as
+    // is, or the items of any other iterable (see open)
+    env.Define("to_list", newBuiltin("to_list", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        switch x := args[0].(type) {
+        case Set: return List{Items: x.Items[:len(x.Items):len(x.Items)]}, nil
+        case List: return x, nil
+        }
+        if next, ok := open(args[0]); ok {
+            items, err := collect(ev2, next)
+            if err != nil { return nil, err }
+            return List{Items: items}, nil
+        }
+        return nil, fmt.Errorf("Unexpected argument: to_list(%s)", typeName(args[0]))
+    }), false)
+    // sort_sets(on): whether sets print in ascending order (the default) or
+    // in the order their elements were added
+    env.Define("sort_sets", newBuiltin("sort_sets", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        on, ok := args[0].(Bool)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: sort_sets(%s)", typeName(args[0])) }
+        ev2.SetSortSets(on.V)
+        return Nil{}, nil
+    }), false)
+    // contains?(v, set): whether v is a member of set; contains?(sub, s):
+    // whether sub occurs in the string s
+    env.Define("contains?", newBuiltin("contains?", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        switch coll := args[1].(type) {
+        case Set:
+            return boolValue(coll.contains(args[0])), nil
+        case Str:
+            if sub, ok := args[0].(Str); ok { return boolValue(strings.Contains(coll.V, sub.V)), nil }
+        }
+        return nil, fmt.Errorf("Unexpected argument: contains?(%s, %s)", typeName(args[0]), typeName(args[1]))
+    }), false)
+}
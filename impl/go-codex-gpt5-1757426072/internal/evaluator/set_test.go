@@ -0,0 +1,24 @@
+package evaluator
+
+import "testing"
+
+func TestSets(t *testing.T) {
+    // n distinct pushes, each checked for membership: quadratic with scans
+    big := "let n = 100000;\nlet add = |s, i| if contains?(i, s) { s } else { push(i, s) };\nlet s = range(0, n) |> fold({}, add);\n"
+    tests := []testCase{
+        {`{3, 1, 2, 1, 1.0}`, "{1, 2, 3}", ""},
+        {`{[1, 2], [1, 2], {1}, {1}}`, "{[1, 2], {1}}", ""},
+        {`push(2, {1, 2}) |> size`, "2", ""},
+        {`{1, 2} + {2, 3}`, "{1, 2, 3}", ""},
+        {`{1, 2, 3} == {3, 2, 1}`, "true", ""},
+        {`{1, 2} != {1, 3}`, "true", ""},
+        {`{{1, 2}} == {{2, 1}}`, "true", ""},
+        {`contains?([0, 1], {[0, 1]})`, "true", ""},
+        {`{[0, 1]} |> contains?([1, 0])`, "false", ""},
+        {big + `size(s)`, "100000", ""},
+        {big + `[contains?(n - 1, s), contains?(n, s)]`, "[true, false]", ""},
+        {big + `s == (range(0, n) |> fold({}, add))`, "true", ""},
+        {big + `range(0, n) |> map(|i| i / 2) |> fold({}, |acc, i| push(i, acc)) |> size`, "50000", ""},
+    }
+    runCases(t, "", tests)
+}
@@ -0,0 +1,31 @@
+package evaluator
+
+// segmentDepth is how many nested user function calls share one goroutine
+// stack. Go caps a goroutine's stack (1GB by default) and overflowing it is a
+// fatal error, so every segmentDepth calls evaluation continues on a fresh
+// goroutine: recursion depth is then bounded by the heap rather than by a
+// single stack.
+const segmentDepth = 10000
+
+// onNewStack runs fn on a new goroutine, blocking until it returns. Only one
+// goroutine runs the evaluator at a time, and a panic is re-raised here so it
+// is recovered as usual.
+func onNewStack(fn func() (Value, error)) (Value, error) {
+    type outcome struct {
+        v     Value
+        err   error
+        panic any
+    }
+    done := make(chan outcome)
+    go func() {
+        var o outcome
+        defer func() {
+            o.panic = recover()
+            done <- o
+        }()
+        o.v, o.err = fn()
+    }()
+    o := <-done
+    if o.panic != nil { panic(o.panic) }
+    return o.v, o.err
+}
@@ -0,0 +1,65 @@
+package evaluator
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "testing"
+
+    "elf-lang/impl/internal/crash"
+    "elf-lang/impl/internal/parser"
+)
+
+func TestDeepRecursion(t *testing.T) {
+    deep := segmentDepth*5 + 3
+    tests := []testCase{
+        {fmt.Sprintf("let f = |n| if n == 0 { 0 } else { 1 + f(n - 1) };\nf(%d)", deep), fmt.Sprint(deep), ""},
+        // a loop on the new stack, and one around calls that hop to it
+        {fmt.Sprintf("let f = |n| if n == 0 {\n  let mut i = 0;\n  loop { i = i + 1; if i < 5 { continue }; break i * 10 }\n} else { f(n - 1) };\nf(%d)", segmentDepth-1), "50", ""},
+        {fmt.Sprintf("let f = |n| if n == 0 { 0 } else { 1 + f(n - 1) };\nlet mut i = 0;\nlet mut r = [];\nwhile true {\n  i = i + 1;\n  if i == 2 { continue }\n  r = push(f(%d), r);\n  if i == 3 { break r }\n}", deep), fmt.Sprintf("[%d, %d]", deep, deep), ""},
+    }
+    runCases(t, "", tests)
+}
+
+func TestDeepRuntimeError(t *testing.T) {
+    deep := segmentDepth*2 + 5
+    src := fmt.Sprintf("let f = |n| if n == 0 { 1 / 0 } else { f(n - 1) };\nf(%d)", deep)
+    prog, err := parser.Parse(src)
+    if err != nil { t.Fatal(err) }
+    _, err = New(io.Discard).Eval(prog)
+    var re *RuntimeError
+    if !errors.As(err, &re) { t.Fatalf("got %v, want a RuntimeError", err) }
+    if re.Error() != "Division by zero" || re.Site != "1:27" { t.Errorf("got %q at %s, want Division by zero at 1:27", re.Error(), re.Site) }
+    if len(re.Stack) != deep+1 { t.Fatalf("got %d frames, want %d", len(re.Stack), deep+1) }
+    if f := re.Stack[0]; f.Function != "f" || f.Site != "1:40" { t.Errorf("innermost frame: got %+v", f) }
+    if f := re.Stack[deep]; f.Function != "f" || f.Site != "2:1" { t.Errorf("outermost frame: got %+v", f) }
+}
+
+func TestOnNewStack(t *testing.T) {
+    signal := &loopSignal{brk: true, val: Int{V: 7}}
+    v, err := onNewStack(func() (Value, error) { return nil, signal })
+    if v != nil || err != signal { t.Errorf("got %v, %v, want the break signal", v, err) }
+    v, err = onNewStack(func() (Value, error) { return nil, errContinue })
+    if v != nil || err != errContinue { t.Errorf("got %v, %v, want the continue signal", v, err) }
+    v, err = onNewStack(func() (Value, error) { return Int{V: 3}, nil })
+    if err != nil || Format(v) != "3" { t.Errorf("got %v, %v, want 3", v, err) }
+
+    // a panic on the new stack is re-raised on the caller's
+    defer func() {
+        if r := recover(); r != "boom" { t.Errorf("got panic %v, want boom", r) }
+    }()
+    onNewStack(func() (Value, error) { panic("boom") })
+    t.Error("panic not re-raised")
+}
+
+// A panic deep in the recursion reaches Eval's recover on the caller's stack
+// rather than crashing the process from the goroutine it happened on.
+func TestDeepPanic(t *testing.T) {
+    prog, err := parser.Parse(fmt.Sprintf("let f = |n| if n == 0 { boom(n) } else { f(n - 1) };\nf(%d)", segmentDepth*2))
+    if err != nil { t.Fatal(err) }
+    ev := New(io.Discard)
+    ev.Define("boom", newBuiltin("boom", 1, func(*Evaluator, []Value) (Value, error) { panic("boom") }))
+    _, err = ev.Eval(prog)
+    var ie *crash.InternalError
+    if !errors.As(err, &ie) || ie.Value != "boom" { t.Errorf("got %v, want an internal error for boom", err) }
+}
@@ -0,0 +1,51 @@
+package evaluator
+
+import "runtime/metrics"
+
+// Stats counts the work done by an evaluator; it is only gathered once
+// EnableStats has been called.
+type Stats struct {
+    Evals        int64            // expression evaluations
+    BuiltinCalls map[string]int64 // saturated builtin calls by name
+    PeakHeap     uint64           // highest sampled live heap, in bytes
+}
+
+// heapSampleInterval is the number of evaluations between live-heap samples.
+const heapSampleInterval = 1 << 14
+
+// liveHeap samples the bytes occupied by heap objects, including garbage
+// not yet collected.
+func liveHeap() uint64 {
+    sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+    metrics.Read(sample)
+    if sample[0].Value.Kind() != metrics.KindUint64 { return 0 }
+    return sample[0].Value.Uint64()
+}
+
+// EnableStats starts gathering evaluation statistics.
+func (ev *Evaluator) EnableStats() { ev.stats = newStats() }
+
+// TakeStats returns the statistics gathered since stats were enabled or last
+// taken, and starts a fresh count. It returns nil when stats are disabled.
+func (ev *Evaluator) TakeStats() *Stats {
+    if ev.stats == nil { return nil }
+    s := ev.stats
+    s.sampleHeap()
+    ev.stats = newStats()
+    return s
+}
+
+func newStats() *Stats {
+    s := &Stats{BuiltinCalls: map[string]int64{}}
+    s.sampleHeap()
+    return s
+}
+
+func (s *Stats) countEval() {
+    s.Evals++
+    if s.Evals%heapSampleInterval == 0 { s.sampleHeap() }
+}
+
+func (s *Stats) sampleHeap() {
+    if h := liveHeap(); h > s.PeakHeap { s.PeakHeap = h }
+}
@@ -0,0 +1,298 @@
+package evaluator
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// Regex is a compiled regular expression, made by regex(pattern) and used
+// as a separator by split.
+type Regex struct{ re *regexp.Regexp }
+
+func (r Regex) repr() string { return "regex(" + Format(Str{V: r.re.String()}) + ")" }
+
+// display renders v the way it reads inside a larger string: a string as
+// its bare contents, anything else as it prints.
+func display(v Value) string {
+    if s, ok := v.(Str); ok { return s.V }
+    return v.repr()
+}
+
+// concatenable reports whether v joins a string under +. Only scalars do;
+// a collection or function has to go through str first, so its quoting is
+// never a surprise.
+func concatenable(v Value) bool {
+    switch v.(type) {
+    case Str, Int, Big, Dec, Bool, Nil: return true
+    }
+    return false
+}
+
+func (ev *Evaluator) defineStringBuiltins(env *Env) {
+    // str(v): v as a string, bare for a string and as printed otherwise, so
+    // nested strings keep their quotes: str(["a"]) is "[\"a\"]"
+    env.Define("str", newBuiltin("str", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        return Str{V: display(args[0])}, nil
+    }), false)
+    // regex(pattern): pattern compiled, in Go's RE2 syntax
+    env.Define("regex", newBuiltin("regex", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        s, ok := args[0].(Str)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: regex(%s)", typeName(args[0])) }
+        re, err := regexp.Compile(s.V)
+        if err != nil { return nil, fmt.Errorf("Invalid regex %s: %s", Format(s), strings.TrimPrefix(err.Error(), "error parsing regexp: ")) }
+        return Regex{re: re}, nil
+    }), false)
+    // split(sep, s): s split on each sep string, or on each match of a sep
+    // regex; split(",") is a partial application for map and composition
+    env.Define("split", newBuiltin("split", 2, splitString), false)
+    // words(s): s split on runs of whitespace
+    env.Define("words", newBuiltin("words", 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        s, ok := args[0].(Str)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: words(%s)", typeName(args[0])) }
+        return strList(strings.Fields(s.V)), nil
+    }), false)
+    // join(sep, xs): the items of xs in display form, with sep between them
+    env.Define("join", newBuiltin("join", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        sep, ok := args[0].(Str)
+        next, isIter := open(args[1])
+        if !ok || !isIter { return nil, fmt.Errorf("Unexpected argument: join(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        var b strings.Builder
+        first := true
+        err := each(ev2, next, func(v Value) (bool, error) {
+            if !first { b.WriteString(sep.V) }
+            first = false
+            b.WriteString(display(v))
+            return true, nil
+        })
+        if err != nil { return nil, err }
+        return Str{V: b.String()}, nil
+    }), false)
+    // upper(s), lower(s): s in upper or lower case; trim(s), trim_start(s),
+    // trim_end(s): s without the whitespace at both ends, its start or its end
+    for name, fn := range map[string]func(string) string{
+        "upper": strings.ToUpper, "lower": strings.ToLower,
+        "trim": strings.TrimSpace,
+        "trim_start": func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) },
+        "trim_end": func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) },
+    } {
+        env.Define(name, newBuiltin(name, 1, func(ev2 *Evaluator, args []Value) (Value, error) {
+            s, ok := args[0].(Str)
+            if !ok { return nil, fmt.Errorf("Unexpected argument: %s(%s)", name, typeName(args[0])) }
+            return Str{V: fn(s.V)}, nil
+        }), false)
+    }
+    // starts_with?(prefix, s), ends_with?(suffix, s): whether s begins or
+    // ends with the given string
+    for name, test := range map[string]func(s, affix string) bool{"starts_with?": strings.HasPrefix, "ends_with?": strings.HasSuffix} {
+        env.Define(name, newBuiltin(name, 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+            affix, ok1 := args[0].(Str)
+            s, ok2 := args[1].(Str)
+            if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: %s(%s, %s)", name, typeName(args[0]), typeName(args[1])) }
+            return boolValue(test(s.V, affix.V)), nil
+        }), false)
+    }
+    // index_of(x, xs): where x first occurs in xs, in characters for a
+    // string (x then being a substring) and items for a list; nil if it
+    // doesn't
+    env.Define("index_of", newBuiltin("index_of", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        switch coll := args[1].(type) {
+        case Str:
+            sub, ok := args[0].(Str)
+            if !ok { break }
+            i := strings.Index(coll.V, sub.V)
+            if i < 0 { return Nil{}, nil }
+            return intValue(int64(utf8.RuneCountInString(coll.V[:i]))), nil
+        case List:
+            for i, v := range coll.Items {
+                if equal(v, args[0]) { return intValue(int64(i)), nil }
+            }
+            return Nil{}, nil
+        }
+        return nil, fmt.Errorf("Unexpected argument: index_of(%s, %s)", typeName(args[0]), typeName(args[1]))
+    }), false)
+    // replace(old, new, s): s with every occurrence of old, a string or a
+    // regex, replaced by new; for a regex, $1 or ${name} in new is the text
+    // of that group
+    env.Define("replace", newBuiltin("replace", 3, func(ev2 *Evaluator, args []Value) (Value, error) {
+        repl, ok1 := args[1].(Str)
+        s, ok2 := args[2].(Str)
+        if ok1 && ok2 {
+            switch old := args[0].(type) {
+            case Str: return Str{V: strings.ReplaceAll(s.V, old.V, repl.V)}, nil
+            case Regex: return Str{V: old.re.ReplaceAllString(s.V, repl.V)}, nil
+            }
+        }
+        return nil, fmt.Errorf("Unexpected argument: replace(%s)", argTypes(args))
+    }), false)
+    // format(template, v...): template with each {} replaced by the next
+    // value in display form, {n} by the nth (from 0), and {{ and }} by
+    // literal braces; see formatSpec for what may follow a colon
+    env.Define("format", newVariadicBuiltin("format", 1, -1, func(ev2 *Evaluator, args []Value) (Value, error) {
+        tmpl, ok := args[0].(Str)
+        if !ok { return nil, fmt.Errorf("Unexpected argument: format(%s)", argTypes(args)) }
+        return formatString(tmpl.V, args[1:])
+    }), false)
+}
+
+// formatSpec is the part of a format placeholder after the colon:
+// [[fill]align][0][width][.precision], as in {:>5}, {:*^9}, {:03} or
+// {:.2}. Alignment is < (left), > (right) or ^ (centre), by default right
+// for numbers and left for everything else. A 0 pads numbers with zeros
+// after their sign. Precision fixes the decimal places of a number, or cuts
+// a string to that many characters.
+type formatSpec struct {
+    fill      rune
+    align     rune
+    zero      bool
+    width     int
+    precision int // -1 when absent
+}
+
+func parseFormatSpec(s string) (formatSpec, bool) {
+    spec := formatSpec{fill: ' ', precision: -1}
+    isAlign := func(r rune) bool { return r == '<' || r == '>' || r == '^' }
+    if r, n := utf8.DecodeRuneInString(s); n > 0 && n < len(s) {
+        if a, _ := utf8.DecodeRuneInString(s[n:]); isAlign(a) { spec.fill, spec.align, s = r, a, s[n+1:] }
+    }
+    if spec.align == 0 && s != "" && isAlign(rune(s[0])) { spec.align, s = rune(s[0]), s[1:] }
+    if strings.HasPrefix(s, "0") { spec.zero, s = true, s[1:] }
+    digits := func() (int, bool) {
+        i := 0
+        for i < len(s) && s[i] >= '0' && s[i] <= '9' { i++ }
+        if i == 0 { return 0, false }
+        n, err := strconv.Atoi(s[:i])
+        s = s[i:]
+        return n, err == nil
+    }
+    if n, ok := digits(); ok { spec.width = n }
+    if strings.HasPrefix(s, ".") {
+        s = s[1:]
+        n, ok := digits()
+        if !ok { return spec, false }
+        spec.precision = n
+    }
+    return spec, s == ""
+}
+
+func (spec formatSpec) apply(v Value) (string, error) {
+    var s string
+    num := false
+    switch x := v.(type) {
+    case Int:
+        num = true
+        s = x.repr()
+        if spec.precision >= 0 { s = strconv.FormatFloat(float64(x.V), 'f', spec.precision, 64) }
+    case Big:
+        num = true
+        s = x.repr()
+        if spec.precision >= 0 { s = strconv.FormatFloat(x.float(), 'f', spec.precision, 64) }
+    case Dec:
+        num = true
+        s = x.repr()
+        if spec.precision >= 0 { s = strconv.FormatFloat(x.V, 'f', spec.precision, 64) }
+    default:
+        s = display(v)
+        if spec.precision >= 0 && utf8.RuneCountInString(s) > spec.precision { s = string([]rune(s)[:spec.precision]) }
+    }
+    if spec.zero && !num { return "", fmt.Errorf("Unable to zero-pad a %s in format", typeName(v)) }
+    pad := spec.width - utf8.RuneCountInString(s)
+    if pad <= 0 { return s, nil }
+    if spec.zero && spec.align == 0 {
+        sign := ""
+        if strings.HasPrefix(s, "-") { sign, s = "-", s[1:] }
+        return sign + strings.Repeat("0", pad) + s, nil
+    }
+    fill := string(spec.fill)
+    if spec.zero { fill = "0" }
+    align := spec.align
+    if align == 0 { align = '<'; if num { align = '>' } }
+    switch align {
+    case '<': return s + strings.Repeat(fill, pad), nil
+    case '>': return strings.Repeat(fill, pad) + s, nil
+    }
+    return strings.Repeat(fill, pad/2) + s + strings.Repeat(fill, pad-pad/2), nil
+}
+
+func formatString(tmpl string, vals []Value) (Value, error) {
+    var b strings.Builder
+    next := 0
+    used := make([]bool, len(vals))
+    for i := 0; i < len(tmpl); i++ {
+        c := tmpl[i]
+        if c == '}' {
+            if !strings.HasPrefix(tmpl[i:], "}}") { return nil, fmt.Errorf("Unmatched } in format string %s", Format(Str{V: tmpl})) }
+            b.WriteByte('}')
+            i++
+            continue
+        }
+        if c != '{' { b.WriteByte(c); continue }
+        if strings.HasPrefix(tmpl[i:], "{{") { b.WriteByte('{'); i++; continue }
+        end := strings.IndexByte(tmpl[i:], '}')
+        if end < 0 { return nil, fmt.Errorf("Unclosed { in format string %s", Format(Str{V: tmpl})) }
+        field := tmpl[i+1 : i+end]
+        i += end
+        pos, specText, _ := strings.Cut(field, ":")
+        n := next
+        if pos == "" {
+            next++
+        } else if p, err := strconv.Atoi(pos); err == nil && p >= 0 {
+            n = p
+        } else {
+            return nil, fmt.Errorf("Invalid placeholder {%s} in format string", field)
+        }
+        if n >= len(vals) { return nil, fmt.Errorf("Too few values for format string %s: %d given", Format(Str{V: tmpl}), len(vals)) }
+        spec, ok := parseFormatSpec(specText)
+        if !ok { return nil, fmt.Errorf("Invalid placeholder {%s} in format string", field) }
+        s, err := spec.apply(vals[n])
+        if err != nil { return nil, err }
+        b.WriteString(s)
+        used[n] = true
+    }
+    for i, u := range used {
+        if !u { return nil, fmt.Errorf("Value %d passed to format is not used by %s", i, Format(Str{V: tmpl})) }
+    }
+    return Str{V: b.String()}, nil
+}
+
+func splitString(ev *Evaluator, args []Value) (Value, error) {
+    if s, ok := args[1].(Str); ok {
+        switch sep := args[0].(type) {
+        case Str: return strList(strings.Split(s.V, sep.V)), nil
+        case Regex: return strList(sep.re.Split(s.V, -1)), nil
+        }
+    }
+    return nil, fmt.Errorf("Unexpected argument: split(%s, %s)", typeName(args[0]), typeName(args[1]))
+}
+
+func strList(ss []string) List {
+    items := make([]Value, len(ss))
+    for i, s := range ss { items[i] = Str{V: s} }
+    return List{Items: items}
+}
+
+// charAt is character i of s, a rune rather than a byte as for every string
+// operation, counting from the end when i is negative; false when s has no
+// such character.
+func charAt(s string, i int) (string, bool) {
+    if i < 0 { i += utf8.RuneCountInString(s) }
+    if i < 0 { return "", false }
+    for off := range s {
+        if i == 0 {
+            _, n := utf8.DecodeRuneInString(s[off:])
+            return s[off : off+n], true
+        }
+        i--
+    }
+    return "", false
+}
+
+// concat joins a and b, one of which is a string, or fails when the other
+// side is not concatenable.
+func concat(a, b Value) (Value, error) {
+    if !concatenable(a) || !concatenable(b) { return nil, fmt.Errorf("Unsupported operation: %s + %s", typeName(a), typeName(b)) }
+    return Str{V: display(a) + display(b)}, nil
+}
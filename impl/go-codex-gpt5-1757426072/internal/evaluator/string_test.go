@@ -0,0 +1,148 @@
+package evaluator
+
+import "testing"
+
+func TestStringConcat(t *testing.T) {
+    tests := []testCase{
+        // scalars join in their display form, on either side
+        {`"n: " + 42`, `"n: 42"`, ""},
+        {`1.5 + "!"`, `"1.5!"`, ""},
+        {`"x: " + true`, `"x: true"`, ""},
+        {`nil + "?"`, `"nil?"`, ""},
+        {`"a" + "b" + 1`, `"ab1"`, ""},
+        // collections and functions need str, which keeps nested quotes
+        {`"l: " + [1]`, "", "Unsupported operation: String + List"},
+        {`#{1: 2} + "x"`, "", "Unsupported operation: Dictionary + String"},
+        {`"f: " + |x| x`, "", "Unsupported operation: String + Function"},
+        {`"l: " + str([1, "a"])`, `"l: [1, "a"]"`, ""},
+        {`str("a") + str(nil)`, `"anil"`, ""},
+        {`[{2}] |> str`, `"[{2}]"`, ""},
+    }
+    runCases(t, "", tests)
+}
+
+func TestSplit(t *testing.T) {
+    prelude := "let r = regex(\"[,;] *\");\n"
+    tests := []testCase{
+        {`split(",", "a,,b")`, `["a", "", "b"]`, ""},
+        {`split("", "ab")`, `["a", "b"]`, ""},
+        {`split(r, "1, 2;3")`, `["1", "2", "3"]`, ""},
+        // each form threads, and maps as a function value or a partial
+        {`"a-b" |> split("-")`, `["a", "b"]`, ""},
+        {`"a;b" |> split(r)`, `["a", "b"]`, ""},
+        {`["a,b", "c"] |> map(split(","))`, `[["a", "b"], ["c"]]`, ""},
+        {`["a,b", "c"] |> map(split(r))`, `[["a", "b"], ["c"]]`, ""},
+        {`let f = split(","); f("x,y")`, `["x", "y"]`, ""},
+        {`(split(r) >> map(size))("ab, c")`, `[2, 1]`, ""},
+        {`split(1, "a")`, "", "Unexpected argument: split(Integer, String)"},
+        {`split(",", [1])`, "", "Unexpected argument: split(String, List)"},
+        // words splits on runs of whitespace
+        {`words(" a  b\n\tc ")`, `["a", "b", "c"]`, ""},
+        {`words("")`, `[]`, ""},
+        {`["a b", "c"] |> map(words)`, `[["a", "b"], ["c"]]`, ""},
+        {`words(1)`, "", "Unexpected argument: words(Integer)"},
+        {`regex("(")`, "", "Invalid regex \"(\": missing closing ): `(`"},
+    }
+    runCases(t, prelude, tests)
+}
+
+func TestJoin(t *testing.T) {
+    tests := []testCase{
+        {`join(", ", ["a", "b", "c"])`, `"a, b, c"`, ""},
+        {`join("", ["a"])`, `"a"`, ""},
+        {`join("-", [])`, `""`, ""},
+        // items join in display form, from any iterable
+        {`join(" ", [1, 2.5, "x", nil, [true]])`, `"1 2.5 x nil [true]"`, ""},
+        {`join("", {3, 1, 2})`, `"123"`, ""},
+        {`1..=3 |> join("+")`, `"1+2+3"`, ""},
+        {`"a,b,c" |> split(",") |> join(";")`, `"a;b;c"`, ""},
+        {`["ab", "cd"] |> map(|s| split("", s)) |> map(join("|"))`, `["a|b", "c|d"]`, ""},
+        {`join(1, ["a"])`, "", "Unexpected argument: join(Integer, List)"},
+        {`join(",", 1)`, "", "Unexpected argument: join(String, Integer)"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestCaseAndTrim(t *testing.T) {
+    tests := []testCase{
+        {`upper("abc Déf")`, `"ABC DÉF"`, ""},
+        {`lower("ABC Déf")`, `"abc déf"`, ""},
+        {`trim("  a b \n\t")`, `"a b"`, ""},
+        {`trim_start("  a b  ")`, `"a b  "`, ""},
+        {`trim_end("  a b  ")`, `"  a b"`, ""},
+        {`trim("")`, `""`, ""},
+        {`" Hello " |> trim |> upper`, `"HELLO"`, ""},
+        {`["A", "b"] |> map(lower)`, `["a", "b"]`, ""},
+        {`upper(1)`, "", "Unexpected argument: upper(Integer)"},
+        {`trim_end(["a "])`, "", "Unexpected argument: trim_end(List)"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestSearchAndReplace(t *testing.T) {
+    tests := []testCase{
+        {`contains?("ell", "hello")`, "true", ""},
+        {`contains?("xyz", "hello")`, "false", ""},
+        {`contains?("", "")`, "true", ""},
+        // like every predicate, the threaded collection comes last
+        {`"hello" |> contains?("ell")`, "true", ""},
+        {`"hello" |> contains?("hello!")`, "false", ""},
+        {`{1, 2} |> contains?(1)`, "true", ""},
+        {`["abc", "bcd", "cd"] |> filter(contains?("bc"))`, `["abc", "bcd"]`, ""},
+        {`starts_with?("he", "hello")`, "true", ""},
+        {`ends_with?("lo", "hello")`, "true", ""},
+        {`"hello" |> ends_with?("he")`, "false", ""},
+        {`["ab", "ba"] |> filter(starts_with?("a"))`, `["ab"]`, ""},
+        // index_of counts characters, and also finds list items
+        {`index_of("l", "hello")`, "2", ""},
+        {`index_of("ö", "höhö")`, "1", ""},
+        {`"héllo" |> index_of("llo")`, "2", ""},
+        {`index_of("z", "hello")`, "nil", ""},
+        {`index_of([1], [0, [1], 2])`, "1", ""},
+        {`index_of(3, [1, 2])`, "nil", ""},
+        {`replace("l", "L", "hello")`, `"heLLo"`, ""},
+        {`"a-b-c" |> replace("-", "")`, `"abc"`, ""},
+        {`replace(regex("(\\w)(\\d)"), "$2$1", "a1 b2")`, `"1a 2b"`, ""},
+        {`contains?(1, "a")`, "", "Unexpected argument: contains?(Integer, String)"},
+        {`contains?("a", 1)`, "", "Unexpected argument: contains?(String, Integer)"},
+        {`starts_with?(1, "a")`, "", "Unexpected argument: starts_with?(Integer, String)"},
+        {`index_of(1, "a")`, "", "Unexpected argument: index_of(Integer, String)"},
+        {`replace("a", 1, "a")`, "", "Unexpected argument: replace(String, Integer, String)"},
+    }
+    runCases(t, "", tests)
+}
+
+func TestFormat(t *testing.T) {
+    tests := []testCase{
+        {`format("{} + {} = {}", 1, 2.5, "x")`, `"1 + 2.5 = x"`, ""},
+        {`format("{1}{0}{1}", "a", "b")`, `"bab"`, ""},
+        {`format("{{{}}}", [1, "a"])`, `"{[1, "a"]}"`, ""},
+        // numbers right-aligned and everything else left by default
+        {`format("[{:5}|{:5}]", 42, "ab")`, `"[   42|ab   ]"`, ""},
+        {`format("[{:<4}|{:>4}|{:^6}]", 1, "b", "mid")`, `"[1   |   b| mid  ]"`, ""},
+        {`format("{:*^7}", "x")`, `"***x***"`, ""},
+        {`format("{:03} {:05}", 7, -4)`, `"007 -0004"`, ""},
+        {`format("{:.2} {:.3} {:6.1}", 3.14159, 2, -0.25)`, `"3.14 2.000   -0.2"`, ""},
+        {`format("{:.3}", "abcdef")`, `"abc"`, ""},
+        {`format("{:2}", "long")`, `"long"`, ""},
+        {`format("{:05}", "a")`, "", "Unable to zero-pad a String in format"},
+        {`format("{} {}", 1)`, "", `Too few values for format string "{} {}": 1 given`},
+        {`format("{}", 1, 2)`, "", `Value 1 passed to format is not used by "{}"`},
+        {`format("{:x}", 1)`, "", "Invalid placeholder {:x} in format string"},
+        {`format("{", 1)`, "", `Unclosed { in format string "{"`},
+        {`format("}")`, "", `Unmatched } in format string "}"`},
+    }
+    runCases(t, "", tests)
+}
+
+func TestStringRunes(t *testing.T) {
+    tests := []testCase{
+        {`"héllo"[1]`, `"é"`, ""},
+        {`size("héllo")`, "5", ""},
+        {`["héllo"[-4], "héllo"[5], "héllo"[-6]]`, `["é", nil, nil]`, ""},
+        {`[first("ñu"), rest("ñu"), first(""), rest("")]`, `["ñ", "u", nil, ""]`, ""},
+        {`"a🎄b" |> map(|c| c) |> size`, "3", ""},
+        {`let s = "日本語"; [s[2], size(s), get(0, s)]`, `["語", 3, "日"]`, ""},
+    }
+    runCases(t, "", tests)
+}
@@ -0,0 +1,38 @@
+package evaluator
+
+import (
+    "io"
+    "testing"
+
+    "elf-lang/impl/internal/parser"
+)
+
+func TestThreading(t *testing.T) {
+    prelude := "let inc = |x| x + 1; let add3 = |a, b, c| a + b + c; let p = push(9);\n"
+    tests := []testCase{
+        // the threaded value is the last argument, for every kind of function
+        {"[1, 2] |> map(inc)", "[2, 3]", ""},
+        {"[1, 2] |> fold(0, +)", "3", ""},
+        {"1 |> add3(10, 100)", "111", ""},
+        {"[1] |> (push(2) >> push(3))", "[1, 2, 3]", ""},
+        {"[1] |> (push >> map(inc))(5)", "[2, 6]", ""},
+        // partial applications, of builtins and user functions alike
+        {"[1] |> p", "[1, 9]", ""},
+        {"[1] |> p()", "[1, 9]", ""},
+        {"[1] |> fold(0)(+)", "1", ""},
+        {"1 |> add3(1)", "|...| { [function] }", ""},
+        {"1 |> add3(1) |> |f| f(5)", "7", ""},
+        {"2 |> add3(1)(10)", "13", ""},
+        {"[2] |> fold(1)(+)", "3", ""},
+        {"[1, 2] |> fold(1, +) |> inc", "5", ""},
+    }
+    runCases(t, prelude, tests)
+}
+
+func TestThreadingArity(t *testing.T) {
+    prog, err := parser.Parse("[2] |> push(1, 2)")
+    if err != nil { t.Fatal(err) }
+    _, err = New(io.Discard).Eval(prog)
+    want := "Expected 2 arguments to push, found: 3, counting the threaded value"
+    if err == nil || err.Error() != want { t.Errorf("got %v, want %s", err, want) }
+}
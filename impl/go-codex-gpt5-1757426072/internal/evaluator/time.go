@@ -0,0 +1,119 @@
+package evaluator
+
+import (
+    "fmt"
+    "strings"
+    "time"
+)
+
+// Times are Integers: milliseconds since the Unix epoch, in UTC. They sort,
+// subtract and go into Sets and Dicts like any other Integer, and a
+// duration is the Integer difference between two of them.
+//
+// Layouts are strftime-style: %Y year, %m month, %d day, %H hour, %M
+// minute, %S second, %b abbreviated month name (Jan) and %% a percent
+// sign; anything else must appear as is. Numeric fields read one or more
+// digits, so both "1518-11-01" and "1518-11-1" match "%Y-%m-%d", and
+// format pads them to two digits (four for a year).
+
+// units are the durations time_diff and duration measure in.
+var units = map[string]int64{"ms": 1, "s": 1000, "m": 60 * 1000, "h": 60 * 60 * 1000, "d": 24 * 60 * 60 * 1000}
+
+func parseTime(layout, s string) (int64, error) {
+    fail := func(why string) (int64, error) { return 0, fmt.Errorf("Unable to parse %s as %s: %s", Format(Str{V: s}), Format(Str{V: layout}), why) }
+    f := map[byte]int{'m': 1, 'd': 1}
+    rest := s
+    for i := 0; i < len(layout); i++ {
+        if layout[i] != '%' || i+1 == len(layout) || layout[i+1] == '%' {
+            if layout[i] == '%' { i++ }
+            if !strings.HasPrefix(rest, layout[i:i+1]) { return fail(fmt.Sprintf("expected %q", layout[i:i+1])) }
+            rest = rest[1:]
+            continue
+        }
+        i++
+        c := layout[i]
+        switch c {
+        case 'Y', 'm', 'd', 'H', 'M', 'S':
+            n := 0
+            for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' && n < 9 { n++ }
+            if n == 0 { return fail(fmt.Sprintf("expected digits for %%%c", c)) }
+            v := 0
+            for _, d := range rest[:n] { v = v*10 + int(d-'0') }
+            f[c], rest = v, rest[n:]
+        case 'b':
+            if len(rest) < 3 { return fail("expected a month name") }
+            m := strings.Index("janfebmaraprmayjunjulaugsepoctnovdec", strings.ToLower(rest[:3]))
+            if m < 0 || m%3 != 0 { return fail("expected a month name") }
+            f['m'], rest = m/3+1, rest[3:]
+        default:
+            return 0, fmt.Errorf("Unknown directive %%%c in time layout %s", c, Format(Str{V: layout}))
+        }
+    }
+    if rest != "" { return fail(fmt.Sprintf("unexpected %s", Format(Str{V: rest}))) }
+    t := time.Date(f['Y'], time.Month(f['m']), f['d'], f['H'], f['M'], f['S'], 0, time.UTC)
+    // time.Date normalises 31 April to 1 May; a field out of range is an error
+    if t.Month() != time.Month(f['m']) || t.Day() != f['d'] || t.Hour() != f['H'] || t.Minute() != f['M'] || t.Second() != f['S'] { return fail("a field is out of range") }
+    return t.UnixMilli(), nil
+}
+
+func formatTime(layout string, ms int64) (string, error) {
+    t := time.UnixMilli(ms).UTC()
+    var b strings.Builder
+    for i := 0; i < len(layout); i++ {
+        if layout[i] != '%' || i+1 == len(layout) { b.WriteByte(layout[i]); continue }
+        i++
+        switch layout[i] {
+        case 'Y': fmt.Fprintf(&b, "%04d", t.Year())
+        case 'm': fmt.Fprintf(&b, "%02d", int(t.Month()))
+        case 'd': fmt.Fprintf(&b, "%02d", t.Day())
+        case 'H': fmt.Fprintf(&b, "%02d", t.Hour())
+        case 'M': fmt.Fprintf(&b, "%02d", t.Minute())
+        case 'S': fmt.Fprintf(&b, "%02d", t.Second())
+        case 'b': b.WriteString(t.Month().String()[:3])
+        case '%': b.WriteByte('%')
+        default: return "", fmt.Errorf("Unknown directive %%%c in time layout %s", layout[i], Format(Str{V: layout}))
+        }
+    }
+    return b.String(), nil
+}
+
+func (ev *Evaluator) defineTimeBuiltins(env *Env) {
+    // parse_time(layout, s): the time s writes in layout
+    env.Define("parse_time", newBuiltin("parse_time", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        layout, ok1 := args[0].(Str)
+        s, ok2 := args[1].(Str)
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: parse_time(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        ms, err := parseTime(layout.V, s.V)
+        if err != nil { return nil, err }
+        return intValue(ms), nil
+    }), false)
+    // format_time(layout, t): t written in layout
+    env.Define("format_time", newBuiltin("format_time", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        layout, ok1 := args[0].(Str)
+        t, ok2 := args[1].(Int)
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: format_time(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        s, err := formatTime(layout.V, t.V)
+        if err != nil { return nil, err }
+        return Str{V: s}, nil
+    }), false)
+    // time_diff(unit, from, to): whole units ("ms", "s", "m", "h" or "d")
+    // from one time to another, truncated toward zero
+    env.Define("time_diff", newBuiltin("time_diff", 3, func(ev2 *Evaluator, args []Value) (Value, error) {
+        unit, ok1 := args[0].(Str)
+        from, ok2 := args[1].(Int)
+        to, ok3 := args[2].(Int)
+        if !ok1 || !ok2 || !ok3 { return nil, fmt.Errorf("Unexpected argument: time_diff(%s, %s, %s)", typeName(args[0]), typeName(args[1]), typeName(args[2])) }
+        n, ok := units[unit.V]
+        if !ok { return nil, fmt.Errorf("Unknown time unit %s", Format(unit)) }
+        return intValue((to.V - from.V) / n), nil
+    }), false)
+    // duration(unit, n): n units in milliseconds, to add to a time
+    env.Define("duration", newBuiltin("duration", 2, func(ev2 *Evaluator, args []Value) (Value, error) {
+        unit, ok1 := args[0].(Str)
+        n, ok2 := args[1].(Int)
+        if !ok1 || !ok2 { return nil, fmt.Errorf("Unexpected argument: duration(%s, %s)", typeName(args[0]), typeName(args[1])) }
+        ms, ok := units[unit.V]
+        if !ok { return nil, fmt.Errorf("Unknown time unit %s", Format(unit)) }
+        return intValue(n.V * ms), nil
+    }), false)
+}
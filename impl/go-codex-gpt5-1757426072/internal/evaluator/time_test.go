@@ -0,0 +1,22 @@
+package evaluator
+
+import "testing"
+
+func TestTime(t *testing.T) {
+    prelude := `let log = parse_time("[%Y-%m-%d %H:%M]");` + "\n"
+    tests := []testCase{
+        {`parse_time("%Y-%m-%d", "1970-01-02")`, "86400000", ""},
+        {`log("[1518-11-01 00:05]") |> format_time("%d %b %Y, %H:%M:%S")`, `"01 Nov 1518, 00:05:00"`, ""},
+        {`parse_time("%d %b %Y %%", "3 mar 2020 %") |> format_time("%Y-%m-%d")`, `"2020-03-03"`, ""},
+        {`time_diff("m", log("[1518-11-01 23:58]"), log("[1518-11-02 00:40]"))`, "42", ""},
+        {`time_diff("h", 0, -duration("m", 90))`, "-1", ""},
+        {`parse_time("%H:%M", "10:00") + duration("s", 30) |> format_time("%H:%M:%S")`, `"10:00:30"`, ""},
+        {`["[1518-11-02 00:40]", "[1518-11-01 23:58]"] |> map(log) |> |ts| ts[0] > ts[1]`, "true", ""},
+        {`parse_time("%Y-%m-%d", "2021-04-31")`, "", `Unable to parse "2021-04-31" as "%Y-%m-%d": a field is out of range`},
+        {`parse_time("%Y-%m", "2021/04")`, "", `Unable to parse "2021/04" as "%Y-%m": expected "-"`},
+        {`parse_time("%Y", "2021 ")`, "", `Unable to parse "2021 " as "%Y": unexpected " "`},
+        {`format_time("%q", 0)`, "", `Unknown directive %q in time layout "%q"`},
+        {`duration("w", 1)`, "", `Unknown time unit "w"`},
+    }
+    runCases(t, prelude, tests)
+}
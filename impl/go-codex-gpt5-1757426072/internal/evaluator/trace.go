@@ -0,0 +1,11 @@
+package evaluator
+
+import "elf-lang/impl/internal/lexer"
+
+// Tracer is called as each statement starts evaluating, with the file it
+// belongs to (as given to SetFile, or the module path inside an import) and
+// the statement's position.
+type Tracer func(file string, pos lexer.Pos)
+
+// SetTracer installs a statement tracer; nil removes it.
+func (ev *Evaluator) SetTracer(t Tracer) { ev.tracer = t }
@@ -0,0 +1,26 @@
+package evaluator
+
+// Storing an Int in a Value allocates unless Go can avoid it (values below
+// 256), so results in a small range reuse preallocated values, as do the
+// booleans. (Nil is zero-sized and never allocates.)
+const smallIntMin, smallIntMax = -128, 1024
+
+var smallInts = func() (vs [smallIntMax - smallIntMin]Value) {
+    for i := range vs { vs[i] = Int{V: int64(i + smallIntMin)} }
+    return vs
+}()
+
+var (
+    trueValue  Value = Bool{V: true}
+    falseValue Value = Bool{V: false}
+)
+
+func intValue(v int64) Value {
+    if v >= smallIntMin && v < smallIntMax { return smallInts[v-smallIntMin] }
+    return Int{V: v}
+}
+
+func boolValue(b bool) Value {
+    if b { return trueValue }
+    return falseValue
+}
@@ -1,17 +1,50 @@
 package lexer
 
 import (
+    "fmt"
     "unicode"
+
+    "elf-lang/impl/internal/crash"
 )
 
+// Pos is a location in the source: a byte offset plus 1-based line and
+// column (columns count bytes).
+type Pos struct {
+    Offset int
+    Line   int
+    Col    int
+}
+
+func (p Pos) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Col) }
+
 type Token struct {
     Type string
     Lit  string
+    Pos  Pos
+}
+
+// escapes maps the character after a backslash in a string literal to the
+// character it stands for.
+var escapes = map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '0': 0, '"': '"', '\\': '\\'}
+
+// Unescape returns the character the escape sequence `\c` stands for, or
+// false when the language has no such escape.
+func Unescape(c byte) (byte, bool) {
+    r, ok := escapes[c]
+    return r, ok
+}
+
+// Tokenize is Lex reporting a panic in the lexer as a crash.InternalError.
+func Tokenize(src string) (toks []Token, err error) {
+    defer crash.Recover("lexing", &err)
+    return Lex(src), nil
 }
 
 // Lex converts source into a flat token stream matching Stage 1 expectations.
 func Lex(src string) []Token {
-    var out []Token
+    // typical programs average two to three bytes per token; literals are
+    // slices of src, so growing this slice is the lexer's main allocation
+    out := make([]Token, 0, len(src)/2+1)
     i := 0
     n := len(src)
 
@@ -24,7 +57,15 @@ func Lex(src string) []Token {
         return src[j]
     }
 
-    emit := func(typ, lit string) { out = append(out, Token{Type: typ, Lit: lit}) }
+    // positions are computed incrementally as tokens are emitted in order
+    line, lineStart, scanned := 1, 0, 0
+    posAt := func(off int) Pos {
+        for ; scanned < off; scanned++ {
+            if src[scanned] == '\n' { line++; lineStart = scanned + 1 }
+        }
+        return Pos{Offset: off, Line: line, Col: off - lineStart + 1}
+    }
+    emit := func(typ, lit string, start int) { out = append(out, Token{Type: typ, Lit: lit, Pos: posAt(start)}) }
 
     for i < n {
         ch := src[i]
@@ -37,7 +78,18 @@ func Lex(src string) []Token {
             start := i
             i += 2
             for i < n && src[i] != '\n' { i++ }
-            emit("CMT", src[start:i])
+            emit("CMT", src[start:i], start)
+            continue
+        }
+
+        // Block comment: /* ... */, over any number of lines; unterminated,
+        // it runs to the end of the source and the parser reports it
+        if ch == '/' && peek(1) == '*' {
+            start := i
+            i += 2
+            for i < n && !(src[i] == '*' && peek(1) == '/') { i++ }
+            i = min(i+2, n)
+            emit("CMT", src[start:i], start)
             continue
         }
 
@@ -47,18 +99,30 @@ func Lex(src string) []Token {
             i++
             for i < n {
                 c := src[i]
-                if c == '\\' { // escape, skip next if any
-                    i += 2
+                if c == '\\' { // escape, skip next if any; the parser rejects unknown ones
+                    i = min(i+2, n)
                     continue
                 }
                 if c == '"' { i++; break }
                 i++
             }
-            emit("STR", src[start:i])
+            emit("STR", src[start:i], start)
+            continue
+        }
+
+        // Raw strings: backquoted, over any number of lines, with no escapes,
+        // so a backslash is just a backslash: `\d+` or `C:\dir`
+        if ch == '`' {
+            start := i
+            i++
+            for i < n && src[i] != '`' { i++ }
+            i = min(i+1, n)
+            emit("STR", src[start:i], start)
             continue
         }
 
-        // Numbers: INT or DEC, numeric underscores preserved
+        // Numbers: INT or DEC, numeric underscores preserved, and a DEC may
+        // have an exponent: 1.5e9, 2E-3
         if isDigit(ch) {
             start := i
             // integer part (digits and underscores)
@@ -70,7 +134,17 @@ func Lex(src string) []Token {
                 for i < n && (isDigit(src[i]) || src[i] == '_') { i++ }
                 typ = "DEC"
             }
-            emit(typ, src[start:i])
+            // exponent: e or E, an optional sign, then digits; otherwise the
+            // e starts an identifier
+            if i < n && (src[i] == 'e' || src[i] == 'E') {
+                j := i + 1
+                if j < n && (src[j] == '+' || src[j] == '-') { j++ }
+                if j < n && isDigit(src[j]) {
+                    for i = j; i < n && isDigit(src[i]); i++ {}
+                    typ = "DEC"
+                }
+            }
+            emit(typ, src[start:i], start)
             continue
         }
 
@@ -79,17 +153,24 @@ func Lex(src string) []Token {
             start := i
             i++
             for i < n && isIdentPart(src[i]) { i++ }
+            // predicates may end in a question mark, e.g. contains?
+            if i < n && src[i] == '?' { i++ }
             word := src[start:i]
             switch word {
-            case "let": emit("LET", word)
-            case "mut": emit("MUT", word)
-            case "if": emit("IF", word)
-            case "else": emit("ELSE", word)
-            case "true": emit("TRUE", word)
-            case "false": emit("FALSE", word)
-            case "nil": emit("NIL", word)
+            case "let": emit("LET", word, start)
+            case "mut": emit("MUT", word, start)
+            case "if": emit("IF", word, start)
+            case "else": emit("ELSE", word, start)
+            case "match": emit("MATCH", word, start)
+            case "while": emit("WHILE", word, start)
+            case "loop": emit("LOOP", word, start)
+            case "break": emit("BREAK", word, start)
+            case "continue": emit("CONTINUE", word, start)
+            case "true": emit("TRUE", word, start)
+            case "false": emit("FALSE", word, start)
+            case "nil": emit("NIL", word, start)
             default:
-                emit("ID", word)
+                emit("ID", word, start)
             }
             continue
         }
@@ -97,24 +178,30 @@ func Lex(src string) []Token {
         // Multi-char operators/symbols (longest-match first per starter)
         // #{
         if ch == '#' && peek(1) == '{' {
-            emit("#{", "#{")
+            emit("#{", "#{", i)
             i += 2
             continue
         }
+        if ch == '.' && peek(1) == '.' && peek(2) == '=' {
+            emit("..=", "..=", i)
+            i += 3
+            continue
+        }
         // Two-char ops
         two := func(a, b byte, typ string) bool {
-            if ch == a && peek(1) == b { emit(typ, src[i:i+2]); i += 2; return true }
+            if ch == a && peek(1) == b { emit(typ, src[i:i+2], i); i += 2; return true }
             return false
         }
         if two('=', '=', "==") || two('!', '=', "!=") || two('>', '=', ">=") || two('<', '=', "<=") ||
-            two('&', '&', "&&") || two('|', '|', "||") || two('|', '>', "|>") || two('>', '>', ">>") {
+            two('&', '&', "&&") || two('|', '|', "||") || two('|', '>', "|>") || two('>', '>', ">>") ||
+            two('-', '>', "->") || two('.', '.', "..") {
             continue
         }
 
-        // Single-char tokens
+        // Single-char tokens, sliced from src: string(ch) would allocate
         switch ch {
-        case '+', '-', '*', '/', '=', '{', '}', '[', ']', '>', '<', ';', '(', ')', ',', ':', '|':
-            emit(string(ch), string(ch))
+        case '+', '-', '*', '/', '%', '=', '{', '}', '[', ']', '>', '<', ';', '(', ')', ',', ':', '|':
+            emit(src[i:i+1], src[i:i+1], i)
             i++
             continue
         }
@@ -0,0 +1,91 @@
+package lexer
+
+import (
+    "strings"
+    "testing"
+)
+
+// benchSource is a representative program: bindings, lambdas, collection
+// literals, strings with escapes, comments and threading.
+const benchSource = `// parse the grid and walk it
+let grid = lines(input) |> map(|line| split("", line));
+let mut seen = #{};
+let neighbours = |x, y| [[x + 1, y], [x - 1, y], [x, y + 1], [x, y - 1]];
+let step = |acc, pos| if acc[pos] == nil { assoc(pos, 1_000, acc) } else { acc };
+let total = fold(0, |sum, n| sum + n * 2.5, [1, 2, 3, 4, 5]);
+puts("total:\t", total, {1, 2, 3}, "quoted \"value\"");
+`
+
+func benchLex(b *testing.B, src string) {
+    b.SetBytes(int64(len(src)))
+    b.ReportAllocs()
+    for b.Loop() { Lex(src) }
+}
+
+func BenchmarkLexSmall(b *testing.B) { benchLex(b, benchSource) }
+func BenchmarkLexLarge(b *testing.B) { benchLex(b, strings.Repeat(benchSource, 500)) }
+
+func TestPositions(t *testing.T) {
+    toks := Lex("let x = \"a\nb\";\n  x // done")
+    want := []Pos{{0, 1, 1}, {4, 1, 5}, {6, 1, 7}, {8, 1, 9}, {13, 2, 3}, {17, 3, 3}, {19, 3, 5}}
+    if len(toks) != len(want) { t.Fatalf("got %d tokens, want %d", len(toks), len(want)) }
+    for i, tok := range toks {
+        if tok.Pos != want[i] { t.Errorf("%s: got %s (offset %d), want %s (offset %d)", tok.Lit, tok.Pos, tok.Pos.Offset, want[i], want[i].Offset) }
+    }
+}
+
+func TestBlockComments(t *testing.T) {
+    tests := []struct{ src string; want []string }{
+        {"/* a */ 1", []string{"CMT /* a */", "INT 1"}},
+        {"1 /* a\n * b\n */\n2", []string{"INT 1", "CMT /* a\n * b\n */", "INT 2"}},
+        {"/**/ /* // */ 3", []string{"CMT /**/", "CMT /* // */", "INT 3"}},
+        {"1 / 2 /* open", []string{"INT 1", "/ /", "INT 2", "CMT /* open"}},
+        {"/*/", []string{"CMT /*/"}},
+    }
+    for _, tt := range tests {
+        var got []string
+        for _, tok := range Lex(tt.src) { got = append(got, tok.Type+" "+tok.Lit) }
+        if strings.Join(got, "|") != strings.Join(tt.want, "|") { t.Errorf("%q: got %q, want %q", tt.src, got, tt.want) }
+    }
+    toks := Lex("/* a\nb */ x")
+    if p := toks[1].Pos; p.Line != 2 || p.Col != 6 { t.Errorf("got x at %s, want 2:6", p) }
+}
+
+func TestExponents(t *testing.T) {
+    tests := []struct{ src string; want []string }{
+        {"1.5e9", []string{"DEC 1.5e9"}},
+        {"1e3 2E-3 4e+2", []string{"DEC 1e3", "DEC 2E-3", "DEC 4e+2"}},
+        {"1_000.5e2", []string{"DEC 1_000.5e2"}},
+        // no digits after it, so the e is an identifier
+        {"3e", []string{"INT 3", "ID e"}},
+        {"2e-x", []string{"INT 2", "ID e", "- -", "ID x"}},
+    }
+    for _, tt := range tests {
+        var got []string
+        for _, tok := range Lex(tt.src) { got = append(got, tok.Type+" "+tok.Lit) }
+        if strings.Join(got, "|") != strings.Join(tt.want, "|") { t.Errorf("%q: got %q, want %q", tt.src, got, tt.want) }
+    }
+}
+
+func TestRawStrings(t *testing.T) {
+    toks := Lex("`a\\n\"b\nc` x `open")
+    want := []string{"STR `a\\n\"b\nc`", "ID x", "STR `open"}
+    var got []string
+    for _, tok := range toks { got = append(got, tok.Type+" "+tok.Lit) }
+    if strings.Join(got, "|") != strings.Join(want, "|") { t.Errorf("got %q, want %q", got, want) }
+    if p := toks[1].Pos; p.Line != 2 || p.Col != 4 { t.Errorf("got x at %s, want 2:4", p) }
+}
+
+func TestRanges(t *testing.T) {
+    tests := []struct{ src string; want []string }{
+        {"1..10", []string{"INT 1", ".. ..", "INT 10"}},
+        {"1..=10", []string{"INT 1", "..= ..=", "INT 10"}},
+        {"1.5..2", []string{"DEC 1.5", ".. ..", "INT 2"}},
+        {"[..xs]", []string{"[ [", ".. ..", "ID xs", "] ]"}},
+    }
+    for _, tt := range tests {
+        var got []string
+        for _, tok := range Lex(tt.src) { got = append(got, tok.Type+" "+tok.Lit) }
+        if strings.Join(got, "|") != strings.Join(tt.want, "|") { t.Errorf("%q: got %q, want %q", tt.src, got, tt.want) }
+    }
+}
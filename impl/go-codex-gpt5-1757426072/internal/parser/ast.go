@@ -1,6 +1,9 @@
 package parser
 
-// Ordered JSON fields are ensured by struct field order.
+import "elf-lang/impl/internal/lexer"
+
+// Ordered JSON fields are ensured by struct field order. Every node records
+// where it starts in the source as Pos, left out of the JSON; see PosOf.
 
 // Program is the root AST node.
 type Program struct {
@@ -12,53 +15,100 @@ type Program struct {
 type Statement interface{ isStatement() }
 
 type ExpressionStmt struct {
-    Type  string `json:"type"`
-    Value Expr   `json:"value"`
+    Type  string    `json:"type"`
+    Value Expr      `json:"value"`
+    Pos   lexer.Pos `json:"-"`
 }
 func (ExpressionStmt) isStatement() {}
 
 type CommentStmt struct {
-    Type  string `json:"type"`
-    Value string `json:"value"`
+    Type     string    `json:"type"`
+    Value    string    `json:"value"`
+    Pos      lexer.Pos `json:"-"`
+    Trailing bool      `json:"-"` // follows code on the same line
 }
 func (CommentStmt) isStatement() {}
 
+// Section is a named solution block, e.g. `input: ...` or `part_one: { ... }`
+type Section struct {
+    Body Block     `json:"body"`
+    Name string    `json:"name"`
+    Type string    `json:"type"`
+    Pos  lexer.Pos `json:"-"`
+}
+func (Section) isStatement() {}
+
 // Expr is a marker interface for expressions.
 type Expr interface{ isExpr() }
 
 // Identifiers and literals
 type Identifier struct {
-    Name string `json:"name"`
-    Type string `json:"type"`
+    Binding *Binding  `json:"binding,omitempty"` // only set by the resolver (`ast --resolved`)
+    Name    string    `json:"name"`
+    Type    string    `json:"type"`
+    Pos     lexer.Pos `json:"-"`
+    Ref     Ref       `json:"-"` // set by the evaluator's resolver
 }
 func (Identifier) isExpr() {}
 
+// Ref is the resolved address of a variable: the binding lives Depth scopes
+// out from the one the identifier is evaluated in, at index Slot.
+type Ref struct {
+    Depth    int
+    Slot     int
+    Resolved bool // false means the name is looked up at runtime
+    Builtin  bool // the binding is in the outermost scope, the builtins
+}
+
+// Binding describes what an Identifier resolves to: its kind (builtin,
+// module, local or parameter) and, for user bindings, where it is declared.
+type Binding struct {
+    Declaration *Span  `json:"declaration,omitempty"`
+    Kind        string `json:"kind"`
+}
+
+// Span is a source range; End is exclusive.
+type Span struct {
+    End   Position `json:"end"`
+    Start Position `json:"start"`
+}
+
+type Position struct {
+    Column int `json:"column"`
+    Line   int `json:"line"`
+}
+
 type IntegerLit struct {
-    Type  string `json:"type"`
-    Value string `json:"value"`
+    Type  string    `json:"type"`
+    Value string    `json:"value"`
+    Pos   lexer.Pos `json:"-"`
 }
 func (IntegerLit) isExpr() {}
 
 type DecimalLit struct {
-    Type  string `json:"type"`
-    Value string `json:"value"`
+    Type  string    `json:"type"`
+    Value string    `json:"value"`
+    Pos   lexer.Pos `json:"-"`
 }
 func (DecimalLit) isExpr() {}
 
 type StringLit struct {
-    Type  string `json:"type"`
-    Value string `json:"value"`
+    Type  string    `json:"type"`
+    Value string    `json:"value"`
+    Pos   lexer.Pos `json:"-"`
 }
 func (StringLit) isExpr() {}
 
 type BooleanLit struct {
-    Type  string `json:"type"`
-    Value bool   `json:"value"`
+    Type  string    `json:"type"`
+    Value bool      `json:"value"`
+    Pos   lexer.Pos `json:"-"`
 }
 func (BooleanLit) isExpr() {}
 
 type NilLit struct {
-    Type string `json:"type"`
+    Type string    `json:"type"`
+    Pos  lexer.Pos `json:"-"`
 }
 func (NilLit) isExpr() {}
 
@@ -67,15 +117,20 @@ type LetExpr struct {
     Name  Identifier `json:"name"`
     Type  string     `json:"type"`
     Value Expr       `json:"value"`
+    Pos   lexer.Pos  `json:"-"`
 }
 func (LetExpr) isExpr() {}
 
-// Infix expression
+// Infix expression. Nesting follows the operator precedence, loosest
+// first: `||`, `&&`, comparisons, `|>`, `>>`, `.. ..=`, `+ -`, `* / %`;
+// so in the AST output the loosest operator of an expression is its
+// outermost node.
 type InfixExpr struct {
-    Left     Expr   `json:"left"`
-    Operator string `json:"operator"`
-    Right    Expr   `json:"right"`
-    Type     string `json:"type"`
+    Left     Expr      `json:"left"`
+    Operator string    `json:"operator"`
+    Right    Expr      `json:"right"`
+    Type     string    `json:"type"`
+    Pos      lexer.Pos `json:"-"` // the operator
 }
 func (InfixExpr) isExpr() {}
 
@@ -84,27 +139,40 @@ type AssignExpr struct {
     Name  Identifier `json:"name"`
     Type  string     `json:"type"`
     Value Expr       `json:"value"`
+    Pos   lexer.Pos  `json:"-"`
 }
 func (AssignExpr) isExpr() {}
 
 // Prefix expression (currently only unary minus)
 type PrefixExpr struct {
-    Operator string `json:"operator"`
-    Operand  Expr   `json:"operand"`
-    Type     string `json:"type"`
+    Operator string    `json:"operator"`
+    Operand  Expr      `json:"operand"`
+    Type     string    `json:"type"`
+    Pos      lexer.Pos `json:"-"`
 }
 func (PrefixExpr) isExpr() {}
 
 // Collections
 type ListLit struct {
-    Items []Expr `json:"items"`
-    Type  string `json:"type"`
+    Items []Expr    `json:"items"`
+    Type  string    `json:"type"`
+    Pos   lexer.Pos `json:"-"`
 }
 func (ListLit) isExpr() {}
 
+// Spread is `..value` in a list literal or call arguments, standing for
+// the items of value in its place.
+type Spread struct {
+    Type  string    `json:"type"`
+    Value Expr      `json:"value"`
+    Pos   lexer.Pos `json:"-"`
+}
+func (Spread) isExpr() {}
+
 type SetLit struct {
-    Items []Expr `json:"items"`
-    Type  string `json:"type"`
+    Items []Expr    `json:"items"`
+    Type  string    `json:"type"`
+    Pos   lexer.Pos `json:"-"`
 }
 func (SetLit) isExpr() {}
 
@@ -116,30 +184,85 @@ type DictEntry struct {
 type DictLit struct {
     Items []DictEntry `json:"items"`
     Type  string      `json:"type"`
+    Pos   lexer.Pos   `json:"-"`
 }
 func (DictLit) isExpr() {}
 
 // Indexing
 type IndexExpr struct {
-    Index Expr  `json:"index"`
-    Left  Expr  `json:"left"`
-    Type  string `json:"type"`
+    Index Expr      `json:"index"`
+    Left  Expr      `json:"left"`
+    Type  string    `json:"type"`
+    Pos   lexer.Pos `json:"-"` // the opening bracket
 }
 func (IndexExpr) isExpr() {}
 
-// If expression
+// If expression. Alternative is nil without an else, and `else if` gives
+// an alternative holding just the nested if.
 type IfExpr struct {
-    Alternative Block `json:"alternative"`
-    Condition   Expr  `json:"condition"`
-    Consequence Block `json:"consequence"`
-    Type        string `json:"type"`
+    Alternative *Block    `json:"alternative,omitempty"`
+    Condition   Expr      `json:"condition"`
+    Consequence Block     `json:"consequence"`
+    Type        string    `json:"type"`
+    Pos         lexer.Pos `json:"-"`
 }
 func (IfExpr) isExpr() {}
 
+// Loop expression: `while condition { ... }` runs its body for as long as
+// the condition is truthy, and `loop { ... }` (no Condition) until a break.
+// It evaluates to the value of the break that ends it, otherwise nil.
+type LoopExpr struct {
+    Body      Block     `json:"body"`
+    Condition Expr      `json:"condition,omitempty"`
+    Type      string    `json:"type"`
+    Pos       lexer.Pos `json:"-"`
+}
+func (LoopExpr) isExpr() {}
+
+// Break ends the innermost loop, giving it Value (nil when absent).
+type BreakExpr struct {
+    Type  string    `json:"type"`
+    Value Expr      `json:"value,omitempty"`
+    Pos   lexer.Pos `json:"-"`
+}
+func (BreakExpr) isExpr() {}
+
+// Continue skips to the innermost loop's next iteration.
+type ContinueExpr struct {
+    Type string    `json:"type"`
+    Pos  lexer.Pos `json:"-"`
+}
+func (ContinueExpr) isExpr() {}
+
+// Match expression: the body of the first case whose pattern matches the
+// subject, run in a scope binding the names the pattern binds
+type MatchExpr struct {
+    Cases   []MatchCase `json:"cases"`
+    Subject Expr        `json:"subject"`
+    Type    string      `json:"type"`
+    Pos     lexer.Pos   `json:"-"`
+}
+func (MatchExpr) isExpr() {}
+
+type MatchCase struct {
+    Body    Block    `json:"body"`
+    Pattern Expr     `json:"pattern"`
+    Names   []string `json:"-"` // slot layout of the names the pattern binds, set by the evaluator's resolver
+}
+
+// Wildcard is the `_` pattern, matching anything and binding nothing.
+type Wildcard struct {
+    Type string    `json:"type"`
+    Pos  lexer.Pos `json:"-"`
+}
+func (Wildcard) isExpr() {}
+
 // Block
 type Block struct {
     Statements []Statement `json:"statements"`
     Type       string      `json:"type"`
+    Names      []string    `json:"-"` // slot layout of the block's scope, set by the evaluator's resolver; nil when it runs in the enclosing scope
+    Pos        lexer.Pos   `json:"-"` // the opening brace, or the start of an expression body
 }
 
 // Function literal and call
@@ -147,26 +270,65 @@ type FunctionLit struct {
     Body       Block        `json:"body"`
     Parameters []Identifier `json:"parameters"`
     Type       string       `json:"type"`
+    Pos        lexer.Pos    `json:"-"`
 }
 func (FunctionLit) isExpr() {}
 
 type CallExpr struct {
-    Arguments []Expr `json:"arguments"`
-    Function  Expr   `json:"function"`
-    Type      string `json:"type"`
+    Arguments []Expr    `json:"arguments"`
+    Function  Expr      `json:"function"`
+    Type      string    `json:"type"`
+    Pos       lexer.Pos `json:"-"` // where the callee starts
+    CalleeEnd lexer.Pos `json:"-"` // just past the callee
+    Source    string    `json:"-"` // the call as written, for error reports
 }
 func (CallExpr) isExpr() {}
 
 // Composition and Threading
 type FunctionComposition struct {
-    Functions []Expr `json:"functions"`
-    Type      string `json:"type"`
+    Functions []Expr    `json:"functions"`
+    Type      string    `json:"type"`
+    Pos       lexer.Pos `json:"-"`
 }
 func (FunctionComposition) isExpr() {}
 
 type FunctionThread struct {
-    Functions []Expr `json:"functions"`
-    Initial   Expr   `json:"initial"`
-    Type      string `json:"type"`
+    Functions []Expr    `json:"functions"`
+    Initial   Expr      `json:"initial"`
+    Type      string    `json:"type"`
+    Pos       lexer.Pos `json:"-"`
 }
 func (FunctionThread) isExpr() {}
+
+// PosOf returns where e starts (for an infix operator or indexing, where
+// the operator or bracket is), or the zero Pos for a node built by hand.
+func PosOf(e Expr) lexer.Pos {
+    switch x := e.(type) {
+    case Identifier: return x.Pos
+    case IntegerLit: return x.Pos
+    case DecimalLit: return x.Pos
+    case StringLit: return x.Pos
+    case BooleanLit: return x.Pos
+    case NilLit: return x.Pos
+    case LetExpr: return x.Pos
+    case InfixExpr: return x.Pos
+    case AssignExpr: return x.Pos
+    case PrefixExpr: return x.Pos
+    case ListLit: return x.Pos
+    case SetLit: return x.Pos
+    case DictLit: return x.Pos
+    case IndexExpr: return x.Pos
+    case MatchExpr: return x.Pos
+    case Wildcard: return x.Pos
+    case Spread: return x.Pos
+    case LoopExpr: return x.Pos
+    case BreakExpr: return x.Pos
+    case ContinueExpr: return x.Pos
+    case IfExpr: return x.Pos
+    case FunctionLit: return x.Pos
+    case CallExpr: return x.Pos
+    case FunctionComposition: return x.Pos
+    case FunctionThread: return x.Pos
+    }
+    return lexer.Pos{}
+}
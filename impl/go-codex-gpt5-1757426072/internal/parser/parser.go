@@ -2,14 +2,72 @@ package parser
 
 import (
     "fmt"
+    "strconv"
     "strings"
 
+    "elf-lang/impl/internal/crash"
     "elf-lang/impl/internal/lexer"
 )
 
+// Error is a syntax error in the program being parsed.
+type Error struct {
+    Msg      string
+    Pos      lexer.Pos // zero at the end of the input
+    End      lexer.Pos // just past the offending token, when it is worth showing
+    Expected string    // the token type wanted, when a specific one was
+    Found    string    // the token type found instead
+}
+
+func (e Error) Error() string {
+    if e.Pos.Line == 0 { return "Parse error: " + e.Msg }
+    if e.End.Line > 0 { return fmt.Sprintf("Parse error at %s-%s: %s", e.Pos, e.End, e.Msg) }
+    return fmt.Sprintf("Parse error at %s: %s", e.Pos, e.Msg)
+}
+
+// Errors are the syntax errors found in a program, in source order. The
+// parser recovers from each at the next statement, so one mistake does not
+// hide the ones after it.
+type Errors []Error
+
+// Error describes the first error, counting any others.
+func (es Errors) Error() string {
+    switch len(es) {
+    case 1: return es[0].Error()
+    case 2: return es[0].Error() + " (and 1 more error)"
+    }
+    return fmt.Sprintf("%s (and %d more errors)", es[0].Error(), len(es)-1)
+}
+
+// Parse lexes and parses source, returning syntax errors as Errors and any
+// panic inside the lexer or parser as a crash.InternalError.
+func Parse(src string) (Program, error) {
+    toks, err := lexer.Tokenize(src)
+    if err != nil { return Program{}, err }
+    return New(toks).Parse()
+}
+
+// Parse is ParseProgram returning the syntax errors found as Errors. The
+// program holds every statement that parsed.
+func (p *Parser) Parse() (prog Program, err error) {
+    defer crash.Recover("parsing", &err)
+    prog = p.ParseProgram()
+    if len(p.errs) > 0 { return prog, p.errs }
+    return prog, nil
+}
+
 type Parser struct {
     toks []lexer.Token
     i    int
+    open []opener // delimiters not yet closed, innermost last
+    errs Errors   // syntax errors recovered from so far
+    loops int     // loops around the current position, within its function
+}
+
+// opener is an opening delimiter, remembered so that input ending before it
+// is closed can say where it was opened.
+type opener struct {
+    what string
+    pos  lexer.Pos
 }
 
 func New(toks []lexer.Token) *Parser { return &Parser{toks: toks} }
@@ -21,12 +79,81 @@ func (p *Parser) cur() lexer.Token {
     return p.toks[p.i]
 }
 
+func (p *Parser) peek(off int) lexer.Token {
+    if p.i+off >= len(p.toks) {
+        return lexer.Token{Type: "EOF"}
+    }
+    return p.toks[p.i+off]
+}
+
 func (p *Parser) next() lexer.Token {
     t := p.cur()
     if p.i < len(p.toks) { p.i++ }
     return t
 }
 
+// parseComment consumes a comment token, noting whether it trails code on
+// the same line.
+func (p *Parser) parseComment() CommentStmt {
+    trailing := p.i > 0 && p.toks[p.i-1].Pos.Line == p.cur().Pos.Line
+    c := p.next()
+    if strings.HasPrefix(c.Lit, "/*") && (len(c.Lit) < 4 || !strings.HasSuffix(c.Lit, "*/")) {
+        panic(Error{Msg: fmt.Sprintf("Block comment opened at line %d is never closed", c.Pos.Line), Pos: c.Pos})
+    }
+    return CommentStmt{Type: "Comment", Value: c.Lit, Pos: c.Pos, Trailing: trailing}
+}
+
+// end is the position just past token i.
+func (p *Parser) end(i int) lexer.Pos {
+    t := p.toks[i]
+    return lexer.Pos{Offset: t.Pos.Offset + len(t.Lit), Line: t.Pos.Line, Col: t.Pos.Col + len(t.Lit)}
+}
+
+// text renders tokens [from, to) as written, with comments dropped and any
+// whitespace between tokens collapsed to a single space (none inside
+// brackets or before a comma).
+func (p *Parser) text(from, to int) string {
+    var b strings.Builder
+    var prev lexer.Token
+    for _, t := range p.toks[from:to] {
+        if t.Type == "CMT" { continue }
+        spaced := prev.Type != "" && t.Pos.Offset > prev.Pos.Offset+len(prev.Lit)
+        if spaced && !strings.Contains("([{", prev.Type) && !strings.Contains(")]},", t.Type) { b.WriteByte(' ') }
+        b.WriteString(t.Lit)
+        prev = t
+    }
+    return b.String()
+}
+
+// opened records an opening delimiter until the matching closed call.
+func (p *Parser) opened(what string, t lexer.Token) { p.open = append(p.open, opener{what, t.Pos}) }
+
+func (p *Parser) closed() { p.open = p.open[:len(p.open)-1] }
+
+// atEOF is the error for input ending early: the innermost delimiter left
+// open, if any, is what needs closing.
+func (p *Parser) atEOF() Error {
+    n := len(p.open)
+    if n == 0 { return Error{Msg: "unexpected end of input"} }
+    o := p.open[n-1]
+    return Error{Msg: fmt.Sprintf("%s opened at line %d is never closed", o.what, o.pos.Line), Pos: o.pos}
+}
+
+// keywords are the token types of reserved words, which can not name a
+// variable or parameter.
+var keywords = map[string]bool{
+    "LET": true, "MUT": true, "IF": true, "ELSE": true, "MATCH": true, "TRUE": true, "FALSE": true, "NIL": true,
+    "WHILE": true, "LOOP": true, "BREAK": true, "CONTINUE": true,
+}
+
+// expectName reads the name a let or parameter binds.
+func (p *Parser) expectName() lexer.Token {
+    if t := p.cur(); keywords[t.Type] { panic(reserved(t)) }
+    return p.expect("ID")
+}
+
+func reserved(t lexer.Token) Error { return Error{Msg: fmt.Sprintf("'%s' is a reserved keyword", t.Lit), Pos: t.Pos} }
+
 func (p *Parser) match(typ string) bool {
     if p.cur().Type == typ { p.i++; return true }
     return false
@@ -34,61 +161,121 @@ func (p *Parser) match(typ string) bool {
 
 func (p *Parser) expect(typ string) lexer.Token {
     t := p.cur()
+    if t.Type == "EOF" && typ != "EOF" { panic(p.atEOF()) }
     if t.Type != typ {
-        panic(fmt.Sprintf("expected %s, found %s", typ, t.Type))
+        panic(Error{Msg: fmt.Sprintf("expected %s, found %s", typ, t.Type), Pos: t.Pos, Expected: typ, Found: t.Type})
     }
     p.i++
     return t
 }
 
-// Precedence values (higher binds tighter)
+// Precedence levels, loosest first; calls and indexing bind tighter than
+// any of them, and unary minus tighter than any binary operator.
 const (
     precLowest = iota
-    precOr
-    precAnd
-    precCompare
+    precOr       // ||
+    precAnd      // &&
+    precCompare  // == != > < >= <=
     precThread   // |>
-    precCompose  // >> (higher than thread, right-assoc)
-    precAdd
-    precMul
+    precCompose  // >>
+    precRange    // .. ..=
+    precAdd      // + -
+    precMul      // * / %
     precCallIndex // calls and indexing
 )
 
-func precedence(op string) int {
-    switch op {
-    case "||": return precOr
-    case "&&": return precAnd
-    case "==", "!=", ">", "<", ">=", "<=": return precCompare
-    case "|>": return precThread
-    case ">>": return precCompose
-    case "+", "-": return precAdd
-    case "*", "/": return precMul
-    default:
-        return precLowest
-    }
+// binaryOp is an infix operator's precedence and associativity.
+type binaryOp struct {
+    prec  int
+    right bool // right-associative
 }
 
+// binaryOps is the infix operator table, as given by the language spec.
+// Every operator is left-associative except `>>`.
+var binaryOps = map[string]binaryOp{
+    "||": {prec: precOr},
+    "&&": {prec: precAnd},
+    "==": {prec: precCompare}, "!=": {prec: precCompare},
+    ">": {prec: precCompare}, "<": {prec: precCompare}, ">=": {prec: precCompare}, "<=": {prec: precCompare},
+    "|>": {prec: precThread},
+    ">>": {prec: precCompose, right: true},
+    "..": {prec: precRange}, "..=": {prec: precRange},
+    "+": {prec: precAdd}, "-": {prec: precAdd},
+    "*": {prec: precMul}, "/": {prec: precMul}, "%": {prec: precMul},
+}
+
+// ParseProgram parses every top-level statement. A statement with a syntax
+// error is left out and recorded (see Errors), parsing resuming at the next
+// statement; the same goes for the statements of a block.
 func (p *Parser) ParseProgram() Program {
     var stmts []Statement
     for p.cur().Type != "EOF" {
-        // Comments become Comment statements
-        if p.cur().Type == "CMT" {
-            c := p.next()
-            stmts = append(stmts, CommentStmt{Type: "Comment", Value: c.Lit})
-            // Optional semicolon after comment
-            if p.match(";") { /* skip */ }
-            continue
-        }
-
-        expr := p.parseExpression(precLowest)
-        stmts = append(stmts, ExpressionStmt{Type: "Expression", Value: expr})
+        if st, ok := p.recovering(false); ok { stmts = append(stmts, st) }
         // Optional semicolon between statements
         if p.match(";") { /* ok */ }
     }
     return Program{Statements: stmts, Type: "Program"}
 }
 
+// parseStatement parses a comment, section or expression.
+func (p *Parser) parseStatement() Statement {
+    if p.cur().Type == "CMT" { return p.parseComment() }
+    if p.atSection() { return p.parseSection() }
+    return p.parseExpressionStmt()
+}
+
+// recovering parses a statement, or records the syntax error it fails with
+// and skips to the next statement. A statement in a block that fails at the
+// end of the input leaves the block unfinished, so the error is passed on to
+// the enclosing statement instead.
+func (p *Parser) recovering(inBlock bool) (st Statement, ok bool) {
+    from, open := p.i, len(p.open)
+    defer func() {
+        if r := recover(); r != nil {
+            pe, isErr := r.(Error)
+            if !isErr || inBlock && p.cur().Type == "EOF" { panic(r) }
+            p.errs = append(p.errs, pe)
+            p.open = p.open[:open]
+            p.synchronize(from, inBlock)
+        }
+    }()
+    return p.parseStatement(), true
+}
+
+// synchronize skips the rest of a statement that failed to parse, the one
+// starting at token from: up to and including a `;`, or up to the first
+// token on a new line (or, in a block, its closing brace), outside any
+// brackets opened after the failure.
+func (p *Parser) synchronize(from int, inBlock bool) {
+    depth := 0
+    for ; p.i < len(p.toks); p.i++ {
+        t := p.toks[p.i]
+        if depth == 0 && p.i > from {
+            if t.Type == ";" { p.i++; return }
+            if t.Pos.Line > p.toks[p.i-1].Pos.Line || inBlock && t.Type == "}" { return }
+        }
+        depth = max(0, depth+nesting(t.Type))
+    }
+}
+
+// nesting is how a token changes the bracket depth.
+func nesting(typ string) int {
+    switch typ {
+    case "(", "[", "{", "#{": return 1
+    case ")", "]", "}": return -1
+    }
+    return 0
+}
+
+// parseExpressionStmt parses an expression in statement position, recording
+// where it starts.
+func (p *Parser) parseExpressionStmt() ExpressionStmt {
+    pos := p.cur().Pos
+    return ExpressionStmt{Type: "Expression", Value: p.parseExpression(precLowest), Pos: pos}
+}
+
 func (p *Parser) parseExpression(minPrec int) Expr {
+    from := p.i
     left := p.parsePrefix()
 
     for {
@@ -98,50 +285,50 @@ func (p *Parser) parseExpression(minPrec int) Expr {
             if id, ok := left.(Identifier); ok {
                 p.next()
                 right := p.parseExpression(precLowest)
-                left = AssignExpr{Name: id, Type: "Assignment", Value: right}
+                left = AssignExpr{Name: id, Type: "Assignment", Value: right, Pos: id.Pos}
                 continue
             }
             break
         }
         // Handle call and indexing as highest precedence postfix
         if t.Type == "(" { // call
-            p.next()
+            calleeEnd := p.end(p.i - 1)
+            p.opened("Argument list", p.next())
             var args []Expr
             if !p.match(")") {
                 for {
-                    args = append(args, p.parseExpression(precLowest))
+                    args = append(args, p.parseItem())
                     if p.match(")") { break }
                     p.expect(",")
                 }
             }
-            left = CallExpr{Arguments: args, Function: left, Type: "Call"}
+            p.closed()
+            left = CallExpr{Arguments: args, Function: left, Type: "Call", Pos: p.toks[from].Pos, CalleeEnd: calleeEnd, Source: p.text(from, p.i)}
             continue
         }
         if t.Type == "[" { // indexing
-            p.next()
+            p.opened("Index", p.next())
             idx := p.parseExpression(precLowest)
             p.expect("]")
-            left = IndexExpr{Index: idx, Left: left, Type: "Index"}
+            p.closed()
+            left = IndexExpr{Index: idx, Left: left, Type: "Index", Pos: t.Pos}
             continue
         }
 
-        // Infix operators
-        op := t.Type
-        if !(op == "+" || op == "-" || op == "*" || op == "/" ||
-            op == ">" || op == "<" || op == ">=" || op == "<=" || op == "==" || op == "!=" ||
-            op == "&&" || op == "||" ||
-            op == ">>" || op == "|>") {
-            break
+        // a lone | right after an operand is neither an operator nor the
+        // start of a lambda's parameters
+        if t.Type == "|" && p.i > 0 && p.toks[p.i-1].Pos.Line == t.Pos.Line {
+            panic(Error{Msg: "unexpected |, logical or is ||", Pos: t.Pos})
         }
 
-        // Determine precedence and associativity
-        pPrec := precedence(op)
-        rightAssoc := (op == ">>")
-        if pPrec < minPrec { break }
+        // Infix operators
+        op := t.Type
+        info, ok := binaryOps[op]
+        if !ok || info.prec < minPrec { break }
         // consume operator
         p.next()
-        nextMin := pPrec + 1
-        if rightAssoc { nextMin = pPrec }
+        nextMin := info.prec + 1
+        if info.right { nextMin = info.prec }
         right := p.parseExpression(nextMin)
 
         // Special shapes for compose and thread
@@ -158,7 +345,7 @@ func (p *Parser) parseExpression(minPrec int) Expr {
             } else {
                 funcs = append(funcs, right)
             }
-            left = FunctionComposition{Functions: funcs, Type: "FunctionComposition"}
+            left = FunctionComposition{Functions: funcs, Type: "FunctionComposition", Pos: p.toks[from].Pos}
             continue
         }
         if op == "|>" {
@@ -178,11 +365,11 @@ func (p *Parser) parseExpression(minPrec int) Expr {
             default:
                 funcs = append(funcs, r)
             }
-            left = FunctionThread{Functions: funcs, Initial: init, Type: "FunctionThread"}
+            left = FunctionThread{Functions: funcs, Initial: init, Type: "FunctionThread", Pos: p.toks[from].Pos}
             continue
         }
 
-        left = InfixExpr{Left: left, Operator: op, Right: right, Type: "Infix"}
+        left = InfixExpr{Left: left, Operator: op, Right: right, Type: "Infix", Pos: t.Pos}
     }
 
     return left
@@ -192,35 +379,52 @@ func (p *Parser) parsePrefix() Expr {
     t := p.next()
     switch t.Type {
     case "-":
-        // unary minus
-        operand := p.parseExpression(precMul) // higher than add/sub
-        return PrefixExpr{Operator: "-", Operand: operand, Type: "Prefix"}
+        // unary minus applies to its operand's calls and indexing, and binds
+        // tighter than any binary operator: -f(x) * 2 is (-(f(x))) * 2
+        operand := p.parseExpression(precCallIndex)
+        return PrefixExpr{Operator: "-", Operand: operand, Type: "Prefix", Pos: t.Pos}
     case "INT":
-        return IntegerLit{Type: "Integer", Value: t.Lit}
+        return IntegerLit{Type: "Integer", Value: t.Lit, Pos: t.Pos}
     case "DEC":
-        return DecimalLit{Type: "Decimal", Value: t.Lit}
+        if _, err := strconv.ParseFloat(strings.ReplaceAll(t.Lit, "_", ""), 64); err != nil {
+            panic(Error{Msg: fmt.Sprintf("invalid decimal literal %s", t.Lit), Pos: t.Pos})
+        }
+        return DecimalLit{Type: "Decimal", Value: t.Lit, Pos: t.Pos}
     case "STR":
-        return StringLit{Type: "String", Value: unquote(t.Lit)}
+        s, bad := unquote(t.Lit)
+        if bad >= 0 {
+            // point at the backslash, which may be lines into the literal
+            pos := t.Pos
+            for i := 0; i < bad; i++ {
+                if t.Lit[i] == '\n' { pos.Line, pos.Col = pos.Line+1, 1 } else { pos.Col++ }
+            }
+            pos.Offset += bad
+            panic(Error{Msg: fmt.Sprintf("unknown escape sequence %s", t.Lit[bad:bad+2]), Pos: pos})
+        }
+        return StringLit{Type: "String", Value: s, Pos: t.Pos}
     case "TRUE":
-        return BooleanLit{Type: "Boolean", Value: true}
+        return BooleanLit{Type: "Boolean", Value: true, Pos: t.Pos}
     case "FALSE":
-        return BooleanLit{Type: "Boolean", Value: false}
+        return BooleanLit{Type: "Boolean", Value: false, Pos: t.Pos}
     case "NIL":
-        return NilLit{Type: "Nil"}
+        return NilLit{Type: "Nil", Pos: t.Pos}
     case "ID":
-        return Identifier{Name: t.Lit, Type: "Identifier"}
+        return Identifier{Name: t.Lit, Type: "Identifier", Pos: t.Pos}
     case "[":
+        p.opened("List", t)
         items := make([]Expr, 0)
         if !p.match("]") {
             for {
-                items = append(items, p.parseExpression(precLowest))
+                items = append(items, p.parseItem())
                 if p.match("]") { break }
                 p.expect(",")
             }
         }
-        return ListLit{Items: items, Type: "List"}
+        p.closed()
+        return ListLit{Items: items, Type: "List", Pos: t.Pos}
     case "{":
         // Set literal
+        p.opened("Set", t)
         items := make([]Expr, 0)
         if !p.match("}") {
             for {
@@ -229,8 +433,10 @@ func (p *Parser) parsePrefix() Expr {
                 p.expect(",")
             }
         }
-        return SetLit{Items: items, Type: "Set"}
+        p.closed()
+        return SetLit{Items: items, Type: "Set", Pos: t.Pos}
     case "#{":
+        p.opened("Dictionary", t)
         items := make([]DictEntry, 0)
         if !p.match("}") { // closing brace is just '}' after '#{'
             for {
@@ -242,94 +448,242 @@ func (p *Parser) parsePrefix() Expr {
                 p.expect(",")
             }
         }
-        return DictLit{Items: items, Type: "Dictionary"}
+        p.closed()
+        return DictLit{Items: items, Type: "Dictionary", Pos: t.Pos}
     case "(":
+        p.opened("Parenthesis", t)
         expr := p.parseExpression(precLowest)
         p.expect(")")
+        p.closed()
         return expr
     case "|", "||":
         // Function literal: |params| body
         var params []Identifier
         if t.Type == "|" && !p.match("|") { // parameters present; for "||" we already consumed both
             for {
-                idTok := p.expect("ID")
-                params = append(params, Identifier{Name: idTok.Lit, Type: "Identifier"})
+                idTok := p.expectName()
+                params = append(params, Identifier{Name: idTok.Lit, Type: "Identifier", Pos: idTok.Pos})
                 if p.match("|") { break }
                 p.expect(",")
             }
         }
         // Body: expression or block
-        var body Block
-        if p.cur().Type == "{" { // block body
-            body = p.parseBlock()
-        } else {
-            // single expression wrapped in a Block
-            expr := p.parseExpression(precLowest)
-            body = Block{Statements: []Statement{ExpressionStmt{Type: "Expression", Value: expr}}, Type: "Block"}
+        if next := p.cur(); !startsOperand(next.Type) {
+            panic(Error{Msg: fmt.Sprintf("expected a function body after %s, found %s", lambdaHead(t.Type, params), next.Type), Pos: next.Pos})
         }
-        return FunctionLit{Body: body, Parameters: params, Type: "Function"}
+        // a loop around the function can't be broken out of from its body
+        body := p.withLoops(0, func() Block {
+            if p.cur().Type == "{" { return p.parseBlock() }
+            // single expression wrapped in a Block
+            return p.expressionBlock()
+        })
+        return FunctionLit{Body: body, Parameters: params, Type: "Function", Pos: t.Pos}
     case "LET":
         // let (mut)? name = expr
         mut := false
-        if p.cur().Type == "MUT" { p.next(); mut = true }
-        nameTok := p.expect("ID")
+        // `let mut = ...` tries to name a variable mut
+        if p.cur().Type == "MUT" && p.peek(1).Type != "=" { p.next(); mut = true }
+        nameTok := p.expectName()
         p.expect("=")
         val := p.parseExpression(precLowest)
         typ := "Let"; if mut { typ = "MutableLet" }
-        return LetExpr{Name: Identifier{Name: nameTok.Lit, Type: "Identifier"}, Type: typ, Value: val}
+        return LetExpr{Name: Identifier{Name: nameTok.Lit, Type: "Identifier", Pos: nameTok.Pos}, Type: typ, Value: val, Pos: t.Pos}
     case "IF":
-        cond := p.parseExpression(precCompare)
+        cond := p.parseExpression(precLowest)
         cons := p.parseBlock()
-        p.expect("ELSE")
-        alt := p.parseBlock()
-        return IfExpr{Alternative: alt, Condition: cond, Consequence: cons, Type: "If"}
+        var alt *Block
+        if p.match("ELSE") {
+            var b Block
+            if p.cur().Type == "IF" {
+                // else if: the alternative is the nested if alone
+                nested := p.parsePrefix()
+                pos := PosOf(nested)
+                b = Block{Statements: []Statement{ExpressionStmt{Type: "Expression", Value: nested, Pos: pos}}, Type: "Block", Pos: pos}
+            } else {
+                b = p.parseBlock()
+            }
+            alt = &b
+        }
+        return IfExpr{Alternative: alt, Condition: cond, Consequence: cons, Type: "If", Pos: t.Pos}
+    case "MATCH":
+        return p.parseMatch(t)
+    case "WHILE":
+        cond := p.parseExpression(precLowest)
+        return LoopExpr{Body: p.withLoops(p.loops+1, p.parseBlock), Condition: cond, Type: "While", Pos: t.Pos}
+    case "LOOP":
+        return LoopExpr{Body: p.withLoops(p.loops+1, p.parseBlock), Type: "Loop", Pos: t.Pos}
+    case "BREAK":
+        if p.loops == 0 { panic(Error{Msg: "break outside of a loop", Pos: t.Pos}) }
+        var val Expr
+        if startsOperand(p.cur().Type) { val = p.parseExpression(precLowest) }
+        return BreakExpr{Type: "Break", Value: val, Pos: t.Pos}
+    case "CONTINUE":
+        if p.loops == 0 { panic(Error{Msg: "continue outside of a loop", Pos: t.Pos}) }
+        return ContinueExpr{Type: "Continue", Pos: t.Pos}
+    case "EOF":
+        panic(p.atEOF())
+    case "MUT", "ELSE":
+        // only valid after let and an if's block
+        panic(reserved(t))
     default:
         // Fallback for unexpected token; return identifier of the literal token
-        return Identifier{Name: strings.TrimSpace(t.Lit), Type: "Identifier"}
+        return Identifier{Name: strings.TrimSpace(t.Lit), Type: "Identifier", Pos: t.Pos}
+    }
+}
+
+// startsOperand reports whether a token of type typ can begin an operand.
+// It is what tells `||` the empty-parameter lambda apart from `||` the
+// operator: the lambda is only read where an operand is expected, and its
+// body must then follow.
+func startsOperand(typ string) bool {
+    switch typ {
+    case ";", ",", ")", "]", "}", ":", "=", "->", "EOF", "ELSE", "CMT":
+        return false
+    }
+    _, infix := binaryOps[typ]
+    return !infix || typ == "-" || typ == "||"
+}
+
+func lambdaHead(typ string, params []Identifier) string {
+    if typ == "||" || len(params) == 0 { return "||" }
+    names := make([]string, len(params))
+    for i, p := range params { names[i] = p.Name }
+    return "|" + strings.Join(names, ", ") + "|"
+}
+
+// withLoops runs parse as if within n loops, however it ends.
+func (p *Parser) withLoops(n int, parse func() Block) Block {
+    outer := p.loops
+    p.loops = n
+    defer func() { p.loops = outer }()
+    return parse()
+}
+
+// parseItem parses a list item or call argument, which may be spread.
+func (p *Parser) parseItem() Expr {
+    if t := p.cur(); t.Type == ".." {
+        p.next()
+        return Spread{Type: "Spread", Value: p.parseExpression(precLowest), Pos: t.Pos}
+    }
+    return p.parseExpression(precLowest)
+}
+
+// parseMatch parses `match subject { pattern -> body, ... }` after the
+// keyword t. Cases are separated by commas, and a body is an expression or
+// a block.
+func (p *Parser) parseMatch(t lexer.Token) MatchExpr {
+    subject := p.parseExpression(precLowest)
+    p.opened("Match", p.expect("{"))
+    var cases []MatchCase
+    for !p.match("}") {
+        pat := p.parsePattern()
+        p.expect("->")
+        var body Block
+        if p.cur().Type == "{" {
+            body = p.parseBlock()
+        } else {
+            body = p.expressionBlock()
+        }
+        cases = append(cases, MatchCase{Body: body, Pattern: pat})
+        if p.match("}") { break }
+        p.expect(",")
+    }
+    p.closed()
+    return MatchExpr{Cases: cases, Subject: subject, Type: "Match", Pos: t.Pos}
+}
+
+// parsePattern parses a match pattern: a literal (a number may be
+// negated), a name to bind, _ to match anything, or a list of patterns
+// matching a list of the same size item by item.
+func (p *Parser) parsePattern() Expr {
+    t := p.next()
+    switch t.Type {
+    case "ID":
+        if t.Lit == "_" { return Wildcard{Type: "Wildcard", Pos: t.Pos} }
+        return Identifier{Name: t.Lit, Type: "Identifier", Pos: t.Pos}
+    case "INT", "DEC", "STR", "TRUE", "FALSE", "NIL":
+        p.i--
+        return p.parsePrefix()
+    case "-":
+        if n := p.cur().Type; n == "INT" || n == "DEC" { return PrefixExpr{Operator: "-", Operand: p.parsePrefix(), Type: "Prefix", Pos: t.Pos} }
+    case "[":
+        p.opened("List", t)
+        items := make([]Expr, 0)
+        if !p.match("]") {
+            for {
+                items = append(items, p.parsePattern())
+                if p.match("]") { break }
+                p.expect(",")
+            }
+        }
+        p.closed()
+        return ListLit{Items: items, Type: "List", Pos: t.Pos}
+    case "EOF":
+        panic(p.atEOF())
     }
+    if keywords[t.Type] { panic(reserved(t)) }
+    panic(Error{Msg: fmt.Sprintf("expected a pattern, found %s", t.Type), Pos: t.Pos})
+}
+
+// expressionBlock parses a single expression standing in for a block, as
+// the body of a function or section.
+func (p *Parser) expressionBlock() Block {
+    st := p.parseExpressionStmt()
+    return Block{Statements: []Statement{st}, Type: "Block", Pos: st.Pos}
 }
 
 func (p *Parser) parseBlock() Block {
-    p.expect("{")
+    brace := p.expect("{")
+    p.opened("Block", brace)
     var stmts []Statement
     for p.cur().Type != "}" && p.cur().Type != "EOF" {
-        if p.cur().Type == "CMT" {
-            c := p.next()
-            stmts = append(stmts, CommentStmt{Type: "Comment", Value: c.Lit})
-            if p.match(";") { /* optional */ }
-            continue
-        }
-        expr := p.parseExpression(precLowest)
-        stmts = append(stmts, ExpressionStmt{Type: "Expression", Value: expr})
-        _ = p.match(";")
+        st, ok := p.recovering(true)
+        if ok { stmts = append(stmts, st) }
+        // sections may also be separated by commas
+        if _, isSection := st.(Section); !p.match(";") && isSection { _ = p.match(",") }
     }
     p.expect("}")
-    return Block{Statements: stmts, Type: "Block"}
+    p.closed()
+    return Block{Statements: stmts, Type: "Block", Pos: brace.Pos}
 }
 
-// unquote removes surrounding quotes from a STR token and unescapes sequences.
-func unquote(s string) string {
-    if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
-        s = s[1:len(s)-1]
+// atSection reports whether the upcoming tokens start a `name: body` section.
+func (p *Parser) atSection() bool {
+    return p.cur().Type == "ID" && p.peek(1).Type == ":"
+}
+
+// parseSection parses `name: { ... }` or `name: expr`; an expression body is
+// wrapped in a Block in the same way as single-expression function bodies.
+func (p *Parser) parseSection() Section {
+    name := p.expect("ID")
+    p.expect(":")
+    var body Block
+    if p.cur().Type == "{" {
+        body = p.parseBlock()
+    } else {
+        body = p.expressionBlock()
     }
-    // handle simple escapes: \n, \t, \", \\
+    return Section{Body: body, Name: name.Lit, Type: "Section", Pos: name.Pos}
+}
+
+// unquote returns the string a string literal stands for, a raw one being
+// taken as written. bad is the offset within lit of an unknown escape
+// sequence, or -1.
+func unquote(lit string) (s string, bad int) {
+    if raw, ok := strings.CutPrefix(lit, "`"); ok { return strings.TrimSuffix(raw, "`"), -1 }
+    s = lit
+    if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' { s = s[1:len(s)-1] }
     var b strings.Builder
     for i := 0; i < len(s); i++ {
         c := s[i]
         if c == '\\' && i+1 < len(s) {
             i++
-            switch s[i] {
-            case 'n': b.WriteByte('\n')
-            case 't': b.WriteByte('\t')
-            case '"': b.WriteByte('"')
-            case '\\': b.WriteByte('\\')
-            default:
-                // preserve unknown escapes as-is without backslash
-                b.WriteByte(s[i])
-            }
+            r, ok := lexer.Unescape(s[i])
+            if !ok { return "", i }
+            b.WriteByte(r)
             continue
         }
         b.WriteByte(c)
     }
-    return b.String()
+    return b.String(), -1
 }
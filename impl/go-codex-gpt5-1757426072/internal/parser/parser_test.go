@@ -0,0 +1,306 @@
+package parser
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// group renders an expression fully parenthesised, so a test can state how
+// the parser grouped it.
+func group(e Expr) string {
+    switch x := e.(type) {
+    case Identifier: return x.Name
+    case IntegerLit: return x.Value
+    case DecimalLit: return x.Value
+    case InfixExpr: return "(" + group(x.Left) + " " + x.Operator + " " + group(x.Right) + ")"
+    case PrefixExpr: return "(" + x.Operator + group(x.Operand) + ")"
+    case CallExpr: return group(x.Function) + "(" + groupAll(x.Arguments, ", ") + ")"
+    case IndexExpr: return group(x.Left) + "[" + group(x.Index) + "]"
+    case FunctionThread: return "(" + group(x.Initial) + " |> " + groupAll(x.Functions, " |> ") + ")"
+    case FunctionComposition: return "(" + groupAll(x.Functions, " >> ") + ")"
+    case IfExpr: return "if " + group(x.Condition)
+    case FunctionLit:
+        names := make([]string, len(x.Parameters))
+        for i, p := range x.Parameters { names[i] = p.Name }
+        body := make([]Expr, 0, len(x.Body.Statements))
+        for _, st := range x.Body.Statements { body = append(body, st.(ExpressionStmt).Value) }
+        return "(|" + strings.Join(names, ", ") + "| " + groupAll(body, "; ") + ")"
+    case LetExpr: return "let " + x.Name.Name + " = " + group(x.Value)
+    case ListLit: return "[" + groupAll(x.Items, ", ") + "]"
+    case Spread: return ".." + group(x.Value)
+    case BooleanLit: return fmt.Sprint(x.Value)
+    }
+    return fmt.Sprintf("%T", e)
+}
+
+func groupAll(es []Expr, sep string) string {
+    out := make([]string, len(es))
+    for i, e := range es { out[i] = group(e) }
+    return strings.Join(out, sep)
+}
+
+func TestPrecedence(t *testing.T) {
+    tests := []struct{ src, want string }{
+        // arithmetic
+        {"1 + 2 * 3", "(1 + (2 * 3))"},
+        {"1 * 2 + 3", "((1 * 2) + 3)"},
+        {"10 - 5 - 2", "((10 - 5) - 2)"},
+        {"8 / 4 / 2", "((8 / 4) / 2)"},
+        {"1 + 7 % 4 * 2", "(1 + ((7 % 4) * 2))"},
+        {"a * b % c", "((a * b) % c)"},
+        // composition binds looser than arithmetic, and to the right
+        {"f >> g >> h", "(f >> g >> h)"},
+        {"a + b >> c", "((a + b) >> c)"},
+        // threading binds looser than composition and arithmetic
+        {"x |> f >> g", "(x |> (f >> g))"},
+        {"xs |> sum + 1", "(xs |> (sum + 1))"},
+        {"x |> f(1) |> g", "(x |> f(1) |> g)"},
+        // comparison binds looser than threading
+        {"a > b |> f", "(a > (b |> f))"},
+        {"x |> f == y", "((x |> f) == y)"},
+        {"a + 1 < b * 2", "((a + 1) < (b * 2))"},
+        // logical operators bind loosest, && tighter than ||
+        {"a == b && c != d", "((a == b) && (c != d))"},
+        {"a || b && c", "(a || (b && c))"},
+        {"a && b || c", "((a && b) || c)"},
+        {"a || b || c", "((a || b) || c)"},
+        // calls and indexing bind tightest
+        {"f(x)[0] + 1", "(f(x)[0] + 1)"},
+        {"xs[0] * ys[1]", "(xs[0] * ys[1])"},
+        // unary minus binds tighter than binary operators, looser than postfix
+        {"-a * b", "((-a) * b)"},
+        {"-a - b", "((-a) - b)"},
+        {"a - -b", "(a - (-b))"},
+        {"2 * -3", "(2 * (-3))"},
+        {"- -3", "(-(-3))"},
+        {"-f(x)", "(-f(x))"},
+        {"-xs[0]", "(-xs[0])"},
+        {"-m[0](1)", "(-m[0](1))"},
+        {"-f(x) * 2", "((-f(x)) * 2)"},
+        {"-x |> f", "((-x) |> f)"},
+        {"-a > b", "((-a) > b)"},
+        // ranges bind looser than arithmetic, tighter than composition
+        {"1..n + 1", "(1 .. (n + 1))"},
+        {"a * 2..=b", "((a * 2) ..= b)"},
+        {"1..10 |> f", "((1 .. 10) |> f)"},
+        {"[..1..3]", "[..(1 .. 3)]"},
+        // a spread takes a whole expression
+        {"[1, ..xs |> f, 2]", "[1, ..(xs |> f), 2]"},
+        {"f(..a + b, c)", "f(..(a + b), c)"},
+        {"f(..xs)(..ys)", "f(..xs)(..ys)"},
+        // if conditions take a whole expression
+        {"if a > b && c { 1 } else { 2 }", "if ((a > b) && c)"},
+        {"if x |> f || y { 1 } else { 2 }", "if ((x |> f) || y)"},
+    }
+    for _, tt := range tests {
+        prog, err := Parse(tt.src)
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        if len(prog.Statements) != 1 { t.Errorf("%s: got %d statements", tt.src, len(prog.Statements)); continue }
+        got := group(prog.Statements[0].(ExpressionStmt).Value)
+        if got != tt.want { t.Errorf("%s: got %s, want %s", tt.src, got, tt.want) }
+    }
+}
+
+func TestEmptyParameterLambda(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"let f = || 1", "let f = (|| 1)"},
+        {"|| 1", "(|| 1)"},
+        {"(|| 1)()", "(|| 1)()"},
+        {"f(|| 1, || 2)", "f((|| 1), (|| 2))"},
+        {"[|| 1][0]()", "[(|| 1)][0]()"},
+        {"x || || true", "(x || (|| true))"},
+        {"x || y", "(x || y)"},
+        {"|| || 1", "(|| (|| 1))"},
+        {"|| a || b", "(|| (a || b))"},
+        {"|| -1", "(|| (-1))"},
+        {"x |> || 1", "(x |> (|| 1))"},
+        {"|a| || a", "(|a| (|| a))"},
+        {"|| { 1 }", "(|| 1)"},
+    }
+    for _, tt := range tests {
+        prog, err := Parse(tt.src)
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        if len(prog.Statements) != 1 { t.Errorf("%s: got %d statements", tt.src, len(prog.Statements)); continue }
+        got := group(prog.Statements[0].(ExpressionStmt).Value)
+        if got != tt.want { t.Errorf("%s: got %s, want %s", tt.src, got, tt.want) }
+    }
+}
+
+func TestLambdaErrors(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"let f = ||;", "Parse error at 1:11: expected a function body after ||, found ;"},
+        {"f(||)", "Parse error at 1:5: expected a function body after ||, found )"},
+        {"|a, b|", "Parse error: expected a function body after |a, b|, found EOF"},
+        {"1 | 2", "Parse error at 1:3: unexpected |, logical or is ||"},
+        {"x ||", "Parse error: unexpected end of input"},
+    }
+    for _, tt := range tests {
+        _, err := Parse(tt.src)
+        if err == nil || err.Error() != tt.want { t.Errorf("%s: got %v, want %s", tt.src, err, tt.want) }
+    }
+}
+
+func TestUnclosedDelimiters(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"let f = |x| {\n  x + 1\n", "Parse error at 1:13: Block opened at line 1 is never closed"},
+        {"if a {\n  1\n} else {\n  f(1, [2,\n", "Parse error at 4:8: List opened at line 4 is never closed"},
+        {"puts(1, 2", "Parse error at 1:5: Argument list opened at line 1 is never closed"},
+        {"puts(1,", "Parse error at 1:5: Argument list opened at line 1 is never closed"},
+        {"(1 + 2", "Parse error at 1:1: Parenthesis opened at line 1 is never closed"},
+        {"xs[0", "Parse error at 1:3: Index opened at line 1 is never closed"},
+        {"{1, 2", "Parse error at 1:1: Set opened at line 1 is never closed"},
+        {"#{1: 2", "Parse error at 1:1: Dictionary opened at line 1 is never closed"},
+        {"let a = 1;\n/* a\n comment", "Parse error at 2:1: Block comment opened at line 2 is never closed"},
+        {"let f = || {\n  1 /*\n", "Parse error at 2:5: Block comment opened at line 2 is never closed"},
+        {"match x {\n  1 -> 2,\n", "Parse error at 1:9: Match opened at line 1 is never closed"},
+    }
+    for _, tt := range tests {
+        _, err := Parse(tt.src)
+        if err == nil || err.Error() != tt.want { t.Errorf("%q: got %v, want %s", tt.src, err, tt.want) }
+    }
+}
+
+func TestIfElse(t *testing.T) {
+    block := func(v string) string { return `{"statements":[{"type":"Expression","value":` + v + `}],"type":"Block"}` }
+    one, two, three := `{"type":"Integer","value":"1"}`, `{"type":"Integer","value":"2"}`, `{"type":"Integer","value":"3"}`
+    tests := []struct{ src, want string }{
+        // without an else there is no alternative
+        {"if a { 1 }", `{"condition":{"name":"a","type":"Identifier"},"consequence":` + block(one) + `,"type":"If"}`},
+        {"if a { 1 } else { 2 }", `{"alternative":` + block(two) + `,"condition":{"name":"a","type":"Identifier"},"consequence":` + block(one) + `,"type":"If"}`},
+        // else if nests an if as the whole alternative
+        {"if a { 1 } else if b { 2 } else { 3 }", `{"alternative":` + block(`{"alternative":` + block(three) + `,"condition":{"name":"b","type":"Identifier"},"consequence":` + block(two) + `,"type":"If"}`) + `,"condition":{"name":"a","type":"Identifier"},"consequence":` + block(one) + `,"type":"If"}`},
+    }
+    for _, tt := range tests {
+        prog, err := Parse(tt.src)
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        got, _ := json.Marshal(prog.Statements[0].(ExpressionStmt).Value)
+        if string(got) != tt.want { t.Errorf("%s:\ngot  %s\nwant %s", tt.src, got, tt.want) }
+    }
+    // an if ends at its last block, so operators after it apply to the whole chain
+    prog, err := Parse("if a { 1 } else if b { 2 } else { 3 } + 4")
+    if err != nil { t.Fatal(err) }
+    if got := group(prog.Statements[0].(ExpressionStmt).Value); got != "(if a + 4)" { t.Errorf("got %s, want (if a + 4)", got) }
+}
+
+func TestLoops(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"while a { b }", `{"body":{"statements":[{"type":"Expression","value":{"name":"b","type":"Identifier"}}],"type":"Block"},"condition":{"name":"a","type":"Identifier"},"type":"While"}`},
+        {"loop { break }", `{"body":{"statements":[{"type":"Expression","value":{"type":"Break"}}],"type":"Block"},"type":"Loop"}`},
+        {"loop { break 1 + 2 }", `{"body":{"statements":[{"type":"Expression","value":{"type":"Break","value":{"left":{"type":"Integer","value":"1"},"operator":"+","right":{"type":"Integer","value":"2"},"type":"Infix"}}}],"type":"Block"},"type":"Loop"}`},
+        {"while a { continue; }", `{"body":{"statements":[{"type":"Expression","value":{"type":"Continue"}}],"type":"Block"},"condition":{"name":"a","type":"Identifier"},"type":"While"}`},
+    }
+    for _, tt := range tests {
+        prog, err := Parse(tt.src)
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        got, _ := json.Marshal(prog.Statements[0].(ExpressionStmt).Value)
+        if string(got) != tt.want { t.Errorf("%s:\ngot  %s\nwant %s", tt.src, got, tt.want) }
+    }
+    errs := []struct{ src, want string }{
+        {"break", "Parse error at 1:1: break outside of a loop"},
+        {"if a { continue }", "Parse error at 1:8: continue outside of a loop"},
+        // a function's body is outside the loops around the function
+        {"loop { let f = || break; }", "Parse error at 1:19: break outside of a loop"},
+        {"let while = 1", "Parse error at 1:5: 'while' is a reserved keyword"},
+        {"loop 1", "Parse error at 1:6: expected {, found INT"},
+    }
+    for _, tt := range errs {
+        _, err := Parse(tt.src)
+        if err == nil || err.Error() != tt.want { t.Errorf("%s: got %v, want %s", tt.src, err, tt.want) }
+    }
+    // after an error in a loop's body, the loop still encloses what follows
+    if _, err := Parse("loop { let = 1; break }"); err == nil || strings.Contains(err.Error(), "outside") { t.Errorf("got %v", err) }
+}
+
+func TestMatchErrors(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"match x { 1 2 }", "Parse error at 1:13: expected ->, found INT"},
+        {"match x { 1 -> 2 3 -> 4 }", "Parse error at 1:18: expected ,, found INT"},
+        {"match x { f(1) -> 2 }", "Parse error at 1:12: expected ->, found ("},
+        {"match x { |a| a -> 1 }", "Parse error at 1:11: expected a pattern, found |"},
+        {"match x { let -> 1 }", "Parse error at 1:11: 'let' is a reserved keyword"},
+        {"let match = 1", "Parse error at 1:5: 'match' is a reserved keyword"},
+    }
+    for _, tt := range tests {
+        _, err := Parse(tt.src)
+        if err == nil || err.Error() != tt.want { t.Errorf("%s: got %v, want %s", tt.src, err, tt.want) }
+    }
+}
+
+func TestIntegerLiteralRange(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"9223372036854775807", ""},
+        {"9_223_372_036_854_775_807", ""},
+        // beyond int64, the evaluator's Integers grow as needed
+        {"let n = 9223372036854775808", ""},
+        {"[1,\n 123_456_789_012_345_678_901_234_567_890]", ""},
+    }
+    for _, tt := range tests {
+        _, err := Parse(tt.src)
+        got := ""
+        if err != nil { got = err.Error() }
+        if got != tt.want { t.Errorf("%s: got %q, want %q", tt.src, got, tt.want) }
+    }
+}
+
+func TestStringEscapes(t *testing.T) {
+    tests := []struct{ src, want, err string }{
+        {`"a\nb\tc\rd\0e\"f\\g"`, "a\nb\tc\rd\x00e\"f\\g", ""},
+        {`"\q"`, "", "Parse error at 1:2: unknown escape sequence \\q"},
+        {"let s = \"ab\ncd\\x\"", "", "Parse error at 2:3: unknown escape sequence \\x"},
+        // raw strings take backslashes as written
+        {"`\\d+\\.\\q`", `\d+\.\q`, ""},
+        {"`C:\\dir\n\"x\"`", "C:\\dir\n\"x\"", ""},
+        {"``", "", ""},
+    }
+    for _, tt := range tests {
+        prog, err := Parse(tt.src)
+        if tt.err != "" {
+            if err == nil || err.Error() != tt.err { t.Errorf("%s: got %v, want %s", tt.src, err, tt.err) }
+            continue
+        }
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        got := prog.Statements[0].(ExpressionStmt).Value.(StringLit).Value
+        if got != tt.want { t.Errorf("%s: got %q, want %q", tt.src, got, tt.want) }
+    }
+}
+
+func TestReservedKeywords(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"let if = 1", "Parse error at 1:5: 'if' is a reserved keyword"},
+        {"let mut let = 1", "Parse error at 1:9: 'let' is a reserved keyword"},
+        {"let mut = 1", "Parse error at 1:5: 'mut' is a reserved keyword"},
+        {"let nil = 1", "Parse error at 1:5: 'nil' is a reserved keyword"},
+        {"|x, else| x", "Parse error at 1:5: 'else' is a reserved keyword"},
+        {"puts(else)", "Parse error at 1:6: 'else' is a reserved keyword"},
+        {"let x = mut", "Parse error at 1:9: 'mut' is a reserved keyword"},
+    }
+    for _, tt := range tests {
+        _, err := Parse(tt.src)
+        if err == nil || err.Error() != tt.want { t.Errorf("%s: got %v, want %s", tt.src, err, tt.want) }
+    }
+}
+
+func TestErrorRecovery(t *testing.T) {
+    src := "let a = (1;\nlet b = 2\nlet if = 3\nputs(a, b\n  , else)\nlet f = |x| {\n  let mut = x;\n  x\n}\nb + 1"
+    prog, err := Parse(src)
+    errs, ok := err.(Errors)
+    if !ok { t.Fatalf("got %v, want Errors", err) }
+    want := []string{
+        "Parse error at 1:11: expected ), found ;",
+        "Parse error at 3:5: 'if' is a reserved keyword",
+        "Parse error at 5:5: 'else' is a reserved keyword",
+        "Parse error at 7:7: 'mut' is a reserved keyword",
+    }
+    if len(errs) != len(want) { t.Fatalf("got %d errors: %v", len(errs), errs) }
+    for i, e := range errs {
+        if e.Error() != want[i] { t.Errorf("error %d: got %s, want %s", i, e, want[i]) }
+    }
+    if errs[0].Expected != ")" || errs[0].Found != ";" { t.Errorf("got expected %q, found %q", errs[0].Expected, errs[0].Found) }
+    if err.Error() != want[0]+" (and 3 more errors)" { t.Errorf("got %s", err) }
+    // the statements around the errors still parse
+    var got []string
+    for _, st := range prog.Statements { got = append(got, group(st.(ExpressionStmt).Value)) }
+    if strings.Join(got, "; ") != "let b = 2; let f = (|x| x); (b + 1)" { t.Errorf("got statements %v", got) }
+}
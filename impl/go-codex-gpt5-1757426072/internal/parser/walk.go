@@ -0,0 +1,179 @@
+package parser
+
+// Inspect calls fn for every statement in stmts and, recursively, for every
+// statement of the blocks nested within them (section bodies, if branches,
+// match cases, loop and function bodies), in source order.
+func Inspect(stmts []Statement, fn func(Statement)) {
+    for _, st := range stmts {
+        fn(st)
+        switch x := st.(type) {
+        case Section:
+            Inspect(x.Body.Statements, fn)
+        case ExpressionStmt:
+            inspectExpr(x.Value, fn)
+        }
+    }
+}
+
+func inspectExpr(e Expr, fn func(Statement)) {
+    each := func(es ...Expr) { for _, x := range es { inspectExpr(x, fn) } }
+    switch x := e.(type) {
+    case LetExpr: each(x.Value)
+    case AssignExpr: each(x.Value)
+    case FunctionLit: Inspect(x.Body.Statements, fn)
+    case InfixExpr: each(x.Left, x.Right)
+    case PrefixExpr: each(x.Operand)
+    case Spread: each(x.Value)
+    case ListLit: each(x.Items...)
+    case SetLit: each(x.Items...)
+    case DictLit:
+        for _, it := range x.Items { each(it.Key, it.Value) }
+    case IndexExpr: each(x.Left, x.Index)
+    case IfExpr:
+        each(x.Condition)
+        Inspect(x.Consequence.Statements, fn)
+        if x.Alternative != nil { Inspect(x.Alternative.Statements, fn) }
+    case MatchExpr:
+        each(x.Subject)
+        for _, c := range x.Cases { Inspect(c.Body.Statements, fn) }
+    case LoopExpr:
+        if x.Condition != nil { each(x.Condition) }
+        Inspect(x.Body.Statements, fn)
+    case BreakExpr:
+        if x.Value != nil { each(x.Value) }
+    case CallExpr:
+        each(x.Function)
+        each(x.Arguments...)
+    case FunctionComposition: each(x.Functions...)
+    case FunctionThread:
+        each(x.Initial)
+        each(x.Functions...)
+    }
+}
+
+// MapIdentifiers returns a copy of prog with every Identifier (references,
+// let names and parameters) replaced by fn(identifier). prog is unchanged.
+func MapIdentifiers(prog Program, fn func(Identifier) Identifier) Program {
+    m := identMapper(fn)
+    return Program{Statements: m.stmts(prog.Statements), Type: prog.Type}
+}
+
+type identMapper func(Identifier) Identifier
+
+func (m identMapper) stmts(stmts []Statement) []Statement {
+    if stmts == nil { return nil }
+    out := make([]Statement, len(stmts))
+    for i, st := range stmts {
+        switch x := st.(type) {
+        case ExpressionStmt:
+            x.Value = m.expr(x.Value)
+            out[i] = x
+        case Section:
+            x.Body = m.block(x.Body)
+            out[i] = x
+        default:
+            out[i] = st
+        }
+    }
+    return out
+}
+
+func (m identMapper) block(b Block) Block {
+    b.Statements = m.stmts(b.Statements)
+    return b
+}
+
+func (m identMapper) exprs(es []Expr) []Expr {
+    if es == nil { return nil }
+    out := make([]Expr, len(es))
+    for i, e := range es { out[i] = m.expr(e) }
+    return out
+}
+
+func (m identMapper) expr(e Expr) Expr {
+    switch x := e.(type) {
+    case Identifier:
+        return m(x)
+    case LetExpr:
+        x.Name, x.Value = m(x.Name), m.expr(x.Value)
+        return x
+    case AssignExpr:
+        x.Name, x.Value = m(x.Name), m.expr(x.Value)
+        return x
+    case FunctionLit:
+        params := make([]Identifier, len(x.Parameters))
+        for i, p := range x.Parameters { params[i] = m(p) }
+        if x.Parameters == nil { params = nil }
+        x.Parameters, x.Body = params, m.block(x.Body)
+        return x
+    case InfixExpr:
+        x.Left, x.Right = m.expr(x.Left), m.expr(x.Right)
+        return x
+    case PrefixExpr:
+        x.Operand = m.expr(x.Operand)
+        return x
+    case Spread:
+        x.Value = m.expr(x.Value)
+        return x
+    case ListLit:
+        x.Items = m.exprs(x.Items)
+        return x
+    case SetLit:
+        x.Items = m.exprs(x.Items)
+        return x
+    case DictLit:
+        if x.Items == nil { return x }
+        items := make([]DictEntry, len(x.Items))
+        for i, it := range x.Items { items[i] = DictEntry{Key: m.expr(it.Key), Value: m.expr(it.Value)} }
+        x.Items = items
+        return x
+    case IndexExpr:
+        x.Left, x.Index = m.expr(x.Left), m.expr(x.Index)
+        return x
+    case IfExpr:
+        x.Condition, x.Consequence = m.expr(x.Condition), m.block(x.Consequence)
+        if x.Alternative != nil {
+            alt := m.block(*x.Alternative)
+            x.Alternative = &alt
+        }
+        return x
+    case LoopExpr:
+        if x.Condition != nil { x.Condition = m.expr(x.Condition) }
+        x.Body = m.block(x.Body)
+        return x
+    case BreakExpr:
+        if x.Value != nil { x.Value = m.expr(x.Value) }
+        return x
+    case MatchExpr:
+        cases := make([]MatchCase, len(x.Cases))
+        for i, c := range x.Cases {
+            c.Pattern, c.Body = m.expr(c.Pattern), m.block(c.Body)
+            cases[i] = c
+        }
+        x.Subject, x.Cases = m.expr(x.Subject), cases
+        return x
+    case CallExpr:
+        x.Function, x.Arguments = m.expr(x.Function), m.exprs(x.Arguments)
+        return x
+    case FunctionComposition:
+        x.Functions = m.exprs(x.Functions)
+        return x
+    case FunctionThread:
+        x.Initial, x.Functions = m.expr(x.Initial), m.exprs(x.Functions)
+        return x
+    }
+    return e
+}
+
+// PatternNames returns the identifiers a match pattern binds, in order.
+func PatternNames(pat Expr) []Identifier {
+    switch x := pat.(type) {
+    case Identifier:
+        return []Identifier{x}
+    case ListLit:
+        var ids []Identifier
+        for _, it := range x.Items { ids = append(ids, PatternNames(it)...) }
+        return ids
+    }
+    return nil
+}
@@ -0,0 +1,182 @@
+package playground
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "time"
+
+    "elf-lang/impl/internal/analysis"
+    "elf-lang/impl/internal/evaluator"
+    "elf-lang/impl/internal/parser"
+    "elf-lang/impl/internal/runner"
+)
+
+// Sandbox limits applied to every submitted program.
+const (
+    maxSourceBytes = 64 << 10
+    maxOutputBytes = 64 << 10
+    evalTimeout    = 5 * time.Second
+    // the live heap is the whole server's, so this bounds every program
+    // running at once rather than each one
+    maxHeapBytes   = 256 << 20
+)
+
+type request struct {
+    Source string `json:"source"`
+}
+
+// Response is the JSON body returned by POST /eval.
+type Response struct {
+    Output string `json:"output"`
+    Result string `json:"result,omitempty"`
+    Error  string `json:"error,omitempty"`
+}
+
+// Handler serves the playground UI at / and evaluates programs at POST /eval.
+func Handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        io.WriteString(w, page)
+    })
+    mux.HandleFunc("/eval", handleEval)
+    return mux
+}
+
+// ListenAndServe runs the playground on the given address until it fails.
+func ListenAndServe(addr string) error {
+    srv := &http.Server{Addr: addr, Handler: Handler(), ReadHeaderTimeout: 10 * time.Second}
+    return srv.ListenAndServe()
+}
+
+func handleEval(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    var req request
+    body := http.MaxBytesReader(w, r.Body, maxSourceBytes+1024)
+    if err := json.NewDecoder(body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, Response{Error: "Invalid request: expected JSON {\"source\": \"...\"}"})
+        return
+    }
+    if len(req.Source) > maxSourceBytes {
+        writeJSON(w, http.StatusRequestEntityTooLarge, Response{Error: fmt.Sprintf("Source exceeds %d bytes", maxSourceBytes)})
+        return
+    }
+    ctx, cancel := context.WithTimeout(r.Context(), evalTimeout)
+    defer cancel()
+    writeJSON(w, http.StatusOK, Eval(ctx, req.Source))
+}
+
+// Eval runs source under the sandbox limits, capturing program output
+// separately from the final result or error.
+func Eval(ctx context.Context, source string) Response {
+    out := &limitedBuffer{max: maxOutputBytes}
+    prog, err := parser.Parse(source)
+    if err != nil { return Response{Error: err.Error()} }
+    ev := evaluator.New(out)
+    ev.Sandbox()
+    ev.SetContext(ctx)
+    ev.SetMemoryLimit(maxHeapBytes)
+    diags, err := analysis.Resolve(prog, ev.Names())
+    if err == nil && len(diags) == 0 { diags, err = analysis.Redeclared(prog) }
+    if err == nil && len(diags) > 0 { err = errors.New(diags[0].Message) }
+    if err != nil { return Response{Error: err.Error()} }
+    if sol, ok := runner.Load(prog); ok {
+        results, err := runner.Run(ev, sol)
+        if err != nil { return Response{Output: out.String(), Error: err.Error()} }
+        var report bytes.Buffer
+        runner.Print(&report, results)
+        return Response{Output: out.String(), Result: report.String()}
+    }
+    v, err := ev.Eval(prog)
+    if err != nil { return Response{Output: out.String(), Error: err.Error()} }
+    return Response{Output: out.String(), Result: evaluator.Format(v)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+// limitedBuffer keeps at most max bytes of output, noting any truncation.
+type limitedBuffer struct {
+    buf       bytes.Buffer
+    max       int
+    truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+    if room := b.max - b.buf.Len(); len(p) > room {
+        b.buf.Write(p[:max(room, 0)])
+        b.truncated = true
+        return len(p), nil
+    }
+    return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+    if b.truncated { return b.buf.String() + "\n[output truncated]" }
+    return b.buf.String()
+}
+
+const page = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>elf-lang playground</title>
+<style>
+  body { font-family: sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; }
+  textarea { width: 100%; height: 18rem; font-family: monospace; font-size: 0.95rem; }
+  pre { background: #f4f4f4; padding: 0.75rem; min-height: 1.5rem; white-space: pre-wrap; }
+  .error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>elf-lang playground</h1>
+<textarea id="source" spellcheck="false">let numbers = [1, 2, 3, 4, 5];
+numbers |> map(|x| x * 2) |> filter(|x| x > 5)</textarea>
+<p><button id="run">Run</button> <small>Ctrl+Enter</small></p>
+<h2>Output</h2>
+<pre id="output"></pre>
+<h2>Result</h2>
+<pre id="result"></pre>
+<script>
+const $ = (id) => document.getElementById(id);
+async function run() {
+  $("output").textContent = "";
+  $("result").textContent = "Running...";
+  $("result").className = "";
+  try {
+    const res = await fetch("/eval", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ source: $("source").value }),
+    });
+    const data = await res.json();
+    $("output").textContent = data.output || "";
+    $("result").textContent = data.error ? "[Error] " + data.error : data.result;
+    $("result").className = data.error ? "error" : "";
+  } catch (e) {
+    $("result").textContent = String(e);
+    $("result").className = "error";
+  }
+}
+$("run").addEventListener("click", run);
+$("source").addEventListener("keydown", (e) => { if (e.ctrlKey && e.key === "Enter") run(); });
+</script>
+</body>
+</html>
+`
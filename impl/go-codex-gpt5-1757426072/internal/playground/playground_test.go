@@ -0,0 +1,47 @@
+package playground
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestEvalSandbox(t *testing.T) {
+    tests := []struct{ src string; want Response }{
+        {`puts("hi"); 1 + 2`, Response{Output: "\"hi\" \n", Result: "3"}},
+        {`read("/etc/passwd")`, Response{Error: "read(...): not available in the sandbox"}},
+        {`read("aoc://2022/1")`, Response{Error: "read(...): not available in the sandbox"}},
+        {`read_aoc(2022, 1)`, Response{Error: "read_aoc(...): not available in the sandbox"}},
+        {`stdin()`, Response{Error: "stdin(...): not available in the sandbox"}},
+        // refused even where a builtin is reached indirectly
+        {`puts("before"); ["/etc/passwd"] |> map(read)`, Response{Output: "\"before\" \n", Error: "read(...): not available in the sandbox"}},
+        {"input: read(\"/etc/passwd\")\npart_one: size(input)", Response{Error: "read(...): not available in the sandbox"}},
+    }
+    for _, tt := range tests {
+        if got := Eval(context.Background(), tt.src); got != tt.want { t.Errorf("%s: got %+v, want %+v", tt.src, got, tt.want) }
+    }
+}
+
+func TestHandler(t *testing.T) {
+    srv := httptest.NewServer(Handler())
+    defer srv.Close()
+    resp, err := http.Post(srv.URL+"/eval", "application/json", strings.NewReader(`{"source": "stdin()"}`))
+    if err != nil { t.Fatal(err) }
+    defer resp.Body.Close()
+    var got Response
+    if err := json.NewDecoder(resp.Body).Decode(&got); err != nil { t.Fatal(err) }
+    if resp.StatusCode != http.StatusOK || got.Error != "stdin(...): not available in the sandbox" { t.Errorf("got %d %+v", resp.StatusCode, got) }
+
+    resp, err = http.Get(srv.URL + "/eval")
+    if err != nil { t.Fatal(err) }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusMethodNotAllowed { t.Errorf("GET /eval: got %d, want 405", resp.StatusCode) }
+}
+
+func TestEvalMemoryLimit(t *testing.T) {
+    got := Eval(context.Background(), "let grow = |xs| grow(xs + xs);\ngrow([1])")
+    if !strings.HasPrefix(got.Error, "Memory limit of 256.0 MiB exceeded") { t.Errorf("got %+v, want the memory limit exceeded", got) }
+}
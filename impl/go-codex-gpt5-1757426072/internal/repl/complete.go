@@ -0,0 +1,85 @@
+package repl
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+
+    "elf-lang/impl/internal/evaluator"
+)
+
+// completer returns the candidates for completing the text before the
+// cursor, and the offset (in runes) of the text they replace.
+type completer func(before []rune) (start int, candidates []string)
+
+// sessionCompleter completes from the live environment: after `name[` it
+// offers the string keys of the Dict bound to name, otherwise the names in
+// scope (session bindings and builtins).
+func sessionCompleter(ev *evaluator.Evaluator) completer {
+    return func(before []rune) (int, []string) {
+        start := len(before)
+        for start > 0 && isWordRune(before[start-1]) { start-- }
+        word := string(before[start:])
+        // dictionary keys: `receiver[` or `receiver["partial`
+        keyStart, prefix := start, word
+        if keyStart > 0 && before[keyStart-1] == '"' {
+            keyStart--
+            prefix = string(before[keyStart:])
+        } else if word != "" {
+            keyStart = -1
+        }
+        if keyStart > 0 && before[keyStart-1] == '[' {
+            recvEnd := keyStart - 1
+            recvStart := recvEnd
+            for recvStart > 0 && isWordRune(before[recvStart-1]) { recvStart-- }
+            if recvStart < recvEnd {
+                if d, ok := lookupDict(ev, string(before[recvStart:recvEnd])); ok { return keyStart, dictKeys(d, prefix) }
+            }
+        }
+        if word == "" { return start, nil }
+        var out []string
+        seen := map[string]bool{}
+        for _, name := range ev.Names() {
+            if strings.HasPrefix(name, word) && !seen[name] && isWordRune([]rune(name)[0]) {
+                seen[name] = true
+                out = append(out, name)
+            }
+        }
+        return start, out
+    }
+}
+
+func lookupDict(ev *evaluator.Evaluator, name string) (evaluator.Dict, bool) {
+    v, ok := ev.Lookup(name)
+    if !ok { return evaluator.Dict{}, false }
+    d, ok := v.(evaluator.Dict)
+    return d, ok
+}
+
+// dictKeys returns the quoted string keys of d starting with prefix (which
+// may include the opening quote), each closed with `]`.
+func dictKeys(d evaluator.Dict, prefix string) []string {
+    var out []string
+    for _, it := range d.Items {
+        s, ok := it.Key.(evaluator.Str)
+        if !ok { continue }
+        key := strconv.Quote(s.V) + "]"
+        if strings.HasPrefix(key, prefix) { out = append(out, key) }
+    }
+    sort.Strings(out)
+    return out
+}
+
+func isWordRune(r rune) bool {
+    return r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= 128
+}
+
+// commonPrefix returns the longest prefix shared by every candidate.
+func commonPrefix(candidates []string) string {
+    if len(candidates) == 0 { return "" }
+    prefix := candidates[0]
+    for _, c := range candidates[1:] {
+        for !strings.HasPrefix(c, prefix) { prefix = prefix[:len(prefix)-1] }
+    }
+    return prefix
+}
@@ -0,0 +1,242 @@
+package repl
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// errInterrupt is returned when the line is abandoned with Ctrl-C.
+var errInterrupt = errors.New("interrupt")
+
+// Control keys understood by the editor.
+const (
+    keyCtrlA     = 1
+    keyCtrlB     = 2
+    keyCtrlC     = 3
+    keyCtrlD     = 4
+    keyCtrlE     = 5
+    keyCtrlF     = 6
+    keyCtrlG     = 7
+    keyBackspace = 8
+    keyTab       = 9
+    keyCtrlK     = 11
+    keyCtrlL     = 12
+    keyEnter     = 13
+    keyCtrlN     = 14
+    keyCtrlP     = 16
+    keyCtrlR     = 18
+    keyCtrlU     = 21
+    keyEscape    = 27
+    keyDelete    = 127
+)
+
+// Editing keys decoded from escape sequences, outside the rune range.
+const (
+    keyUp rune = -1 - iota
+    keyDown
+    keyRight
+    keyLeft
+    keyHome
+    keyEnd
+    keyDel
+)
+
+// editor is a minimal readline-style line editor for a raw-mode terminal:
+// cursor movement, history navigation, reverse incremental search and tab
+// completion.
+type editor struct {
+    in       *bufio.Reader
+    out      io.Writer
+    history  *History
+    complete completer // nil disables completion
+}
+
+func (e *editor) readKey() (rune, error) {
+    r, _, err := e.in.ReadRune()
+    if err != nil || r != keyEscape { return r, err }
+    // ESC [ X or ESC O X, optionally with a numeric parameter before `~`
+    next, _, err := e.in.ReadRune()
+    if err != nil { return 0, err }
+    if next != '[' && next != 'O' { return keyEscape, nil }
+    code, _, err := e.in.ReadRune()
+    if err != nil { return 0, err }
+    switch code {
+    case 'A': return keyUp, nil
+    case 'B': return keyDown, nil
+    case 'C': return keyRight, nil
+    case 'D': return keyLeft, nil
+    case 'H': return keyHome, nil
+    case 'F': return keyEnd, nil
+    }
+    param := string(code)
+    for code >= '0' && code <= '9' {
+        if code, _, err = e.in.ReadRune(); err != nil { return 0, err }
+        if code != '~' { param += string(code) }
+    }
+    switch param {
+    case "1", "7": return keyHome, nil
+    case "4", "8": return keyEnd, nil
+    case "3": return keyDel, nil
+    }
+    return keyEscape, nil
+}
+
+// readLine reads one line with editing. It returns io.EOF on Ctrl-D at an
+// empty line and errInterrupt on Ctrl-C.
+func (e *editor) readLine(prompt string) (string, error) {
+    var buf []rune
+    pos := 0
+    hist := e.history.Len() // index being shown; Len() is the line being edited
+    var draft []rune
+    refresh := func(p string) {
+        fmt.Fprintf(e.out, "\r%s%s\x1b[K\r", p, string(buf))
+        if n := len([]rune(p)) + pos; n > 0 { fmt.Fprintf(e.out, "\x1b[%dC", n) }
+    }
+    show := func(i int) {
+        if hist == e.history.Len() { draft = buf }
+        hist = i
+        if i == e.history.Len() { buf = draft } else { buf = []rune(e.history.At(i)) }
+        pos = len(buf)
+    }
+    refresh(prompt)
+    for {
+        key, err := e.readKey()
+        if err != nil { return "", err }
+        switch key {
+        case keyEnter, '\n':
+            fmt.Fprint(e.out, "\r\n")
+            return string(buf), nil
+        case keyCtrlC:
+            fmt.Fprint(e.out, "^C\r\n")
+            return "", errInterrupt
+        case keyCtrlD:
+            if len(buf) == 0 {
+                fmt.Fprint(e.out, "\r\n")
+                return "", io.EOF
+            }
+            if pos < len(buf) { buf = append(buf[:pos], buf[pos+1:]...) }
+        case keyDel:
+            if pos < len(buf) { buf = append(buf[:pos], buf[pos+1:]...) }
+        case keyBackspace, keyDelete:
+            if pos > 0 {
+                buf = append(buf[:pos-1], buf[pos:]...)
+                pos--
+            }
+        case keyLeft, keyCtrlB:
+            if pos > 0 { pos-- }
+        case keyRight, keyCtrlF:
+            if pos < len(buf) { pos++ }
+        case keyHome, keyCtrlA:
+            pos = 0
+        case keyEnd, keyCtrlE:
+            pos = len(buf)
+        case keyCtrlK:
+            buf = buf[:pos]
+        case keyCtrlU:
+            buf, pos = buf[pos:], 0
+        case keyTab:
+            if e.complete == nil { continue }
+            start, candidates := e.complete(buf[:pos])
+            if len(candidates) == 0 { continue }
+            typed := string(buf[start:pos])
+            insert := commonPrefix(candidates)
+            if len(candidates) > 1 && insert == typed {
+                // nothing more in common: list the choices below the line
+                fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+            } else if strings.HasPrefix(insert, typed) {
+                rest := []rune(insert)
+                buf = append(buf[:start], append(rest, buf[pos:]...)...)
+                pos = start + len(rest)
+            }
+        case keyCtrlL:
+            fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+        case keyUp, keyCtrlP:
+            if hist > 0 { show(hist - 1) }
+        case keyDown, keyCtrlN:
+            if hist < e.history.Len() { show(hist + 1) }
+        case keyCtrlR:
+            line, submit, err := e.search(buf)
+            if err != nil { return "", err }
+            buf, pos = []rune(line), len([]rune(line))
+            if submit {
+                refresh(prompt)
+                fmt.Fprint(e.out, "\r\n")
+                return line, nil
+            }
+        default:
+            if key < ' ' { continue }
+            buf = append(buf[:pos], append([]rune{key}, buf[pos:]...)...)
+            pos++
+        }
+        refresh(prompt)
+    }
+}
+
+// search runs a reverse incremental history search (Ctrl-R). It returns the
+// chosen line and whether Enter was pressed to run it straight away; Ctrl-G
+// or Ctrl-C abandon the search, leaving the original line.
+func (e *editor) search(original []rune) (string, bool, error) {
+    query := ""
+    match := e.history.Len()
+    found := func() string {
+        if match < e.history.Len() { return e.history.At(match) }
+        return ""
+    }
+    for {
+        label := "reverse-i-search"
+        if query != "" && match == e.history.Len() { label = "failing reverse-i-search" }
+        fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", label, query, found())
+        key, err := e.readKey()
+        if err != nil { return "", false, err }
+        switch key {
+        case keyEnter, '\n':
+            return found(), true, nil
+        case keyCtrlG, keyCtrlC:
+            return string(original), false, nil
+        case keyCtrlR:
+            if query == "" { continue }
+            if i := e.history.Search(query, match); i >= 0 { match = i }
+        case keyBackspace, keyDelete:
+            if query == "" { continue }
+            r := []rune(query)
+            query = string(r[:len(r)-1])
+            match = e.history.Len()
+            if query != "" {
+                if i := e.history.Search(query, match); i >= 0 { match = i }
+            }
+        default:
+            if key < ' ' {
+                // any other editing key accepts the match for further editing
+                if m := found(); m != "" || query == "" { return m, false, nil }
+                return string(original), false, nil
+            }
+            query += string(key)
+            if i := e.history.Search(query, match+1); i >= 0 {
+                match = i
+            } else {
+                match = e.history.Len()
+            }
+        }
+    }
+}
+
+// lineReader reads lines either through the editor (interactive terminals)
+// or plainly from a reader.
+type lineReader interface {
+    readLine(prompt string) (string, error)
+}
+
+type plainReader struct {
+    in  *bufio.Reader
+    out io.Writer
+}
+
+func (p plainReader) readLine(prompt string) (string, error) {
+    fmt.Fprint(p.out, prompt)
+    line, err := p.in.ReadString('\n')
+    if err != nil && line == "" { return "", err }
+    return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,77 @@
+package repl
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// maxHistory is the number of entries kept in the history file.
+const maxHistory = 1000
+
+// History is the list of previously entered lines, oldest first, persisted
+// to a file after every addition.
+type History struct {
+    path    string
+    entries []string
+}
+
+// DefaultHistoryPath returns ~/.elf_history, or "" when there is no home
+// directory (history is then kept for the session only).
+func DefaultHistoryPath() string {
+    home, err := os.UserHomeDir()
+    if err != nil { return "" }
+    return filepath.Join(home, ".elf_history")
+}
+
+// LoadHistory reads the history file at path; a missing file is an empty
+// history.
+func LoadHistory(path string) *History {
+    h := &History{path: path}
+    if path == "" { return h }
+    data, err := os.ReadFile(path)
+    if err != nil { return h }
+    for _, line := range strings.Split(string(data), "\n") { h.add(line) }
+    return h
+}
+
+// Add records a line, moving an identical earlier entry to the end rather
+// than keeping both, and saves the history.
+func (h *History) Add(line string) error {
+    if !h.add(line) { return nil }
+    return h.save()
+}
+
+func (h *History) add(line string) bool {
+    line = strings.TrimSpace(line)
+    if line == "" { return false }
+    for i, e := range h.entries {
+        if e == line {
+            h.entries = append(h.entries[:i], h.entries[i+1:]...)
+            break
+        }
+    }
+    h.entries = append(h.entries, line)
+    if len(h.entries) > maxHistory { h.entries = h.entries[len(h.entries)-maxHistory:] }
+    return true
+}
+
+func (h *History) save() error {
+    if h.path == "" { return nil }
+    return os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+}
+
+// Len returns the number of entries.
+func (h *History) Len() int { return len(h.entries) }
+
+// At returns the i-th entry, oldest first.
+func (h *History) At(i int) string { return h.entries[i] }
+
+// Search returns the index of the newest entry before `before` containing
+// query, or -1.
+func (h *History) Search(query string, before int) int {
+    for i := min(before, len(h.entries)) - 1; i >= 0; i-- {
+        if strings.Contains(h.entries[i], query) { return i }
+    }
+    return -1
+}
@@ -0,0 +1,89 @@
+package repl
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+
+    "elf-lang/impl/internal/evaluator"
+    "elf-lang/impl/internal/lexer"
+    "elf-lang/impl/internal/parser"
+)
+
+const (
+    prompt     = ">> "
+    contPrompt = ".. "
+)
+
+// Run starts an interactive session evaluating each entry with ev, so
+// bindings persist between entries. Input with unclosed brackets continues
+// on the next line. On an interactive terminal lines are edited in place,
+// tab-completed from the session and recorded in the history at historyPath.
+func Run(ev *evaluator.Evaluator, in *os.File, out io.Writer, historyPath string) error {
+    if isTerminal(int(in.Fd())) {
+        restore, err := makeRaw(int(in.Fd()))
+        if err == nil {
+            defer restore()
+            return session(ev, &editor{in: bufio.NewReader(in), out: out, history: LoadHistory(historyPath), complete: sessionCompleter(ev)}, out)
+        }
+    }
+    return session(ev, plainReader{in: bufio.NewReader(in), out: out}, out)
+}
+
+// session evaluates the entries lr reads until its input ends, printing
+// each value, or error and trace, to out.
+func session(ev *evaluator.Evaluator, lr lineReader, out io.Writer) error {
+    var pending string
+    for {
+        p := prompt
+        if pending != "" { p = contPrompt }
+        line, err := lr.readLine(p)
+        if errors.Is(err, errInterrupt) {
+            pending = ""
+            continue
+        }
+        if err == io.EOF { return nil }
+        if err != nil { return err }
+        if ed, ok := lr.(*editor); ok { ed.history.Add(line) }
+        pending += line + "\n"
+        if unclosed(pending) { continue }
+        src := pending
+        pending = ""
+        v, err := eval(ev, src)
+        if err != nil {
+            fmt.Fprintln(out, "[Error]", err)
+            for _, line := range evaluator.Trace(err) { fmt.Fprintln(out, " ", line) }
+            continue
+        }
+        if v != nil {
+            ev.PrintMode().Write(out, v)
+            fmt.Fprintln(out)
+        }
+    }
+}
+
+// eval runs one entry; a blank or comment-only entry yields no value.
+func eval(ev *evaluator.Evaluator, src string) (evaluator.Value, error) {
+    prog, err := parser.Parse(src)
+    if err != nil { return nil, err }
+    hasExpr := false
+    for _, st := range prog.Statements {
+        if _, ok := st.(parser.ExpressionStmt); ok { hasExpr = true }
+    }
+    if !hasExpr { return nil, nil }
+    return ev.Eval(prog)
+}
+
+// unclosed reports whether src has more opening than closing brackets.
+func unclosed(src string) bool {
+    depth := 0
+    for _, t := range lexer.Lex(src) {
+        switch t.Type {
+        case "(", "[", "{", "#{": depth++
+        case ")", "]", "}": depth--
+        }
+    }
+    return depth > 0
+}
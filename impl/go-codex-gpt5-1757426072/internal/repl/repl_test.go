@@ -0,0 +1,113 @@
+package repl
+
+import (
+    "bufio"
+    "io"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "elf-lang/impl/internal/evaluator"
+)
+
+func TestSession(t *testing.T) {
+    script := strings.Join([]string{
+        "let x = 1;",
+        "x + 1",
+        // continues while brackets are open
+        "let f = |n| {",
+        "  n * 2",
+        "}",
+        "f(x)",
+        "[1,",
+        "  2] |> map(f)",
+        // an error is reported and the session carries on
+        `x + "a" + []`,
+        "let g = |n| {",
+        "  n / 0",
+        "}",
+        "g(x)",
+        "// only a comment",
+        "x",
+    }, "\n") + "\n"
+    var out strings.Builder
+    if err := session(evaluator.New(io.Discard), plainReader{in: bufio.NewReader(strings.NewReader(script)), out: &out}, &out); err != nil { t.Fatal(err) }
+    want := strings.Join([]string{
+        ">> 1",
+        ">> 2",
+        ">> .. .. |...| { [function] }",
+        ">> 2",
+        ">> .. [2, 4]",
+        ">> [Error] Unsupported operation: String + List",
+        "  at 1:9",
+        ">> .. .. |...| { [function] }",
+        ">> [Error] Division by zero",
+        "  at 2:5",
+        "  in g, called at 1:1",
+        ">> >> 1",
+        ">> ",
+    }, "\n")
+    if out.String() != want { t.Errorf("got\n%s\nwant\n%s", out.String(), want) }
+}
+
+// readLines runs the editor over keys, returning the lines it reads.
+func readLines(e *editor, keys string) []string {
+    e.in = bufio.NewReader(strings.NewReader(keys))
+    e.out = io.Discard
+    var lines []string
+    for {
+        line, err := e.readLine(prompt)
+        if err == errInterrupt { lines = append(lines, "^C"); continue }
+        if err != nil { return lines }
+        lines = append(lines, line)
+        e.history.Add(line)
+    }
+}
+
+func TestEditor(t *testing.T) {
+    ev := evaluator.New(io.Discard)
+    prog := "let zebra_count = 1;\nlet zebra_total = 2;\nlet zoo = #{\"lion\": 1, \"llama\": 2, \"tiger\": 3};"
+    if _, err := eval(ev, prog); err != nil { t.Fatal(err) }
+    tests := []struct{ keys string; want []string }{
+        {"abc\r", []string{"abc"}},
+        // cursor movement and deletion
+        {"ac\x1b[Db\r", []string{"abc"}},
+        {"abcd\x01\x1b[3~\x05\x08\r", []string{"bc"}},
+        {"hello world\x01\x06\x06\x06\x06\x06\x0b\r", []string{"hello"}},
+        {"x\x03y\r", []string{"^C", "y"}},
+        // history, oldest first with the newest last
+        {"one\rtwo\r\x10\x10\r", []string{"one", "two", "one"}},
+        {"one\rtwo\r\x1b[A\x1b[A\x1b[B\r", []string{"one", "two", "two"}},
+        {"one\rtwo\rthree\r\x12o\r", []string{"one", "two", "three", "two"}},
+        {"one\rtwo\rthree\r\x12o\x12\r", []string{"one", "two", "three", "one"}},
+        {"one\rtwo\rthree\r\x12nope\x07x\r", []string{"one", "two", "three", "x"}},
+        // completion from the session and builtins
+        {"zebra_t\t\r", []string{"zebra_total"}},
+        {"zeb\t\r", []string{"zebra_"}},
+        {"zo\t[\t\r", []string{`zoo["`}},
+        {"zoo[\"li\t\r", []string{`zoo["lion"]`}},
+        {"zoo[\"t\t\r", []string{`zoo["tiger"]`}},
+        {"spl\t(\"a\", \"b\")\r", []string{`split("a", "b")`}},
+    }
+    for _, tt := range tests {
+        e := &editor{history: LoadHistory(""), complete: sessionCompleter(ev)}
+        if got := readLines(e, tt.keys); !reflect.DeepEqual(got, tt.want) { t.Errorf("%q: got %q, want %q", tt.keys, got, tt.want) }
+    }
+}
+
+func TestHistory(t *testing.T) {
+    path := filepath.Join(t.TempDir(), ".elf_history")
+    if err := os.WriteFile(path, []byte("a\nb\n\na\nc\n"), 0o600); err != nil { t.Fatal(err) }
+    h := LoadHistory(path)
+    // the repeated a moved after b, the blank line dropped
+    if got := []string{h.At(0), h.At(1), h.At(2)}; h.Len() != 3 || !reflect.DeepEqual(got, []string{"b", "a", "c"}) { t.Fatalf("loaded %q", got) }
+    if err := h.Add("  b "); err != nil { t.Fatal(err) }
+    if err := h.Add(""); err != nil { t.Fatal(err) }
+    data, err := os.ReadFile(path)
+    if err != nil { t.Fatal(err) }
+    if string(data) != "a\nc\nb\n" { t.Errorf("saved %q", data) }
+    if i := h.Search("b", h.Len()); i != 2 { t.Errorf("search b: got %d", i) }
+    if i := h.Search("a", 0); i != -1 { t.Errorf("search before 0: got %d", i) }
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package repl
+
+import (
+    "syscall"
+    "unsafe"
+)
+
+func ioctl(fd int, req uintptr, t *syscall.Termios) error {
+    if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(t))); errno != 0 { return errno }
+    return nil
+}
+
+func isTerminal(fd int) bool {
+    var t syscall.Termios
+    return ioctl(fd, syscall.TCGETS, &t) == nil
+}
+
+// makeRaw switches the terminal to unbuffered, unechoed input with signals
+// delivered as keys, returning a function restoring the previous state.
+// Output processing is kept so "\n" still starts a new line.
+func makeRaw(fd int) (restore func(), err error) {
+    var old syscall.Termios
+    if err := ioctl(fd, syscall.TCGETS, &old); err != nil { return nil, err }
+    raw := old
+    raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+    raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+    raw.Cflag |= syscall.CS8
+    raw.Cc[syscall.VMIN], raw.Cc[syscall.VTIME] = 1, 0
+    if err := ioctl(fd, syscall.TCSETS, &raw); err != nil { return nil, err }
+    return func() { ioctl(fd, syscall.TCSETS, &old) }, nil
+}
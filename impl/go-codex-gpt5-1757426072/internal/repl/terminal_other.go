@@ -0,0 +1,11 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// Line editing needs raw terminal mode, only implemented on Linux; elsewhere
+// the REPL reads plain lines.
+func isTerminal(fd int) bool { return false }
+
+func makeRaw(fd int) (func(), error) { return nil, errors.New("raw terminal mode not supported") }
@@ -0,0 +1,183 @@
+package runner
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "strings"
+    "time"
+
+    "elf-lang/impl/internal/evaluator"
+    "elf-lang/impl/internal/parser"
+)
+
+// Solution is a program split into its santa-lang style sections.
+type Solution struct {
+    Statements []parser.Statement // top-level statements outside any section
+    Input      *parser.Section
+    Parts      []parser.Section // part_one, part_two (whichever are present, in order)
+    Tests      []parser.Section // `test: { input: ..., part_one: ..., part_two: ... }` blocks
+}
+
+// partNames maps section names to their printed labels.
+var partNames = []struct{ section, label string }{
+    {"part_one", "Part 1"},
+    {"part_two", "Part 2"},
+}
+
+// Load splits a program into a Solution; ok is false when the program
+// declares no part sections and should be run as a plain script.
+func Load(prog parser.Program) (sol Solution, ok bool) {
+    byName := map[string]parser.Section{}
+    for _, st := range prog.Statements {
+        if sec, isSec := st.(parser.Section); isSec {
+            if sec.Name == "test" {
+                sol.Tests = append(sol.Tests, sec)
+                continue
+            }
+            byName[sec.Name] = sec
+            continue
+        }
+        sol.Statements = append(sol.Statements, st)
+    }
+    if in, found := byName["input"]; found { sol.Input = &in }
+    for _, pn := range partNames {
+        if sec, found := byName[pn.section]; found { sol.Parts = append(sol.Parts, sec) }
+    }
+    return sol, len(sol.Parts) > 0
+}
+
+// Result is the outcome of evaluating a single part.
+type Result struct {
+    Label    string
+    Value    evaluator.Value
+    Err      error
+    Duration time.Duration
+    Stats    *PartStats // only set when the evaluator gathers stats
+    Print    evaluator.PrintMode // how Value is printed, as its evaluator prints
+}
+
+// Run evaluates the top-level statements and input section, binds `input`,
+// then evaluates each part in its own scope. The returned error is reserved
+// for failures before any part runs; part failures are reported per Result.
+func Run(ev *evaluator.Evaluator, sol Solution) ([]Result, error) {
+    if err := prepare(ev, sol, sol.Input); err != nil { return nil, err }
+    return runParts(ev, sol.Parts), nil
+}
+
+// RunParallel is Run with every part evaluated concurrently, each in its own
+// evaluator from newEv. The input section is evaluated once and its value
+// bound as `input` in every evaluator, after the top-level statements (which
+// run once per part). done is called with each result as its part finishes,
+// from the calling goroutine; the results are returned in part order.
+func RunParallel(newEv func() (*evaluator.Evaluator, error), sol Solution, done func(Result)) ([]Result, error) {
+    evs := make([]*evaluator.Evaluator, len(sol.Parts))
+    for i := range evs {
+        ev, err := newEv()
+        if err != nil { return nil, err }
+        input := sol.Input
+        if i > 0 { input = nil }
+        if err := prepare(ev, sol, input); err != nil { return nil, err }
+        if i > 0 {
+            if in, ok := evs[0].Lookup("input"); ok { ev.Define("input", in) }
+        }
+        evs[i] = ev
+    }
+    type finished struct {
+        index int
+        res   Result
+    }
+    ch := make(chan finished)
+    for i, part := range sol.Parts {
+        go func() { ch <- finished{i, runParts(evs[i], []parser.Section{part})[0]} }()
+    }
+    results := make([]Result, len(sol.Parts))
+    for range sol.Parts {
+        f := <-ch
+        results[f.index] = f.res
+        if done != nil { done(f.res) }
+    }
+    return results, nil
+}
+
+// prepare evaluates the top-level statements and binds `input` from the
+// given input section (if any).
+func prepare(ev *evaluator.Evaluator, sol Solution, input *parser.Section) error {
+    if _, err := ev.Eval(parser.Program{Statements: sol.Statements, Type: "Program"}); err != nil {
+        return err
+    }
+    if input == nil { return nil }
+    in, err := ev.EvalBlock(input.Body)
+    if err != nil { return err }
+    // `input: "aoc://2022/7"` is shorthand for read_aoc(2022, 7)
+    if s, isStr := in.(evaluator.Str); isStr && strings.HasPrefix(s.V, "aoc://") {
+        text, err := ev.ReadInput(s.V)
+        if err != nil { return err }
+        in = evaluator.Str{V: text}
+    }
+    ev.Define("input", in)
+    return nil
+}
+
+func runParts(ev *evaluator.Evaluator, parts []parser.Section) []Result {
+    results := make([]Result, 0, len(parts))
+    for _, part := range parts {
+        body := part.Body
+        results = append(results, Measure(ev, label(part.Name), func() (evaluator.Value, error) { return ev.EvalBlock(body) }))
+    }
+    return results
+}
+
+// Print writes one `Part N: <answer> (12ms)` line per result and reports
+// whether every part succeeded.
+func Print(w io.Writer, results []Result) bool {
+    ok := true
+    for _, r := range results {
+        if r.Err != nil {
+            fmt.Fprintf(w, "%s: [Error] %s\n", r.Label, r.Err)
+            for _, line := range evaluator.Trace(r.Err) { fmt.Fprintf(w, "  %s\n", line) }
+            ok = false
+            continue
+        }
+        fmt.Fprintf(w, "%s: ", r.Label)
+        r.Print.Write(w, r.Value)
+        fmt.Fprintf(w, " (%dms)\n", r.Duration.Milliseconds())
+    }
+    return ok
+}
+
+func label(section string) string {
+    for _, pn := range partNames {
+        if pn.section == section { return pn.label }
+    }
+    return section
+}
+
+type jsonResult struct {
+    Label      string `json:"label"`
+    Value      string `json:"value,omitempty"`
+    Error      string `json:"error,omitempty"`
+    At         string `json:"at,omitempty"` // the call an error arose at
+    DurationMs int64  `json:"duration_ms"`
+}
+
+// PrintJSON writes the results as a single JSON object and reports whether
+// every part succeeded.
+func PrintJSON(w io.Writer, results []Result) bool {
+    ok := true
+    out := make([]jsonResult, 0, len(results))
+    for _, r := range results {
+        jr := jsonResult{Label: r.Label, DurationMs: r.Duration.Milliseconds()}
+        if r.Err != nil {
+            jr.Error, jr.At = r.Err.Error(), evaluator.Where(r.Err)
+            ok = false
+        } else {
+            jr.Value = r.Print.Format(r.Value)
+        }
+        out = append(out, jr)
+    }
+    enc := json.NewEncoder(w)
+    enc.SetEscapeHTML(false)
+    enc.Encode(map[string][]jsonResult{"results": out})
+    return ok
+}
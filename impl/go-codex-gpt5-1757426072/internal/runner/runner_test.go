@@ -0,0 +1,117 @@
+package runner
+
+import (
+    "bytes"
+    "io"
+    "regexp"
+    "testing"
+
+    "elf-lang/impl/internal/evaluator"
+    "elf-lang/impl/internal/parser"
+)
+
+const solution = `let double = |x| x * 2;
+input: [1, 2, 3]
+part_one: { input |> fold(0, +) }
+part_two: double(size(input))
+`
+
+func load(t *testing.T, src string) Solution {
+    t.Helper()
+    prog, err := parser.Parse(src)
+    if err != nil { t.Fatal(err) }
+    sol, ok := Load(prog)
+    if !ok { t.Fatalf("%s: no part sections", src) }
+    return sol
+}
+
+// durations strips the timings from printed results.
+var durations = regexp.MustCompile(` \(\d+ms\)`)
+
+func TestLoad(t *testing.T) {
+    prog, err := parser.Parse("let x = 1;\nx + 1")
+    if err != nil { t.Fatal(err) }
+    if _, ok := Load(prog); ok { t.Error("a plain script loaded as a solution") }
+    sol := load(t, "part_two: 2\ninput: 0\npart_one: 1\nlet y = 3;")
+    if len(sol.Parts) != 2 || sol.Parts[0].Name != "part_one" || sol.Parts[1].Name != "part_two" { t.Errorf("got parts %+v, want part_one then part_two", sol.Parts) }
+    if sol.Input == nil || len(sol.Statements) != 1 { t.Errorf("got input %v and %d statements", sol.Input, len(sol.Statements)) }
+}
+
+func TestRun(t *testing.T) {
+    tests := []struct{ src, want string; ok bool }{
+        {solution, "Part 1: 6\nPart 2: 6\n", true},
+        {"input: 4\npart_one: input + 1", "Part 1: 5\n", true},
+        {"part_one: \"a\"\npart_two: [1, 2]", "Part 1: \"a\"\nPart 2: [1, 2]\n", true},
+        // a failing part is reported without stopping the others
+        {"input: 0\npart_one: 1 / input\npart_two: input", "Part 1: [Error] Division by zero\n  at 2:13\nPart 2: 0\n", false},
+    }
+    for _, tt := range tests {
+        results, err := Run(evaluator.New(io.Discard), load(t, tt.src))
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        var out bytes.Buffer
+        ok := Print(&out, results)
+        if got := durations.ReplaceAllString(out.String(), ""); got != tt.want || ok != tt.ok { t.Errorf("%s: got %q (%v), want %q (%v)", tt.src, got, ok, tt.want, tt.ok) }
+    }
+}
+
+func TestRunSetupError(t *testing.T) {
+    tests := []struct{ src, want string }{
+        {"let x = 1 / 0;\npart_one: x", "Division by zero"},
+        {"input: missing\npart_one: input", "Identifier can not be found: missing"},
+    }
+    for _, tt := range tests {
+        _, err := Run(evaluator.New(io.Discard), load(t, tt.src))
+        if err == nil || err.Error() != tt.want { t.Errorf("%s: got %v, want %s", tt.src, err, tt.want) }
+    }
+}
+
+func TestRunTests(t *testing.T) {
+    tests := []struct{ src, want string; ok bool }{
+        {solution + "test: { input: [4, 5]\npart_one: 9\npart_two: 4 }", "Test #1\n  Part 1: 9 passed\n  Part 2: 4 passed\n2 passed, 0 failed\n", true},
+        // only the parts a test expects are run
+        {solution + "test: { input: [1]\npart_two: 2 }\ntest: { input: [2]\npart_one: 3 }", "Test #1\n  Part 2: 2 passed\nTest #2\n  Part 1: 2 failed, expected 3\n1 passed, 1 failed\n", false},
+        {"part_one: 1 / input\ntest: { input: 0\npart_one: 1 }", "Test #1\n  Part 1: [Error] Division by zero\n    at 1:13\n0 passed, 1 failed\n", false},
+        {"part_one: input\ntest: { input: missing\npart_one: 1 }", "Test #1\n  [Error] Identifier can not be found: missing\n    at 2:16\n0 passed, 1 failed\n", false},
+        // each test starts from a fresh evaluator
+        {"let mut n = 0;\npart_one: { n = n + input; n }\ntest: { input: 2\npart_one: 2 }\ntest: { input: 3\npart_one: 3 }", "Test #1\n  Part 1: 2 passed\nTest #2\n  Part 1: 3 passed\n2 passed, 0 failed\n", true},
+    }
+    newEv := func() (*evaluator.Evaluator, error) { return evaluator.New(io.Discard), nil }
+    for _, tt := range tests {
+        var out bytes.Buffer
+        ok := PrintTests(&out, RunTests(newEv, load(t, tt.src)))
+        if got := durations.ReplaceAllString(out.String(), ""); got != tt.want || ok != tt.ok { t.Errorf("%s: got %q (%v), want %q (%v)", tt.src, got, ok, tt.want, tt.ok) }
+    }
+}
+
+func TestRunParallel(t *testing.T) {
+    tests := []struct{ src, want, output string; ok bool }{
+        {solution, "Part 1: 6\nPart 2: 6\n", "", true},
+        // the input section is evaluated once, the top-level statements once per part
+        {"puts(\"top\");\ninput: { puts(\"input\"); 5 }\npart_one: input\npart_two: input * 2", "Part 1: 5\nPart 2: 10\n", "\"top\" \n\"input\" \n\"top\" \n", true},
+        {"input: 0\npart_one: input\npart_two: 1 / input", "Part 1: 0\nPart 2: [Error] Division by zero\n  at 3:13\n", "", false},
+    }
+    for _, tt := range tests {
+        var output bytes.Buffer
+        newEv := func() (*evaluator.Evaluator, error) { return evaluator.New(&output), nil }
+        done := 0
+        results, err := RunParallel(newEv, load(t, tt.src), func(Result) { done++ })
+        if err != nil { t.Errorf("%s: %v", tt.src, err); continue }
+        if done != len(results) { t.Errorf("%s: done called %d times for %d results", tt.src, done, len(results)) }
+        var out bytes.Buffer
+        ok := Print(&out, results)
+        if got := durations.ReplaceAllString(out.String(), ""); got != tt.want || ok != tt.ok { t.Errorf("%s: got %q (%v), want %q (%v)", tt.src, got, ok, tt.want, tt.ok) }
+        if got := output.String(); got != tt.output { t.Errorf("%s: printed %q, want %q", tt.src, got, tt.output) }
+    }
+}
+
+func TestFormatCalls(t *testing.T) {
+    tests := []struct{ calls map[string]int64; want string }{
+        {nil, "none"},
+        {map[string]int64{"+": 7}, `"+": 7`},
+        // most frequent first, then by name
+        {map[string]int64{"map": 2, "==": 5, "fold": 2}, `"==": 5, "fold": 2, "map": 2`},
+    }
+    for _, tt := range tests {
+        if got := formatCalls(tt.calls); got != tt.want { t.Errorf("%v: got %s, want %s", tt.calls, got, tt.want) }
+    }
+}
@@ -0,0 +1,68 @@
+package runner
+
+import (
+    "fmt"
+    "io"
+    "runtime"
+    "sort"
+    "strings"
+    "time"
+
+    "elf-lang/impl/internal/evaluator"
+)
+
+// PartStats describes the cost of evaluating a single part.
+type PartStats struct {
+    evaluator.Stats
+    Allocated uint64 // bytes allocated while the part ran
+    Objects   uint64 // heap objects allocated while the part ran
+}
+
+// Measure evaluates fn, timing it and, when the evaluator has stats enabled,
+// recording allocation and evaluation counts for the run.
+func Measure(ev *evaluator.Evaluator, label string, fn func() (evaluator.Value, error)) Result {
+    var before, after runtime.MemStats
+    measured := ev.TakeStats() != nil // also resets the counters for this run
+    if measured { runtime.ReadMemStats(&before) }
+    start := time.Now()
+    v, err := fn()
+    res := Result{Label: label, Value: v, Err: err, Duration: time.Since(start), Print: ev.PrintMode()}
+    if measured {
+        runtime.ReadMemStats(&after)
+        res.Stats = &PartStats{
+            Stats:     *ev.TakeStats(),
+            Allocated: after.TotalAlloc - before.TotalAlloc,
+            Objects:   after.Mallocs - before.Mallocs,
+        }
+    }
+    return res
+}
+
+// PrintStats writes the stats report for each result that carries one.
+func PrintStats(w io.Writer, results []Result) {
+    for _, r := range results {
+        if r.Stats == nil { continue }
+        s := r.Stats
+        fmt.Fprintf(w, "%s stats:\n", r.Label)
+        fmt.Fprintf(w, "  wall time:     %s\n", r.Duration)
+        fmt.Fprintf(w, "  allocated:     %s (%d objects)\n", evaluator.FormatBytes(s.Allocated), s.Objects)
+        fmt.Fprintf(w, "  peak heap:     %s\n", evaluator.FormatBytes(s.PeakHeap))
+        fmt.Fprintf(w, "  evaluations:   %d\n", s.Evals)
+        fmt.Fprintf(w, "  builtin calls: %s\n", formatCalls(s.BuiltinCalls))
+    }
+}
+
+// formatCalls lists builtin call counts, most frequent first, with names
+// quoted so operators such as + read unambiguously.
+func formatCalls(calls map[string]int64) string {
+    if len(calls) == 0 { return "none" }
+    names := make([]string, 0, len(calls))
+    for name := range calls { names = append(names, name) }
+    sort.Slice(names, func(i, j int) bool {
+        if calls[names[i]] != calls[names[j]] { return calls[names[i]] > calls[names[j]] }
+        return names[i] < names[j]
+    })
+    parts := make([]string, len(names))
+    for i, name := range names { parts[i] = fmt.Sprintf("%q: %d", name, calls[name]) }
+    return strings.Join(parts, ", ")
+}
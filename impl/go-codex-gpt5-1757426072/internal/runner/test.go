@@ -0,0 +1,93 @@
+package runner
+
+import (
+    "fmt"
+    "io"
+
+    "elf-lang/impl/internal/evaluator"
+    "elf-lang/impl/internal/parser"
+)
+
+// TestResult is the outcome of one part of one `test:` block.
+type TestResult struct {
+    Result
+    Expected evaluator.Value
+    Passed   bool
+}
+
+// TestCase groups the part results of a single `test:` block.
+type TestCase struct {
+    Results []TestResult
+    Err     error // set when the test could not be prepared (e.g. its input failed)
+}
+
+// RunTests executes every `test:` block against the solution's parts. Each
+// test runs in a fresh evaluator from newEv, so state never leaks between
+// tests. Only the parts a test declares an expectation for are evaluated.
+func RunTests(newEv func() (*evaluator.Evaluator, error), sol Solution) []TestCase {
+    cases := make([]TestCase, 0, len(sol.Tests))
+    for _, test := range sol.Tests {
+        var input *parser.Section
+        expected := map[string]parser.Section{}
+        for _, st := range test.Body.Statements {
+            sec, ok := st.(parser.Section)
+            if !ok { continue }
+            if sec.Name == "input" {
+                in := sec
+                input = &in
+                continue
+            }
+            expected[sec.Name] = sec
+        }
+        ev, err := newEv()
+        if err == nil { err = prepare(ev, sol, input) }
+        if err != nil {
+            cases = append(cases, TestCase{Err: err})
+            continue
+        }
+        var tc TestCase
+        for _, part := range sol.Parts {
+            exp, ok := expected[part.Name]
+            if !ok { continue }
+            want, err := ev.EvalBlock(exp.Body)
+            if err != nil {
+                tc.Results = append(tc.Results, TestResult{Result: Result{Label: label(part.Name), Err: err}})
+                continue
+            }
+            res := runParts(ev, []parser.Section{part})[0]
+            passed := res.Err == nil && evaluator.ApproxEqual(res.Value, want)
+            tc.Results = append(tc.Results, TestResult{Result: res, Expected: want, Passed: passed})
+        }
+        cases = append(cases, tc)
+    }
+    return cases
+}
+
+// PrintTests writes a per-test report followed by a pass/fail summary and
+// reports whether every test passed.
+func PrintTests(w io.Writer, cases []TestCase) bool {
+    passed, failed := 0, 0
+    for i, tc := range cases {
+        fmt.Fprintf(w, "Test #%d\n", i+1)
+        if tc.Err != nil {
+            fmt.Fprintf(w, "  [Error] %s\n", tc.Err)
+            for _, line := range evaluator.Trace(tc.Err) { fmt.Fprintf(w, "    %s\n", line) }
+            failed++
+            continue
+        }
+        for _, r := range tc.Results {
+            switch {
+            case r.Err != nil:
+                fmt.Fprintf(w, "  %s: [Error] %s\n", r.Label, r.Err)
+                for _, line := range evaluator.Trace(r.Err) { fmt.Fprintf(w, "    %s\n", line) }
+            case r.Passed:
+                fmt.Fprintf(w, "  %s: %s passed (%dms)\n", r.Label, evaluator.Format(r.Value), r.Duration.Milliseconds())
+            default:
+                fmt.Fprintf(w, "  %s: %s failed, expected %s\n", r.Label, evaluator.Format(r.Value), evaluator.Format(r.Expected))
+            }
+            if r.Passed { passed++ } else { failed++ }
+        }
+    }
+    fmt.Fprintf(w, "%d passed, %d failed\n", passed, failed)
+    return failed == 0
+}